@@ -1,9 +1,14 @@
 package cache
 
 import (
+	"context"
+	"github.com/devfeel/cache/codec"
+	"github.com/devfeel/cache/internal/cacheerr"
 	"github.com/devfeel/cache/redis"
 	"github.com/devfeel/cache/runtime"
+	"io"
 	"sync"
+	"time"
 )
 
 const (
@@ -17,14 +22,33 @@ const (
 )
 
 var (
-	runtime_cache  Cache
-	redisCacheMap  map[string]RedisCache
-	redisCacheLock *sync.RWMutex
+	// ErrNotFound is returned by getters in strict mode when the key does not exist or is expired
+	// use runtime.WithStrictMode or RedisCache.SetStrictMode to enable strict mode
+	ErrNotFound = cacheerr.ErrNotFound
+	// ErrOverflow is returned by counters when the result overflows
+	ErrOverflow = cacheerr.ErrOverflow
+	// ErrTypeMismatch is returned when the stored value is not of the type required by the operation
+	ErrTypeMismatch = cacheerr.ErrTypeMismatch
+)
+
+var (
+	runtime_cache    Cache
+	runtimeCacheLock *sync.Mutex
+	redisCacheMap    map[string]RedisCache
+	redisCacheLock   *sync.RWMutex
+)
+
+var (
+	_ CacheCtx      = (*runtime.RuntimeCache)(nil)
+	_ CacheCtx      = (*runtime.ShardedRuntimeCache)(nil)
+	_ RedisCacheCtx = (*redis.ShardedRedisCache)(nil)
+	_ Cache         = (*TieredCache)(nil)
 )
 
 func init() {
 	redisCacheMap = make(map[string]RedisCache)
 	redisCacheLock = new(sync.RWMutex)
+	runtimeCacheLock = new(sync.Mutex)
 }
 
 type (
@@ -32,12 +56,15 @@ type (
 		// Exist return true if value cached by given key
 		Exists(key string) (bool, error)
 		// Get returns value by given key
+		// in strict mode, getters return ErrNotFound if key not exists, instead of a zero value
 		Get(key string) (interface{}, error)
 		// GetString returns value string format by given key
 		GetString(key string) (string, error)
 		// GetInt returns value int format by given key
+		// in strict mode, return ErrTypeMismatch if value is not an integer
 		GetInt(key string) (int, error)
 		// GetInt64 returns value int64 format by given key
+		// in strict mode, return ErrTypeMismatch if value is not an integer
 		GetInt64(key string) (int64, error)
 		// Set cache value by given key
 		Set(key string, v interface{}, ttl int64) error
@@ -47,6 +74,18 @@ type (
 		// Decr decreases int64-type value by given key as a counter
 		// if key not exist, before increase set value with zero
 		Decr(key string) (int64, error)
+		// IncrBy increases int64-type value by given key with delta as a counter
+		// if key not exist, before increase set value with zero
+		// return ErrOverflow if result overflows, ErrTypeMismatch if value is not an integer
+		IncrBy(key string, delta int64) (int64, error)
+		// DecrBy decreases int64-type value by given key with delta as a counter
+		// if key not exist, before decrease set value with zero
+		// return ErrOverflow if result overflows, ErrTypeMismatch if value is not an integer
+		DecrBy(key string, delta int64) (int64, error)
+		// IncrByFloat increases float-type value by given key with delta as a counter
+		// if key not exist, before increase set value with zero
+		// return ErrOverflow if result is NaN or Infinity, ErrTypeMismatch if value is not a number
+		IncrByFloat(key string, delta float64) (float64, error)
 		// Delete delete cache item by given key
 		Delete(key string) error
 		// ClearAll clear all cache items
@@ -54,6 +93,19 @@ type (
 		// Expire Set a timeout on key. After the timeout has expired, the key will automatically be deleted.
 		// timeout time duration is second
 		Expire(key string, timeOutSeconds int) (int, error)
+		// MGet returns values of keys in one round-trip, keys which non-existed or expired are not in the returned map
+		MGet(keys ...string) (map[string]interface{}, error)
+		// MSet set all items in one round-trip, ttl is second, if ttl is 0, it will be forever
+		MSet(items map[string]interface{}, ttl int64) error
+		// MDelete delete items by given keys in one round-trip
+		MDelete(keys ...string) error
+		// GetOrLoad returns value by given key, on a miss it calls loader and sets its value with ttl
+		// concurrent misses of the same key in the process wait for one loader call and share its result
+		// the loaded value is returned in the form Get returns it, so hits and misses have the same type
+		GetOrLoad(key string, ttl int64, loader func() (interface{}, error)) (interface{}, error)
+		// Close stop background goroutines, close connection pools and remove the cache from GetCache registries
+		// the cache must not be used after Close
+		io.Closer
 	}
 
 	RedisCache interface {
@@ -62,6 +114,30 @@ type (
 		SetReadOnlyServer(serverUrl string, maxIdle int, maxActive int)
 		// SetBackupServer set backup redis server, only use to read
 		SetBackupServer(serverUrl string, maxIdle int, maxActive int)
+		// SetCodec set codec used to encode values, default is codec.JSONCodec
+		// values stored by Set, HSet, LPush, RPush, RPushX and SAdd are encoded by it,
+		// except string, []byte, number and bool, which are stored as their text form
+		SetCodec(c codec.Codec)
+		// SetCompression set compression used for values larger than threshold bytes, default is redis.CompressionNone
+		// compressed values are flagged with a header, so old uncompressed values are still read correctly
+		SetCompression(compression redis.Compression, threshold int)
+		// GetObj get value stored by Set and decode it into result, return ErrNotFound if key not exists
+		GetObj(key string, result interface{}) error
+		// HGetObj get field value stored by HSet and decode it into result, return ErrNotFound if field not exists
+		HGetObj(hashID string, field string, result interface{}) error
+		// Decode decode data returned by commands like LPop, LRange or SMembers into result
+		Decode(data string, result interface{}) error
+		// SetStrictMode set strict mode, getters return ErrNotFound if key not exists,
+		// GetInt and GetInt64 return ErrTypeMismatch if value is not an integer
+		SetStrictMode(strict bool)
+		// SetLoadLock enable the distributed mode of GetOrLoad, a miss is loaded by the process holding a lock of the key,
+		// other processes wait for the value until the lock expires after ttl, 0 disables it
+		SetLoadLock(ttl time.Duration)
+		// SetLoader set the loader which refreshes values set by SetWithSoftTTL in the background, default is nil
+		SetLoader(loader func(key string) (interface{}, error))
+		// SetWithSoftTTL set cache value by given key with a soft ttl, the soft deadline is stored with the value,
+		// after it, getters return the stale value and refresh it by the loader of SetLoader, the key is deleted after ttl
+		SetWithSoftTTL(key string, v interface{}, softTTL int64, ttl int64) error
 
 		/*---------- Hash -----------*/
 		// HGet Returns the value associated with field in the hash stored at key.
@@ -70,7 +146,8 @@ type (
 		HMGet(hashID string, field ...interface{}) ([]string, error)
 		// HSet Sets field in the hash stored at key to value. If key does not exist, a new key holding a hash is created.
 		// If field already exists in the hash, it is overwritten.
-		HSet(hashID string, field string, val string) error
+		// val is encoded by the codec if it is not a string, []byte, number or bool
+		HSet(hashID string, field string, val interface{}) error
 		// HGetAll Returns all fields and values of the hash stored at key
 		HGetAll(hashID string) (map[string]string, error)
 		// HSetNX Sets field in the hash stored at key to value, only if field does not yet exist
@@ -193,6 +270,119 @@ type (
 		//****************** lua scripts *********************
 		// EVAL used to evaluate scripts using the Lua interpreter built into Redis starting from version 2.6.0
 		EVAL(script string, argsNum int, arg ...interface{}) (interface{}, error)
+
+		//****************** pipeline *********************
+		// Pipeline returns a builder which queues commands and executes them in one round-trip,
+		// read-only pipelines follow the readonly and backup routing, others are sent to the default server
+		Pipeline() *redis.Pipeline
+
+		//****************** transactions *********************
+		// Tx runs fn and executes the commands queued by it atomically with MULTI/EXEC on the default server
+		Tx(fn func(tx *redis.Tx) error) error
+		// Watch is Tx with optimistic locking, fn is called again if any of keys is modified before EXEC
+		Watch(fn func(tx *redis.Tx) error, keys ...string) error
+
+		//****************** distributed lock *********************
+		// NewLocker returns a distributed lock on the default server, locks hold a random token of the owner
+		NewLocker(opts ...redis.LockOption) *redis.Locker
+	}
+)
+
+type (
+	// CacheCtx is Cache with context-aware methods, every cache of this package implements it
+	// use c.(cache.CacheCtx) to get it from a Cache
+	// for redis, the deadline of ctx bounds pool wait, dial, write and read,
+	// and the method returns ctx.Err() when ctx is canceled
+	CacheCtx interface {
+		Cache
+		ExistsCtx(ctx context.Context, key string) (bool, error)
+		GetCtx(ctx context.Context, key string) (interface{}, error)
+		GetStringCtx(ctx context.Context, key string) (string, error)
+		GetIntCtx(ctx context.Context, key string) (int, error)
+		GetInt64Ctx(ctx context.Context, key string) (int64, error)
+		SetCtx(ctx context.Context, key string, v interface{}, ttl int64) error
+		IncrCtx(ctx context.Context, key string) (int64, error)
+		DecrCtx(ctx context.Context, key string) (int64, error)
+		IncrByCtx(ctx context.Context, key string, delta int64) (int64, error)
+		DecrByCtx(ctx context.Context, key string, delta int64) (int64, error)
+		IncrByFloatCtx(ctx context.Context, key string, delta float64) (float64, error)
+		DeleteCtx(ctx context.Context, key string) error
+		ClearAllCtx(ctx context.Context) error
+		ExpireCtx(ctx context.Context, key string, timeOutSeconds int) (int, error)
+		MGetCtx(ctx context.Context, keys ...string) (map[string]interface{}, error)
+		MSetCtx(ctx context.Context, items map[string]interface{}, ttl int64) error
+		MDeleteCtx(ctx context.Context, keys ...string) error
+		GetOrLoadCtx(ctx context.Context, key string, ttl int64, loader func() (interface{}, error)) (interface{}, error)
+	}
+
+	// RedisCacheCtx is RedisCache with context-aware methods
+	// use c.(cache.RedisCacheCtx) to get it from a RedisCache
+	// blocking commands like BLPopCtx are sent again every second until done, so they can be canceled
+	RedisCacheCtx interface {
+		RedisCache
+		CacheCtx
+		HGetCtx(ctx context.Context, hashID string, field string) (string, error)
+		HMGetCtx(ctx context.Context, hashID string, field ...interface{}) ([]string, error)
+		HSetCtx(ctx context.Context, hashID string, field string, val interface{}) error
+		HGetAllCtx(ctx context.Context, hashID string) (map[string]string, error)
+		HSetNXCtx(ctx context.Context, hashID string, field string, val string) (string, error)
+		HDelCtx(ctx context.Context, hashID string, fields ...interface{}) (int, error)
+		HExistsCtx(ctx context.Context, hashID string, field string) (int, error)
+		HIncrByCtx(ctx context.Context, hashID string, field string, increment int) (int, error)
+		HIncrByFloatCtx(ctx context.Context, hashID string, field string, increment float64) (float64, error)
+		HKeysCtx(ctx context.Context, hashID string) ([]string, error)
+		HLenCtx(ctx context.Context, hashID string) (int, error)
+		HValsCtx(ctx context.Context, hashID string) ([]string, error)
+		GetJsonObjCtx(ctx context.Context, key string, result interface{}) error
+		SetJsonObjCtx(ctx context.Context, key string, val interface{}) (interface{}, error)
+		BLPopCtx(ctx context.Context, key ...interface{}) (map[string]string, error)
+		BRPopCtx(ctx context.Context, key ...interface{}) (map[string]string, error)
+		BRPopLPushCtx(ctx context.Context, source string, destination string) (string, error)
+		LIndexCtx(ctx context.Context, key string, index int) (string, error)
+		LInsertCtx(ctx context.Context, key string, direction string, pivot string, value string) (int, error)
+		LLenCtx(ctx context.Context, key string) (int, error)
+		LPopCtx(ctx context.Context, key string) (string, error)
+		LPushCtx(ctx context.Context, key string, value ...interface{}) (int, error)
+		LPushXCtx(ctx context.Context, key string, value string) (int, error)
+		LRangeCtx(ctx context.Context, key string, start int, end int) ([]string, error)
+		LRemCtx(ctx context.Context, key string, count int, value string) (int, error)
+		LSetCtx(ctx context.Context, key string, index int, value string) (string, error)
+		LTrimCtx(ctx context.Context, key string, start int, stop int) (string, error)
+		RPopCtx(ctx context.Context, key string) (string, error)
+		RPopLPushCtx(ctx context.Context, source string, destination string) (string, error)
+		RPushCtx(ctx context.Context, key string, value ...interface{}) (int, error)
+		RPushXCtx(ctx context.Context, key string, value ...interface{}) (int, error)
+		SAddCtx(ctx context.Context, key string, value ...interface{}) (int, error)
+		SCardCtx(ctx context.Context, key string) (int, error)
+		SDiffCtx(ctx context.Context, key ...interface{}) ([]string, error)
+		SDiffStoreCtx(ctx context.Context, destination string, key ...interface{}) (int, error)
+		SInterCtx(ctx context.Context, key ...interface{}) ([]string, error)
+		SInterStoreCtx(ctx context.Context, destination string, key ...interface{}) (int, error)
+		SIsMemberCtx(ctx context.Context, key string, value string) (bool, error)
+		SMembersCtx(ctx context.Context, key string) ([]string, error)
+		SMoveCtx(ctx context.Context, source string, destination string, value string) (bool, error)
+		SPopCtx(ctx context.Context, key string) (string, error)
+		SRandMemberCtx(ctx context.Context, key string, count int) ([]string, error)
+		SRemCtx(ctx context.Context, key string, value ...interface{}) (int, error)
+		SUnionCtx(ctx context.Context, key ...interface{}) ([]string, error)
+		SUnionStoreCtx(ctx context.Context, destination string, key ...interface{}) (int, error)
+		ZAddCtx(ctx context.Context, key string, score int64, member interface{}) (int, error)
+		ZCountCtx(ctx context.Context, key string, min, max int64) (int, error)
+		ZRemCtx(ctx context.Context, key string, member ...interface{}) (int, error)
+		ZCardCtx(ctx context.Context, key string) (int, error)
+		ZRankCtx(ctx context.Context, key, member string) (int, error)
+		ZRangeCtx(ctx context.Context, key string, start, stop int64) ([]string, error)
+		ZRangeByScoreCtx(ctx context.Context, key string, start, stop string, isWithScores bool) ([]string, error)
+		ZREVRangeByScoreCtx(ctx context.Context, key string, max, min string, isWithScores bool) ([]string, error)
+		ZRevRangeCtx(ctx context.Context, key string, start, stop int64) ([]string, error)
+		PublishCtx(ctx context.Context, channel string, message interface{}) (int64, error)
+		EVALCtx(ctx context.Context, script string, argsNum int, arg ...interface{}) (interface{}, error)
+		GetObjCtx(ctx context.Context, key string, result interface{}) error
+		SetWithSoftTTLCtx(ctx context.Context, key string, v interface{}, softTTL int64, ttl int64) error
+		HGetObjCtx(ctx context.Context, hashID string, field string, result interface{}) error
+		SubscribeCtx(ctx context.Context, receive chan redis.Message, channels ...interface{}) error
+		TxCtx(ctx context.Context, fn func(tx *redis.Tx) error) error
+		WatchCtx(ctx context.Context, fn func(tx *redis.Tx) error, keys ...string) error
 	}
 )
 
@@ -221,8 +411,10 @@ func GetCache(ctype string, serverUrl ...string) Cache {
 
 //get runtime cache
 func GetRuntimeCache() Cache {
+	runtimeCacheLock.Lock()
+	defer runtimeCacheLock.Unlock()
 	if runtime_cache == nil {
-		runtime_cache = NewRuntimeCache()
+		runtime_cache = &registeredRuntimeCache{runtime.NewRuntimeCache()}
 	}
 	return runtime_cache
 }
@@ -242,22 +434,31 @@ func GetRedisCachePoolConf(serverUrl string, maxIdle int, maxActive int) RedisCa
 	if maxActive < 0 {
 		maxActive = RedisConnPool_MaxActive
 	}
+	redisCacheLock.RLock()
 	c, ok := redisCacheMap[serverUrl]
-	if !ok {
-		c = NewRedisCache(serverUrl, maxIdle, maxActive)
-		redisCacheLock.Lock()
-		redisCacheMap[serverUrl] = c
-		redisCacheLock.Unlock()
-		return c
-
-	} else {
+	redisCacheLock.RUnlock()
+	if ok {
 		return c
 	}
+	redisCacheLock.Lock()
+	defer redisCacheLock.Unlock()
+	if c, ok = redisCacheMap[serverUrl]; !ok {
+		c = &registeredRedisCache{redis.NewRedisCache(serverUrl, maxIdle, maxActive), serverUrl}
+		redisCacheMap[serverUrl] = c
+	}
+	return c
 }
 
 //new runtime cache
-func NewRuntimeCache() Cache {
-	return runtime.NewRuntimeCache()
+//with no option, the cache is unbounded, use runtime.WithMaxEntries to limit it
+func NewRuntimeCache(opts ...runtime.Option) Cache {
+	return runtime.NewRuntimeCache(opts...)
+}
+
+//new sharded runtime cache, keys are spread over independently locked shards
+//use it to reduce lock contention on many cores, if shards <= 0, use runtime.DefaultShardCount
+func NewShardedRuntimeCache(shards int, opts ...runtime.Option) Cache {
+	return runtime.NewShardedRuntimeCache(shards, opts...)
 }
 
 //new redis cache
@@ -265,3 +466,53 @@ func NewRuntimeCache() Cache {
 func NewRedisCache(serverUrl string, maxIdle int, maxActive int) RedisCache {
 	return redis.NewRedisCache(serverUrl, maxIdle, maxActive)
 }
+
+//new sentinel redis cache, the default server is the master of masterName and follows failovers
+//must set sentinelAddrs like "10.0.1.11:26379"
+func NewSentinelRedisCache(sentinelAddrs []string, masterName string, maxIdle int, maxActive int, opts ...redis.SentinelOption) (RedisCache, error) {
+	ca, err := redis.NewSentinelRedisCache(sentinelAddrs, masterName, maxIdle, maxActive, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+//new sharded redis cache, keys are spread over independent servers by a consistent hash ring
+//must set serverUrls like "redis://:password@10.0.1.11:6379/0"
+//the readonly and backup servers of shards are set by redis.WithShardReplica and redis.WithShardBackup
+func NewShardedRedisCache(serverUrls []string, maxIdle int, maxActive int, opts ...redis.ShardOption) (RedisCache, error) {
+	ca, err := redis.NewShardedRedisCache(serverUrls, maxIdle, maxActive, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+//new cluster redis cache, commands are routed to the node of their keys
+//must set serverUrls like "redis://:password@10.0.1.11:7000/0", some nodes of the cluster are enough
+func NewClusterRedisCache(serverUrls []string, maxIdle int, maxActive int) (RedisCache, error) {
+	ca, err := redis.NewClusterRedisCache(serverUrls, maxIdle, maxActive)
+	if err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+//new near redis cache, values read by Get are copied locally and evicted by invalidation messages of CLIENT TRACKING
+//needs redis 6.0 or later, must set serverUrl like "redis://:password@10.0.1.11:6379/0"
+func NewNearRedisCache(serverUrl string, maxIdle int, maxActive int, opts ...redis.NearCacheOption) (RedisCache, error) {
+	ca, err := redis.NewNearRedisCache(serverUrl, maxIdle, maxActive, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+//new redlock on the default server of every cache, caches should be independent servers, usually 3 or 5
+func NewRedlock(caches []RedisCache, opts ...redis.LockOption) *redis.Redlock {
+	lockers := make([]*redis.Locker, len(caches))
+	for i, c := range caches {
+		lockers[i] = c.NewLocker()
+	}
+	return redis.NewRedlock(lockers, opts...)
+}
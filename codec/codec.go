@@ -0,0 +1,25 @@
+// Package codec holds the encoders used to store values as bytes in redis.
+package codec
+
+import "encoding/json"
+
+// Codec marshals values to bytes and unmarshals them back.
+type Codec interface {
+	// Marshal returns the encoding of v
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into v, v must be a pointer
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec encodes values with encoding/json, it is the default codec.
+type JSONCodec struct{}
+
+// Marshal returns the json encoding of v.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal parses the json data and stores the result in v.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
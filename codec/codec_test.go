@@ -0,0 +1,41 @@
+package codec
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type testUser struct {
+	Name string
+	Age  int
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	for name, c := range map[string]Codec{"json": JSONCodec{}, "gob": GobCodec{}, "msgpack": MsgpackCodec{}} {
+		data, err := c.Marshal(testUser{Name: "devfeel", Age: 10})
+		if err != nil {
+			t.Error("TestCodec_RoundTrip", name, "marshal error", err)
+			continue
+		}
+		var user testUser
+		if err := c.Unmarshal(data, &user); err != nil || user.Name != "devfeel" || user.Age != 10 {
+			t.Error("TestCodec_RoundTrip", name, "expect devfeel 10, got", user, err)
+		}
+	}
+}
+
+func TestProtobufCodec(t *testing.T) {
+	c := ProtobufCodec{}
+	data, err := c.Marshal(wrapperspb.String("devfeel"))
+	if err != nil {
+		t.Error("TestProtobufCodec marshal error", err)
+	}
+	value := new(wrapperspb.StringValue)
+	if err := c.Unmarshal(data, value); err != nil || value.GetValue() != "devfeel" {
+		t.Error("TestProtobufCodec expect devfeel, got", value.GetValue(), err)
+	}
+	if _, err := c.Marshal(testUser{}); err != ErrNotProtoMessage {
+		t.Error("TestProtobufCodec expect ErrNotProtoMessage, got", err)
+	}
+}
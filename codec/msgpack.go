@@ -0,0 +1,16 @@
+package codec
+
+import "github.com/vmihailenco/msgpack/v5"
+
+// MsgpackCodec encodes values with MessagePack, smaller and faster than json.
+type MsgpackCodec struct{}
+
+// Marshal returns the msgpack encoding of v.
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal decodes the msgpack data and stores the result in v.
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
@@ -0,0 +1,31 @@
+package codec
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ErrNotProtoMessage is returned by ProtobufCodec when the value is not a proto.Message.
+var ErrNotProtoMessage = errors.New("codec: value is not a proto.Message")
+
+// ProtobufCodec encodes protobuf messages, values must implement proto.Message.
+type ProtobufCodec struct{}
+
+// Marshal returns the protobuf encoding of v.
+func (ProtobufCodec) Marshal(v interface{}) ([]byte, error) {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(message)
+}
+
+// Unmarshal parses the protobuf data and stores the result in v.
+func (ProtobufCodec) Unmarshal(data []byte, v interface{}) error {
+	message, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(data, message)
+}
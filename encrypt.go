@@ -0,0 +1,541 @@
+package cache
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/devfeel/cache/codec"
+	"github.com/devfeel/cache/internal/singleflight"
+	"github.com/devfeel/cache/redis"
+)
+
+var (
+	// ErrAuthFailed is returned when a value can not be decrypted,
+	// because it was modified, encrypted for another key, or is not encrypted at all
+	ErrAuthFailed = errors.New("cache: value authentication failed")
+	// ErrUnknownKeyID is returned when a value was encrypted with a key id which is not in the Keyring
+	ErrUnknownKeyID = errors.New("cache: unknown encryption key id")
+)
+
+const (
+	// encryptVersion starts every encrypted value, followed by the 4 bytes key id and the nonce
+	encryptVersion    byte = 0xE1
+	encryptHeaderSize      = 1 + 4
+)
+
+// Keyring holds AES-GCM keys by id, the primary key encrypts new values, all keys decrypt.
+// to rotate keys, add the new key as primary and keep old keys until their values expire.
+type Keyring struct {
+	primary uint32
+	aeads   map[uint32]cipher.AEAD
+}
+
+// NewKeyring returns a new *Keyring encrypting with the key of primaryID.
+// keys must be 16, 24 or 32 bytes, for AES-128, AES-192 or AES-256.
+func NewKeyring(primaryID uint32, keys map[uint32][]byte) (*Keyring, error) {
+	if _, ok := keys[primaryID]; !ok {
+		return nil, ErrUnknownKeyID
+	}
+	k := &Keyring{primary: primaryID, aeads: make(map[uint32]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("cache: key %d: %v", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[id] = aead
+	}
+	return k, nil
+}
+
+// Encrypt seals plaintext with the primary key, aad is authenticated but not stored.
+func (k *Keyring) Encrypt(plaintext, aad []byte) ([]byte, error) {
+	aead := k.aeads[k.primary]
+	out := make([]byte, encryptHeaderSize+aead.NonceSize(), encryptHeaderSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	out[0] = encryptVersion
+	binary.BigEndian.PutUint32(out[1:encryptHeaderSize], k.primary)
+	nonce := out[encryptHeaderSize:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, plaintext, aad), nil
+}
+
+// Decrypt opens data sealed by Encrypt with the key of its key id.
+// return ErrUnknownKeyID if the key id is not in the Keyring, ErrAuthFailed if authentication fails.
+func (k *Keyring) Decrypt(data, aad []byte) ([]byte, error) {
+	if len(data) < encryptHeaderSize || data[0] != encryptVersion {
+		return nil, ErrAuthFailed
+	}
+	aead, ok := k.aeads[binary.BigEndian.Uint32(data[1:encryptHeaderSize])]
+	if !ok {
+		return nil, ErrUnknownKeyID
+	}
+	data = data[encryptHeaderSize:]
+	if len(data) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrAuthFailed
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	return plaintext, nil
+}
+
+// encrypter turns values into sealed bytes and back, shared by EncryptedCache and EncryptedRedisCache.
+// the cache key is used as additional data, so a value copied to another key fails to decrypt.
+type encrypter struct {
+	keyring *Keyring
+	codec   codec.Codec
+	// loads collapses concurrent loads of GetOrLoad
+	loads *singleflight.Group
+}
+
+func (e *encrypter) seal(value interface{}, aad string) ([]byte, error) {
+	plaintext, err := e.encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return e.keyring.Encrypt(plaintext, []byte(aad))
+}
+
+// encode returns the plaintext of value, as returned by Get after decryption
+func (e *encrypter) encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		return []byte(fmt.Sprint(v)), nil
+	}
+	return e.codec.Marshal(value)
+}
+
+// open decrypts a reply, nil reply is returned as nil
+func (e *encrypter) open(reply interface{}, aad string) ([]byte, error) {
+	switch v := reply.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return e.keyring.Decrypt(v, []byte(aad))
+	case string:
+		return e.keyring.Decrypt([]byte(v), []byte(aad))
+	}
+	return nil, ErrAuthFailed
+}
+
+func (e *encrypter) openString(s string, aad string) (string, error) {
+	plaintext, err := e.keyring.Decrypt([]byte(s), []byte(aad))
+	return string(plaintext), err
+}
+
+// decode decodes plaintext into result, like GetObj
+func (e *encrypter) decode(plaintext []byte, result interface{}) error {
+	switch r := result.(type) {
+	case *string:
+		*r = string(plaintext)
+		return nil
+	case *[]byte:
+		*r = plaintext
+		return nil
+	}
+	return e.codec.Unmarshal(plaintext, result)
+}
+
+// sealItems encrypts values of items for MSet
+func (e *encrypter) sealItems(items map[string]interface{}) (map[string]interface{}, error) {
+	sealed := make(map[string]interface{}, len(items))
+	for key, value := range items {
+		data, err := e.seal(value, key)
+		if err != nil {
+			return nil, err
+		}
+		sealed[key] = data
+	}
+	return sealed, nil
+}
+
+// openItems decrypts values returned by MGet in place
+func (e *encrypter) openItems(items map[string]interface{}) (map[string]interface{}, error) {
+	for key, reply := range items {
+		plaintext, err := e.open(reply, key)
+		if err != nil {
+			return nil, err
+		}
+		items[key] = plaintext
+	}
+	return items, nil
+}
+
+// getOrLoad returns the value of key by get, on a miss it calls loader, encrypts its value and stores it by set
+// of the wrapped cache, so the loaded value is never stored in clear, and returns its plaintext, like get
+func (e *encrypter) getOrLoad(key string, ttl int64, loader func() (interface{}, error),
+	get func(string) (interface{}, error), set func(string, interface{}, int64) error) (interface{}, error) {
+	if v, err := get(key); v != nil || (err != nil && err != ErrNotFound) {
+		return v, err
+	}
+	return e.loads.Do(key, func() (interface{}, error) {
+		v, err := loader()
+		if err != nil || v == nil {
+			return v, err
+		}
+		plaintext, err := e.encode(v)
+		if err != nil {
+			return nil, err
+		}
+		sealed, err := e.keyring.Encrypt(plaintext, []byte(key))
+		if err != nil {
+			return nil, err
+		}
+		return plaintext, set(key, sealed, ttl)
+	})
+}
+
+func hashAAD(hashID string, field string) string {
+	return hashID + "\x00" + field
+}
+
+// EncryptedCache is a Cache whose values are encrypted with AES-GCM,
+// it can wrap a RuntimeCache or any other Cache, use EncryptedRedisCache for RedisCache.
+// Set stores the sealed bytes, Get returns the decrypted bytes, values which are not string, []byte,
+// number or bool are encoded by the codec, codec.JSONCodec by default.
+// counters are not encrypted, Incr, Decr, IncrBy, DecrBy and IncrByFloat are passed to the wrapped cache.
+type EncryptedCache struct {
+	Cache
+	encrypter
+}
+
+// NewEncryptedCache returns a new *EncryptedCache storing values in c.
+func NewEncryptedCache(c Cache, keyring *Keyring) *EncryptedCache {
+	return &EncryptedCache{Cache: c, encrypter: encrypter{keyring: keyring, codec: codec.JSONCodec{}, loads: new(singleflight.Group)}}
+}
+
+// SetCodec set codec used to encode values, default is codec.JSONCodec
+func (ec *EncryptedCache) SetCodec(c codec.Codec) {
+	if c != nil {
+		ec.codec = c
+	}
+}
+
+// Get returns decrypted bytes by given key
+// return ErrAuthFailed or ErrUnknownKeyID if value can not be decrypted
+func (ec *EncryptedCache) Get(key string) (interface{}, error) {
+	reply, err := ec.Cache.Get(key)
+	if err != nil || reply == nil {
+		return reply, err
+	}
+	return ec.open(reply, key)
+}
+
+// GetString returns decrypted value string format by given key
+func (ec *EncryptedCache) GetString(key string) (string, error) {
+	reply, err := ec.Get(key)
+	if err != nil || reply == nil {
+		return "", err
+	}
+	return string(reply.([]byte)), nil
+}
+
+// GetInt returns decrypted value int format by given key
+func (ec *EncryptedCache) GetInt(key string) (int, error) {
+	v, err := ec.GetInt64(key)
+	return int(v), err
+}
+
+// GetInt64 returns decrypted value int64 format by given key
+func (ec *EncryptedCache) GetInt64(key string) (int64, error) {
+	v, err := ec.GetString(key)
+	if err != nil || v == "" {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, ErrTypeMismatch
+	}
+	return i, nil
+}
+
+// GetObj get value by given key and decode it into result
+// if non-existed or expired, return ErrNotFound
+func (ec *EncryptedCache) GetObj(key string, result interface{}) error {
+	plaintext, err := ec.Get(key)
+	if err != nil {
+		return err
+	}
+	if plaintext == nil {
+		return ErrNotFound
+	}
+	return ec.decode(plaintext.([]byte), result)
+}
+
+// Set encrypts value and stores it by given key
+func (ec *EncryptedCache) Set(key string, value interface{}, ttl int64) error {
+	sealed, err := ec.seal(value, key)
+	if err != nil {
+		return err
+	}
+	return ec.Cache.Set(key, sealed, ttl)
+}
+
+// MGet returns decrypted bytes of keys, keys which non-existed or expired are not in the returned map
+func (ec *EncryptedCache) MGet(keys ...string) (map[string]interface{}, error) {
+	items, err := ec.Cache.MGet(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return ec.openItems(items)
+}
+
+// GetOrLoad returns decrypted bytes by given key, on a miss it calls loader, encrypts its value and stores it with ttl.
+// concurrent misses of the same key wait for one loader call, the loaded value is returned like Get, as its plaintext bytes.
+func (ec *EncryptedCache) GetOrLoad(key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	return ec.getOrLoad(key, ttl, loader, ec.Get, ec.Cache.Set)
+}
+
+// MSet encrypts values and stores all items
+func (ec *EncryptedCache) MSet(items map[string]interface{}, ttl int64) error {
+	sealed, err := ec.sealItems(items)
+	if err != nil {
+		return err
+	}
+	return ec.Cache.MSet(sealed, ttl)
+}
+
+// EncryptedRedisCache is a RedisCache whose values stored by Set, MSet, SetJsonObj and HSet are encrypted with AES-GCM,
+// they are decrypted by Get, MGet, GetString, GetInt, GetInt64, GetObj, GetJsonObj, HGet, HGetObj, HMGet, HGetAll and HVals.
+// other commands, like lists, sets, counters, Pipeline and Tx, are passed to the wrapped cache without encryption.
+type EncryptedRedisCache struct {
+	RedisCache
+	encrypter
+}
+
+// NewEncryptedRedisCache returns a new *EncryptedRedisCache storing values in c.
+func NewEncryptedRedisCache(c RedisCache, keyring *Keyring) *EncryptedRedisCache {
+	return &EncryptedRedisCache{RedisCache: c, encrypter: encrypter{keyring: keyring, codec: codec.JSONCodec{}, loads: new(singleflight.Group)}}
+}
+
+// SetCodec set codec used to encode values before encryption, default is codec.JSONCodec
+func (ec *EncryptedRedisCache) SetCodec(c codec.Codec) {
+	if c != nil {
+		ec.codec = c
+	}
+}
+
+// Get returns decrypted bytes by given key
+// return ErrAuthFailed or ErrUnknownKeyID if value can not be decrypted
+func (ec *EncryptedRedisCache) Get(key string) (interface{}, error) {
+	reply, err := ec.RedisCache.Get(key)
+	if err != nil || reply == nil {
+		return reply, err
+	}
+	return ec.open(reply, key)
+}
+
+// GetString returns decrypted value string format by given key
+func (ec *EncryptedRedisCache) GetString(key string) (string, error) {
+	reply, err := ec.RedisCache.GetString(key)
+	if err != nil {
+		return reply, err
+	}
+	return ec.openString(reply, key)
+}
+
+// GetInt returns decrypted value int format by given key
+func (ec *EncryptedRedisCache) GetInt(key string) (int, error) {
+	v, err := ec.GetInt64(key)
+	return int(v), err
+}
+
+// GetInt64 returns decrypted value int64 format by given key
+func (ec *EncryptedRedisCache) GetInt64(key string) (int64, error) {
+	v, err := ec.GetString(key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, ErrTypeMismatch
+	}
+	return i, nil
+}
+
+// GetObj get value by given key and decode it into result
+// if non-existed or expired, return ErrNotFound
+func (ec *EncryptedRedisCache) GetObj(key string, result interface{}) error {
+	var sealed []byte
+	if err := ec.RedisCache.GetObj(key, &sealed); err != nil {
+		return err
+	}
+	plaintext, err := ec.keyring.Decrypt(sealed, []byte(key))
+	if err != nil {
+		return err
+	}
+	return ec.decode(plaintext, result)
+}
+
+// GetJsonObj get obj with SetJsonObj key
+func (ec *EncryptedRedisCache) GetJsonObj(key string, result interface{}) error {
+	return ec.GetObj(key, result)
+}
+
+// Set encrypts value and stores it by given key
+func (ec *EncryptedRedisCache) Set(key string, value interface{}, ttl int64) error {
+	sealed, err := ec.seal(value, key)
+	if err != nil {
+		return err
+	}
+	return ec.RedisCache.Set(key, sealed, ttl)
+}
+
+// MGet returns decrypted bytes of keys, keys which non-existed or expired are not in the returned map
+func (ec *EncryptedRedisCache) MGet(keys ...string) (map[string]interface{}, error) {
+	items, err := ec.RedisCache.MGet(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return ec.openItems(items)
+}
+
+// GetOrLoad returns decrypted bytes by given key, on a miss it calls loader, encrypts its value and stores it with ttl.
+// concurrent misses of the same key wait for one loader call, the loaded value is returned like Get, as its plaintext bytes.
+// the distributed mode of SetLoadLock is not used, it would store the value of loader unencrypted.
+func (ec *EncryptedRedisCache) GetOrLoad(key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	return ec.getOrLoad(key, ttl, loader, ec.Get, ec.RedisCache.Set)
+}
+
+// SubscribeCtx is Subscribe of the wrapped cache bounded by ctx, messages are not encrypted.
+// if the wrapped cache has no SubscribeCtx, it is Subscribe, which returns only when the connection fails.
+func (ec *EncryptedRedisCache) SubscribeCtx(ctx context.Context, receive chan redis.Message, channels ...interface{}) error {
+	if subscriber, ok := ec.RedisCache.(ctxSubscriber); ok {
+		return subscriber.SubscribeCtx(ctx, receive, channels...)
+	}
+	return ec.RedisCache.Subscribe(receive, channels...)
+}
+
+// SetWithSoftTTL encrypts value and stores it by given key with a soft ttl
+func (ec *EncryptedRedisCache) SetWithSoftTTL(key string, value interface{}, softTTL int64, ttl int64) error {
+	sealed, err := ec.seal(value, key)
+	if err != nil {
+		return err
+	}
+	return ec.RedisCache.SetWithSoftTTL(key, sealed, softTTL, ttl)
+}
+
+// SetLoader set the loader which refreshes values set by SetWithSoftTTL, the values of loader are encrypted
+func (ec *EncryptedRedisCache) SetLoader(loader func(key string) (interface{}, error)) {
+	if loader == nil {
+		ec.RedisCache.SetLoader(nil)
+		return
+	}
+	ec.RedisCache.SetLoader(func(key string) (interface{}, error) {
+		v, err := loader(key)
+		if err != nil || v == nil {
+			return v, err
+		}
+		return ec.seal(v, key)
+	})
+}
+
+// MSet encrypts values and stores all items
+func (ec *EncryptedRedisCache) MSet(items map[string]interface{}, ttl int64) error {
+	sealed, err := ec.sealItems(items)
+	if err != nil {
+		return err
+	}
+	return ec.RedisCache.MSet(sealed, ttl)
+}
+
+// SetJsonObj encodes val with the codec, encrypts it and stores it by given key
+func (ec *EncryptedRedisCache) SetJsonObj(key string, val interface{}) (interface{}, error) {
+	sealed, err := ec.seal(val, key)
+	if err != nil {
+		return nil, err
+	}
+	return "OK", ec.RedisCache.Set(key, sealed, 0)
+}
+
+// HGet returns decrypted value of field in the hash stored at key
+func (ec *EncryptedRedisCache) HGet(hashID string, field string) (string, error) {
+	reply, err := ec.RedisCache.HGet(hashID, field)
+	if err != nil || reply == "" {
+		return reply, err
+	}
+	return ec.openString(reply, hashAAD(hashID, field))
+}
+
+// HGetObj get field value stored by HSet and decode it into result
+func (ec *EncryptedRedisCache) HGetObj(hashID string, field string, result interface{}) error {
+	var sealed []byte
+	if err := ec.RedisCache.HGetObj(hashID, field, &sealed); err != nil {
+		return err
+	}
+	plaintext, err := ec.keyring.Decrypt(sealed, []byte(hashAAD(hashID, field)))
+	if err != nil {
+		return err
+	}
+	return ec.decode(plaintext, result)
+}
+
+// HMGet returns decrypted values of fields in the hash stored at key, missing fields are ""
+func (ec *EncryptedRedisCache) HMGet(hashID string, field ...interface{}) ([]string, error) {
+	reply, err := ec.RedisCache.HMGet(hashID, field...)
+	if err != nil {
+		return reply, err
+	}
+	for i, v := range reply {
+		if v == "" || i >= len(field) {
+			continue
+		}
+		if reply[i], err = ec.openString(v, hashAAD(hashID, fmt.Sprint(field[i]))); err != nil {
+			return nil, err
+		}
+	}
+	return reply, nil
+}
+
+// HGetAll returns all fields and decrypted values of the hash stored at key
+func (ec *EncryptedRedisCache) HGetAll(hashID string) (map[string]string, error) {
+	reply, err := ec.RedisCache.HGetAll(hashID)
+	if err != nil {
+		return reply, err
+	}
+	for field, v := range reply {
+		if reply[field], err = ec.openString(v, hashAAD(hashID, field)); err != nil {
+			return nil, err
+		}
+	}
+	return reply, nil
+}
+
+// HVals returns all decrypted values of the hash stored at key
+func (ec *EncryptedRedisCache) HVals(hashID string) ([]string, error) {
+	all, err := ec.HGetAll(hashID)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, 0, len(all))
+	for _, v := range all {
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// HSet encrypts val and sets it to field in the hash stored at key
+func (ec *EncryptedRedisCache) HSet(hashID string, field string, val interface{}) error {
+	sealed, err := ec.seal(val, hashAAD(hashID, field))
+	if err != nil {
+		return err
+	}
+	return ec.RedisCache.HSet(hashID, field, sealed)
+}
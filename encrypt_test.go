@@ -0,0 +1,90 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyring_Rotation(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 16)
+	old, err := NewKeyring(1, map[uint32][]byte{1: oldKey})
+	if err != nil {
+		t.Fatal("TestKeyring_Rotation NewKeyring error", err)
+	}
+	sealed, _ := old.Encrypt([]byte("token"), []byte("key"))
+
+	rotated, _ := NewKeyring(2, map[uint32][]byte{1: oldKey, 2: newKey})
+	if plaintext, err := rotated.Decrypt(sealed, []byte("key")); err != nil || string(plaintext) != "token" {
+		t.Error("TestKeyring_Rotation expect token by old key, got", string(plaintext), err)
+	}
+	sealed, _ = rotated.Encrypt([]byte("token"), []byte("key"))
+	if _, err := old.Decrypt(sealed, []byte("key")); err != ErrUnknownKeyID {
+		t.Error("TestKeyring_Rotation expect ErrUnknownKeyID, got", err)
+	}
+	if _, err := NewKeyring(3, map[uint32][]byte{1: oldKey}); err != ErrUnknownKeyID {
+		t.Error("TestKeyring_Rotation missing primary expect ErrUnknownKeyID, got", err)
+	}
+	if _, err := NewKeyring(1, map[uint32][]byte{1: []byte("short")}); err == nil {
+		t.Error("TestKeyring_Rotation invalid key size expect error")
+	}
+}
+
+func TestEncryptedCache_Runtime(t *testing.T) {
+	keyring, _ := NewKeyring(1, map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32)})
+	c := NewRuntimeCache()
+	ec := NewEncryptedCache(c, keyring)
+
+	ec.Set("user", typedUser{Name: "devfeel", Age: 10}, 0)
+	var user typedUser
+	if err := ec.GetObj("user", &user); err != nil || user.Name != "devfeel" || user.Age != 10 {
+		t.Error("TestEncryptedCache_Runtime expect devfeel 10, got", user, err)
+	}
+	raw, _ := c.Get("user")
+	if bytes.Contains(raw.([]byte), []byte("devfeel")) {
+		t.Error("TestEncryptedCache_Runtime value should be encrypted")
+	}
+
+	ec.Set("count", 10, 0)
+	if v, err := ec.GetInt("count"); err != nil || v != 10 {
+		t.Error("TestEncryptedCache_Runtime GetInt expect 10, got", v, err)
+	}
+	if v, err := ec.GetString("none"); err != nil || v != "" {
+		t.Error("TestEncryptedCache_Runtime GetString none expect empty, got", v, err)
+	}
+	if err := ec.GetObj("none", &user); err != ErrNotFound {
+		t.Error("TestEncryptedCache_Runtime GetObj none expect ErrNotFound, got", err)
+	}
+
+	// a value moved to another key fails to authenticate
+	c.Set("copy", raw, 0)
+	if _, err := ec.Get("copy"); err != ErrAuthFailed {
+		t.Error("TestEncryptedCache_Runtime copied value expect ErrAuthFailed, got", err)
+	}
+	tampered := append([]byte(nil), raw.([]byte)...)
+	tampered[len(tampered)-1] ^= 1
+	c.Set("user", tampered, 0)
+	if _, err := ec.GetString("user"); err != ErrAuthFailed {
+		t.Error("TestEncryptedCache_Runtime tampered value expect ErrAuthFailed, got", err)
+	}
+	c.Set("plain", "devfeel", 0)
+	if _, err := ec.Get("plain"); err != ErrAuthFailed {
+		t.Error("TestEncryptedCache_Runtime plain value expect ErrAuthFailed, got", err)
+	}
+}
+
+func TestEncryptedCache_GetOrLoad(t *testing.T) {
+	keyring, _ := NewKeyring(1, map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32)})
+	ec := NewEncryptedCache(NewRuntimeCache(), keyring)
+	loader := func() (interface{}, error) {
+		return 42, nil
+	}
+	miss, err := ec.GetOrLoad("answer", 0, loader)
+	if b, ok := miss.([]byte); err != nil || !ok || string(b) != "42" {
+		t.Errorf("TestEncryptedCache_GetOrLoad miss expect []byte 42, got %T %v %v", miss, miss, err)
+	}
+	hit, err := ec.GetOrLoad("answer", 0, loader)
+	if b, ok := hit.([]byte); err != nil || !ok || string(b) != "42" {
+		t.Errorf("TestEncryptedCache_GetOrLoad hit expect []byte 42, got %T %v %v", hit, hit, err)
+	}
+}
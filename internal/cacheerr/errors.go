@@ -0,0 +1,14 @@
+// Package cacheerr holds the errors shared by all cache backends,
+// they are re-exported by the cache, runtime and redis packages so callers can compare them with ==.
+package cacheerr
+
+import "errors"
+
+var (
+	// ErrNotFound is returned by getters in strict mode when the key does not exist or is expired
+	ErrNotFound = errors.New("cache: key not found")
+	// ErrOverflow is returned when an increment or decrement would overflow the value type
+	ErrOverflow = errors.New("increment or decrement would overflow")
+	// ErrTypeMismatch is returned when the stored value is not of the type required by the operation
+	ErrTypeMismatch = errors.New("value type mismatch")
+)
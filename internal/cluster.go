@@ -0,0 +1,500 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+const (
+	// SlotCount Redis Cluster 的哈希槽数量
+	SlotCount = 16384
+	// 单条命令最多跟随的MOVED/ASK重定向次数
+	maxRedirects = 5
+	// 两次后台Reload的最小间隔
+	reloadInterval = time.Second
+)
+
+var (
+	// ErrCrossSlot 多key命令的key不在同一个哈希槽, 与服务端返回的错误相同, 在管道中作为该命令的结果返回
+	ErrCrossSlot = redis.Error("CROSSSLOT Keys in request don't hash to the same slot")
+	// ErrNoClusterNode 集群的所有节点均不可用
+	ErrNoClusterNode = errors.New("cache: no reachable cluster node")
+)
+
+// Cluster Redis Cluster 客户端, 维护哈希槽到主节点的映射, 每个节点使用一个RedisClient连接池
+type Cluster struct {
+	template  url.URL  // 种子节点的url, 替换Host后作为各节点的url
+	seeds     []string // 种子节点的地址, host:port
+	maxIdle   int
+	maxActive int
+
+	mu     sync.RWMutex
+	slots  [SlotCount]string       // 各哈希槽所在主节点的地址, 未知时为""
+	nodes  map[string]*RedisClient // 地址到节点RedisClient, 由RetainRedisClient获取, Close时释放
+	closed bool
+
+	reloading int32
+}
+
+// NewCluster 使用种子节点创建Cluster, 并通过CLUSTER SLOTS加载哈希槽映射
+// serverUrls: 部分或全部节点的连接字符串, like "redis://:password@10.0.1.11:7000/0", 各节点使用相同的密码
+func NewCluster(serverUrls []string, maxIdle, maxActive int) (*Cluster, error) {
+	if len(serverUrls) == 0 {
+		return nil, ErrNoClusterNode
+	}
+	c := &Cluster{maxIdle: maxIdle, maxActive: maxActive, nodes: make(map[string]*RedisClient)}
+	for i, serverUrl := range serverUrls {
+		u, err := url.Parse(serverUrl)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			c.template = *u
+		}
+		c.seeds = append(c.seeds, u.Host)
+	}
+	if err := c.Reload(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Client 返回按key路由到各节点的RedisClient
+func (c *Cluster) Client() *RedisClient {
+	return &RedisClient{Address: "cluster", cluster: c}
+}
+
+// Reload 依次向已知节点发送CLUSTER SLOTS, 使用第一个成功的结果更新哈希槽映射
+func (c *Cluster) Reload() error {
+	c.mu.RLock()
+	if c.closed {
+		c.mu.RUnlock()
+		return ErrNoClusterNode
+	}
+	addrs := append([]string(nil), c.seeds...)
+	for addr := range c.nodes {
+		addrs = append(addrs, addr)
+	}
+	c.mu.RUnlock()
+	err := ErrNoClusterNode
+	tried := make(map[string]bool)
+	for _, addr := range addrs {
+		if tried[addr] {
+			continue
+		}
+		tried[addr] = true
+		var reply []interface{}
+		if reply, err = redis.Values(c.node(addr).do("CLUSTER", "SLOTS")); err != nil {
+			continue
+		}
+		var slots [SlotCount]string
+		if err = parseClusterSlots(reply, addr, &slots); err != nil {
+			continue
+		}
+		c.mu.Lock()
+		c.slots = slots
+		c.mu.Unlock()
+		return nil
+	}
+	return err
+}
+
+// reloadAsync 在后台执行Reload, 同一时间最多执行一个, 间隔至少reloadInterval
+func (c *Cluster) reloadAsync() {
+	if !atomic.CompareAndSwapInt32(&c.reloading, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&c.reloading, 0)
+		c.Reload()
+		time.Sleep(reloadInterval)
+	}()
+}
+
+// Close 释放所有节点的连接池
+func (c *Cluster) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	for addr := range c.nodes {
+		if e := ReleaseRedisClient(c.url(addr)); e != nil && err == nil {
+			err = e
+		}
+	}
+	c.nodes = make(map[string]*RedisClient)
+	c.closed = true
+	return err
+}
+
+// Masters 返回持有哈希槽的所有主节点
+func (c *Cluster) Masters() []*RedisClient {
+	c.mu.RLock()
+	seen := make(map[string]bool)
+	var addrs []string
+	for _, addr := range c.slots {
+		if addr != "" && !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+	}
+	c.mu.RUnlock()
+	nodes := make([]*RedisClient, len(addrs))
+	for i, addr := range addrs {
+		nodes[i] = c.node(addr)
+	}
+	return nodes
+}
+
+// Node 返回keys所在哈希槽的节点, keys为空时返回任意节点, keys不在同一哈希槽时返回ErrCrossSlot
+func (c *Cluster) Node(keys ...interface{}) (*RedisClient, error) {
+	slot, err := keysSlot(keys)
+	if err != nil {
+		return nil, err
+	}
+	return c.node(c.addrBySlot(slot)), nil
+}
+
+// node 返回指定地址的节点RedisClient, 第一次使用时获取其连接池
+func (c *Cluster) node(addr string) *RedisClient {
+	c.mu.RLock()
+	rc, ok := c.nodes[addr]
+	c.mu.RUnlock()
+	if ok {
+		return rc
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if rc, ok = c.nodes[addr]; ok {
+		return rc
+	}
+	if c.closed {
+		// Close之后不再持有连接池, 也不创建新的连接池
+		return closedRedisClient(c.url(addr))
+	}
+	rc = RetainRedisClient(c.url(addr), c.maxIdle, c.maxActive)
+	c.nodes[addr] = rc
+	return rc
+}
+
+// addrBySlot 返回哈希槽所在节点的地址, slot < 0 或未知时返回任意节点的地址
+func (c *Cluster) addrBySlot(slot int) string {
+	c.mu.RLock()
+	addr := ""
+	if slot >= 0 {
+		addr = c.slots[slot]
+	}
+	if addr == "" {
+		if slot >= 0 {
+			c.reloadAsync()
+		}
+		// 从随机哈希槽开始查找, 避免无key命令都发往同一节点
+		start := rand.Intn(SlotCount)
+		for i := 0; i < SlotCount && addr == ""; i += 128 {
+			addr = c.slots[(start+i)%SlotCount]
+		}
+		if addr == "" {
+			addr = c.seeds[0]
+		}
+	}
+	c.mu.RUnlock()
+	return addr
+}
+
+// url 返回节点地址对应的连接字符串
+func (c *Cluster) url(addr string) string {
+	u := c.template
+	u.Host = addr
+	return u.String()
+}
+
+// run 将keys所在哈希槽的节点传给f执行, 并跟随f返回的MOVED/ASK重定向
+// keys为空时发往任意节点, keys不在同一哈希槽时返回ErrCrossSlot
+// asking为true时f需要在同一连接上先发送ASKING
+func (c *Cluster) run(keys []interface{}, f func(node *RedisClient, asking bool) (interface{}, error)) (interface{}, error) {
+	slot, err := keysSlot(keys)
+	if err != nil {
+		return nil, err
+	}
+	addr := c.addrBySlot(slot)
+	asking := false
+	for i := 0; ; i++ {
+		reply, err := f(c.node(addr), asking)
+		e, ok := err.(redis.Error)
+		if !ok {
+			if err != nil && err != context.Canceled && !isTimeout(err) {
+				// 节点可能已下线, 由其他节点的CLUSTER SLOTS确认
+				c.reloadAsync()
+			}
+			return reply, err
+		}
+		kind, redirectSlot, redirectAddr, ok := parseRedirect(e, addr)
+		if !ok || i >= maxRedirects {
+			return reply, err
+		}
+		addr = redirectAddr
+		if kind == "MOVED" {
+			// 迁移已完成, 先更新该哈希槽, 其余哈希槽由Reload更新
+			c.mu.Lock()
+			c.slots[redirectSlot] = addr
+			c.mu.Unlock()
+			c.reloadAsync()
+		}
+		asking = kind == "ASK"
+	}
+}
+
+// do 执行命令, 按命令的key路由并跟随重定向, 使用rc的ctx
+func (c *Cluster) do(rc *RedisClient, commandName string, args ...interface{}) (interface{}, error) {
+	return c.run(commandKeys(commandName, args), func(node *RedisClient, asking bool) (interface{}, error) {
+		node = node.withContextOf(rc)
+		if asking {
+			return node.doAsking(commandName, args...)
+		}
+		return node.do(commandName, args...)
+	})
+}
+
+// pipeline 按节点分组发送cmds, 每个节点一次往返, 重定向的命令再单独执行, 使用rc的ctx
+// 不同节点的命令之间不保证执行顺序
+func (c *Cluster) pipeline(rc *RedisClient, cmds []Command) ([]interface{}, error) {
+	replies := make([]interface{}, len(cmds))
+	var order []string
+	groups := make(map[string][]int)
+	for i, cmd := range cmds {
+		slot, err := keysSlot(commandKeys(cmd.Name, cmd.Args))
+		if err != nil {
+			replies[i] = err
+			continue
+		}
+		addr := c.addrBySlot(slot)
+		if _, ok := groups[addr]; !ok {
+			order = append(order, addr)
+		}
+		groups[addr] = append(groups[addr], i)
+	}
+	for _, addr := range order {
+		indexes := groups[addr]
+		group := make([]Command, len(indexes))
+		for j, i := range indexes {
+			group[j] = cmds[i]
+		}
+		groupReplies, err := c.node(addr).withContextOf(rc).Pipeline(group...)
+		if err != nil {
+			c.reloadAsync()
+			return nil, err
+		}
+		for j, i := range indexes {
+			replies[i] = groupReplies[j]
+			e, ok := groupReplies[j].(redis.Error)
+			if !ok {
+				continue
+			}
+			if _, _, _, ok := parseRedirect(e, addr); !ok {
+				continue
+			}
+			reply, err := c.do(rc, cmds[i].Name, cmds[i].Args...)
+			if e, ok := err.(redis.Error); ok {
+				replies[i] = e
+			} else if err != nil {
+				return nil, err
+			} else {
+				replies[i] = reply
+			}
+		}
+	}
+	return replies, nil
+}
+
+// KeySlot 返回key的哈希槽, key包含非空的{hashtag}时只计算hashtag
+func KeySlot(key string) int {
+	return int(crc16(HashTag(key)) % SlotCount)
+}
+
+// HashTag 返回key中第一个非空的{hashtag}, 没有时返回key
+func HashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+// keysSlot 返回keys共同的哈希槽, keys为空时返回-1, 不在同一哈希槽时返回ErrCrossSlot
+func keysSlot(keys []interface{}) (int, error) {
+	slot := -1
+	for _, key := range keys {
+		s := KeySlot(KeyString(key))
+		if slot >= 0 && s != slot {
+			return -1, ErrCrossSlot
+		}
+		slot = s
+	}
+	return slot, nil
+}
+
+// groupBySlot 按哈希槽对keys分组, 返回各组key的下标, 组的顺序为第一个key出现的顺序
+func groupBySlot(keys []interface{}) [][]int {
+	var groups [][]int
+	index := make(map[int]int)
+	for i, key := range keys {
+		slot := KeySlot(KeyString(key))
+		g, ok := index[slot]
+		if !ok {
+			g = len(groups)
+			index[slot] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
+	}
+	return groups
+}
+
+// KeyString 返回命令参数中key的字符串形式
+func KeyString(key interface{}) string {
+	switch k := key.(type) {
+	case string:
+		return k
+	case []byte:
+		return string(k)
+	default:
+		return fmt.Sprint(k)
+	}
+}
+
+// CommandKeys 返回命令参数中的key
+func CommandKeys(commandName string, args []interface{}) []string {
+	keys := commandKeys(commandName, args)
+	res := make([]string, len(keys))
+	for i, key := range keys {
+		res[i] = KeyString(key)
+	}
+	return res
+}
+
+// commandKeys 返回命令参数中的key
+func commandKeys(commandName string, args []interface{}) []interface{} {
+	switch strings.ToUpper(commandName) {
+	case "PING", "DBSIZE", "FLUSHDB", "FLUSHALL", "PUBLISH", "INFO", "CLUSTER", "ASKING", "MULTI", "EXEC", "DISCARD", "UNWATCH":
+		return nil
+	case "MGET", "DEL", "UNLINK", "EXISTS", "TOUCH", "WATCH",
+		"SINTER", "SDIFF", "SUNION", "SINTERSTORE", "SDIFFSTORE", "SUNIONSTORE",
+		"RPOPLPUSH":
+		return args
+	case "BLPOP", "BRPOP":
+		// 最后一个参数为超时
+		if len(args) > 1 {
+			return args[:len(args)-1]
+		}
+		return args
+	case "MSET", "MSETNX":
+		keys := make([]interface{}, 0, len(args)/2)
+		for i := 0; i < len(args); i += 2 {
+			keys = append(keys, args[i])
+		}
+		return keys
+	case "SMOVE", "BRPOPLPUSH":
+		if len(args) >= 2 {
+			return args[:2]
+		}
+		return args
+	case "EVAL", "EVALSHA":
+		if len(args) < 2 {
+			return nil
+		}
+		n, err := strconv.Atoi(KeyString(args[1]))
+		if err != nil || n < 0 || 2+n > len(args) {
+			return nil
+		}
+		return args[2 : 2+n]
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args[:1]
+}
+
+// parseRedirect 解析"MOVED 3999 127.0.0.1:6381"或"ASK 3999 127.0.0.1:6381", 地址没有host时使用from的host
+func parseRedirect(e redis.Error, from string) (kind string, slot int, addr string, ok bool) {
+	fields := strings.Fields(string(e))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return "", 0, "", false
+	}
+	slot, err := strconv.Atoi(fields[1])
+	if err != nil || slot < 0 || slot >= SlotCount {
+		return "", 0, "", false
+	}
+	addr = fields[2]
+	if strings.HasPrefix(addr, ":") {
+		addr = hostOf(from) + addr
+	}
+	return fields[0], slot, addr, true
+}
+
+// parseClusterSlots 解析CLUSTER SLOTS的结果: [[start, end, [ip, port, id], [replica]...]...]
+// ip为空时使用from的host
+func parseClusterSlots(reply []interface{}, from string, slots *[SlotCount]string) error {
+	for _, v := range reply {
+		r, err := redis.Values(v, nil)
+		if err != nil || len(r) < 3 {
+			return errors.New("cache: invalid CLUSTER SLOTS reply")
+		}
+		start, err1 := redis.Int(r[0], nil)
+		end, err2 := redis.Int(r[1], nil)
+		master, err3 := redis.Values(r[2], nil)
+		if err1 != nil || err2 != nil || err3 != nil || len(master) < 2 || start < 0 || end >= SlotCount {
+			return errors.New("cache: invalid CLUSTER SLOTS reply")
+		}
+		host, _ := redis.String(master[0], nil)
+		port, _ := redis.Int(master[1], nil)
+		if host == "" || host == "?" {
+			host = hostOf(from)
+		}
+		addr := net.JoinHostPort(host, strconv.Itoa(port))
+		for slot := start; slot <= end; slot++ {
+			slots[slot] = addr
+		}
+	}
+	return nil
+}
+
+// hostOf 返回"host:port"中的host
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func isTimeout(err error) bool {
+	e, ok := err.(net.Error)
+	return ok && e.Timeout()
+}
+
+// crc16 CRC16-CCITT (XMODEM), Redis Cluster 使用的哈希算法
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+func TestKeySlot(t *testing.T) {
+	cases := map[string]int{
+		"123456789":     12739,
+		"foo":           12182,
+		"{foo}.bar":     12182,
+		"a{foo}{bar}":   12182,
+		"foo{}{bar}":    KeySlot("foo{}{bar}"),
+		"foo{{bar}}zap": KeySlot("{bar"),
+	}
+	for key, slot := range cases {
+		if s := KeySlot(key); s != slot {
+			t.Error("TestKeySlot error", key, s, slot)
+		}
+	}
+	if KeySlot("foo{}{bar}") == KeySlot("bar") {
+		t.Error("TestKeySlot empty hashtag error")
+	}
+}
+
+func TestKeysSlot(t *testing.T) {
+	if slot, err := keysSlot([]interface{}{"{user1}.a", []byte("{user1}.b")}); err != nil || slot != KeySlot("user1") {
+		t.Error("TestKeysSlot same slot error", slot, err)
+	}
+	if _, err := keysSlot([]interface{}{"foo", "bar"}); err != ErrCrossSlot {
+		t.Error("TestKeysSlot cross slot error", err)
+	}
+	if slot, err := keysSlot(nil); err != nil || slot != -1 {
+		t.Error("TestKeysSlot no key error", slot, err)
+	}
+}
+
+func TestCommandKeys(t *testing.T) {
+	cases := []struct {
+		name string
+		args []interface{}
+		keys []interface{}
+	}{
+		{"GET", []interface{}{"k"}, []interface{}{"k"}},
+		{"PING", nil, nil},
+		{"PUBLISH", []interface{}{"channel", "msg"}, nil},
+		{"MGET", []interface{}{"a", "b"}, []interface{}{"a", "b"}},
+		{"MSET", []interface{}{"a", 1, "b", 2}, []interface{}{"a", "b"}},
+		{"BLPOP", []interface{}{"a", "b", 600}, []interface{}{"a", "b"}},
+		{"SMOVE", []interface{}{"a", "b", "m"}, []interface{}{"a", "b"}},
+		{"EVAL", []interface{}{"script", 1, "k", "arg"}, []interface{}{"k"}},
+		{"EVAL", []interface{}{"script", 0, "arg"}, []interface{}{}},
+	}
+	for _, c := range cases {
+		if keys := commandKeys(c.name, c.args); len(keys)+len(c.keys) > 0 && !reflect.DeepEqual(keys, c.keys) {
+			t.Error("TestCommandKeys error", c.name, keys, c.keys)
+		}
+	}
+}
+
+func TestGroupBySlot(t *testing.T) {
+	groups := groupBySlot([]interface{}{"{a}1", "foo", "{a}2"})
+	if !reflect.DeepEqual(groups, [][]int{{0, 2}, {1}}) {
+		t.Error("TestGroupBySlot error", groups)
+	}
+}
+
+func TestParseRedirect(t *testing.T) {
+	kind, slot, addr, ok := parseRedirect(redis.Error("MOVED 3999 127.0.0.1:6381"), "127.0.0.1:6379")
+	if !ok || kind != "MOVED" || slot != 3999 || addr != "127.0.0.1:6381" {
+		t.Error("TestParseRedirect MOVED error", kind, slot, addr, ok)
+	}
+	kind, slot, addr, ok = parseRedirect(redis.Error("ASK 3999 :6381"), "10.0.1.11:6379")
+	if !ok || kind != "ASK" || addr != "10.0.1.11:6381" {
+		t.Error("TestParseRedirect ASK error", kind, slot, addr, ok)
+	}
+	if _, _, _, ok = parseRedirect(redis.Error("ERR unknown command"), "10.0.1.11:6379"); ok {
+		t.Error("TestParseRedirect error should not be redirect")
+	}
+}
+
+func TestParseClusterSlots(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{int64(0), int64(8191), []interface{}{[]byte("10.0.1.11"), int64(7000), []byte("id1")}},
+		[]interface{}{int64(8192), int64(16383), []interface{}{[]byte(""), int64(7001), []byte("id2")}},
+	}
+	var slots [SlotCount]string
+	if err := parseClusterSlots(reply, "10.0.1.12:7001", &slots); err != nil {
+		t.Fatal("TestParseClusterSlots error", err)
+	}
+	if slots[0] != "10.0.1.11:7000" || slots[8191] != "10.0.1.11:7000" || slots[16383] != "10.0.1.12:7001" {
+		t.Error("TestParseClusterSlots error", slots[0], slots[8191], slots[16383])
+	}
+}
+
+func TestCluster_NodeAfterClose(t *testing.T) {
+	c := &Cluster{template: url.URL{Scheme: "redis", Path: "/0"}, nodes: make(map[string]*RedisClient)}
+	c.Close()
+	if _, err := c.node("127.0.0.1:7000").Get("key"); err == nil {
+		t.Error("TestCluster_NodeAfterClose expect error of closed pool")
+	}
+	mapMutex.RLock()
+	_, ok := redisMap[c.url("127.0.0.1:7000")]
+	mapMutex.RUnlock()
+	if ok {
+		t.Error("TestCluster_NodeAfterClose should not create a pool after Close")
+	}
+}
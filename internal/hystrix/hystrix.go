@@ -18,6 +18,8 @@ const(
 type Hystrix interface{
 	// Do begin do check
 	Do()
+	// Stop stop all check, it can not be restarted
+	Stop()
 	// RegisterAliveCheck register check Alive func
 	RegisterAliveCheck(CheckFunc)
 	// RegisterHystrixCheck register check Hystrix func
@@ -49,6 +51,11 @@ type StandHystrix struct{
 
 	maxFailedNumber int64
 	counters *sync.Map
+
+	timerLock sync.Mutex
+	stopped bool
+	checkTimer *time.Timer
+	cleanTimer *time.Timer
 }
 
 
@@ -74,6 +81,29 @@ func (h *StandHystrix) Do(){
 	go h.doCleanHistoryCounter()
 }
 
+// Stop stop doCheck and doCleanHistoryCounter, waiting timers are canceled
+func (h *StandHystrix) Stop(){
+	h.timerLock.Lock()
+	defer h.timerLock.Unlock()
+	h.stopped = true
+	if h.checkTimer != nil{
+		h.checkTimer.Stop()
+	}
+	if h.cleanTimer != nil{
+		h.cleanTimer.Stop()
+	}
+}
+
+// afterFunc schedule f after interval seconds, unless Stop was called
+func (h *StandHystrix) afterFunc(timer **time.Timer, interval int, f func()){
+	h.timerLock.Lock()
+	defer h.timerLock.Unlock()
+	if h.stopped{
+		return
+	}
+	*timer = time.AfterFunc(time.Duration(interval)*time.Second, f)
+}
+
 func (h *StandHystrix) SetCheckInterval(hystrixInterval, aliveInterval int){
 	h.checkAliveInterval = aliveInterval
 	h.checkHystrixInterval = hystrixInterval
@@ -130,17 +160,17 @@ func (h *StandHystrix) doCheck(){
 		if isAlive {
 			h.TriggerAlive()
 			h.GetCounter().Clear()
-			time.AfterFunc(time.Duration(h.checkHystrixInterval)*time.Second, h.doCheck)
+			h.afterFunc(&h.checkTimer, h.checkHystrixInterval, h.doCheck)
 		} else {
-			time.AfterFunc(time.Duration(h.checkAliveInterval)*time.Second, h.doCheck)
+			h.afterFunc(&h.checkTimer, h.checkAliveInterval, h.doCheck)
 		}
 	}else{
 		isHystrix := h.checkHystrixFunc()
 		if isHystrix{
 			h.TriggerHystrix()
-			time.AfterFunc(time.Duration(h.checkAliveInterval)*time.Second, h.doCheck)
+			h.afterFunc(&h.checkTimer, h.checkAliveInterval, h.doCheck)
 		}else{
-			time.AfterFunc(time.Duration(h.checkHystrixInterval)*time.Second, h.doCheck)
+			h.afterFunc(&h.checkTimer, h.checkHystrixInterval, h.doCheck)
 		}
 	}
 }
@@ -163,7 +193,7 @@ func (h *StandHystrix) doCleanHistoryCounter(){
 		//fmt.Println(time.Now(), "hystrix doCleanHistoryCounter remove key",k)
 		h.counters.Delete(k)
 	}
-	time.AfterFunc(time.Duration(DefaultCleanHistoryInterval)*time.Second, h.doCleanHistoryCounter)
+	h.afterFunc(&h.cleanTimer, DefaultCleanHistoryInterval, h.doCleanHistoryCounter)
 }
 
 func (h *StandHystrix) defaultCheckHystrix() bool{
@@ -52,6 +52,9 @@ type conn struct {
 
 	// Scratch space for formatting integers and floats.
 	numScratch [40]byte
+
+	// RESP3 push frames read by Do are passed to pushHandler.
+	pushHandler func(Push)
 }
 
 // DialTimeout acts like Dial but takes timeouts for establishing the
@@ -79,6 +82,8 @@ type dialOptions struct {
 	dialTLS      bool
 	skipVerify   bool
 	tlsConfig    *tls.Config
+	protocol     int
+	pushHandler  func(Push)
 }
 
 // DialReadTimeout specifies the timeout for reading a single command reply.
@@ -143,6 +148,24 @@ func DialTLSSkipVerify(skip bool) DialOption {
 	}}
 }
 
+// DialProtocol specifies the protocol version of the connection, 2 or 3.
+// With 3, HELLO 3 is sent after AUTH, replies use the RESP3 types and the
+// server may send push frames, like invalidation messages of CLIENT TRACKING.
+func DialProtocol(protocol int) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.protocol = protocol
+	}}
+}
+
+// DialPushHandler specifies the function called with the RESP3 push frames
+// read by Do. Push frames read by Receive are returned to the caller. Without
+// a handler, push frames read by Do are discarded.
+func DialPushHandler(handler func(Push)) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.pushHandler = handler
+	}}
+}
+
 // Dial connects to the Redis server at the given network and
 // address using the specified options.
 func Dial(network, address string, options ...DialOption) (Conn, error) {
@@ -183,6 +206,7 @@ func Dial(network, address string, options ...DialOption) (Conn, error) {
 		br:           bufio.NewReader(netConn),
 		readTimeout:  do.readTimeout,
 		writeTimeout: do.writeTimeout,
+		pushHandler:  do.pushHandler,
 	}
 
 	if do.password != "" {
@@ -192,6 +216,13 @@ func Dial(network, address string, options ...DialOption) (Conn, error) {
 		}
 	}
 
+	if do.protocol > 2 {
+		if _, err := c.Do("HELLO", do.protocol); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+
 	if do.db != 0 {
 		if _, err := c.Do("SELECT", do.db); err != nil {
 			netConn.Close()
@@ -483,38 +514,151 @@ func (c *conn) readReply() (interface{}, error) {
 	case ':':
 		return parseInt(line[1:])
 	case '$':
+		p, err := c.readBlob(line)
+		if err != nil || p == nil {
+			return nil, err
+		}
+		return p, nil
+	case '*':
 		n, err := parseLen(line[1:])
 		if n < 0 || err != nil {
 			return nil, err
 		}
-		p := make([]byte, n)
-		_, err = io.ReadFull(c.br, p)
+		return c.readArray(n)
+	case '_':
+		// RESP3 null.
+		return nil, nil
+	case '#':
+		// RESP3 boolean, returned as an integer like the RESP2 replies of the
+		// same commands, so Bool and Int work with both protocols.
+		if len(line) != 2 || (line[1] != 't' && line[1] != 'f') {
+			return nil, protocolError("malformed boolean")
+		}
+		if line[1] == 't' {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case ',':
+		// RESP3 double, "inf", "-inf" and "nan" are parsed by ParseFloat.
+		f, err := strconv.ParseFloat(string(line[1:]), 64)
 		if err != nil {
+			return nil, protocolError("malformed double")
+		}
+		return f, nil
+	case '(':
+		// RESP3 big number, returned as its decimal digits.
+		return append([]byte(nil), line[1:]...), nil
+	case '!', '=':
+		// RESP3 blob error and verbatim string.
+		p, err := c.readBlob(line)
+		if err != nil || p == nil {
 			return nil, err
 		}
-		if line, err := c.readLine(); err != nil {
+		if line[0] == '!' {
+			return Error(p), nil
+		}
+		// skip the format, like "txt:"
+		if len(p) < 4 || p[3] != ':' {
+			return nil, protocolError("malformed verbatim string")
+		}
+		return p[4:], nil
+	case '%':
+		// RESP3 map, flattened to key value pairs like the RESP2 replies of
+		// the same commands, so StringMap and ScanStruct work with both protocols.
+		n, err := parseLen(line[1:])
+		if n < 0 || err != nil {
 			return nil, err
-		} else if len(line) != 0 {
-			return nil, protocolError("bad bulk string format")
 		}
-		return p, nil
-	case '*':
+		return c.readArray(2 * n)
+	case '~':
+		// RESP3 set.
 		n, err := parseLen(line[1:])
 		if n < 0 || err != nil {
 			return nil, err
 		}
-		r := make([]interface{}, n)
-		for i := range r {
-			r[i], err = c.readReply()
-			if err != nil {
-				return nil, err
+		return c.readArray(n)
+	case '|':
+		// RESP3 attributes are skipped, the reply follows them.
+		n, err := parseLen(line[1:])
+		if n < 0 || err != nil {
+			return nil, err
+		}
+		if _, err := c.readArray(2 * n); err != nil {
+			return nil, err
+		}
+		return c.readReply()
+	case '>':
+		n, err := parseLen(line[1:])
+		if n < 0 || err != nil {
+			return nil, err
+		}
+		r, err := c.readArray(n)
+		if err != nil {
+			return nil, err
+		}
+		var p Push
+		if len(r) > 0 {
+			kind, ok := r[0].([]byte)
+			if !ok {
+				return nil, protocolError("malformed push")
 			}
+			p.Kind, p.Data = string(kind), r[1:]
 		}
-		return r, nil
+		return p, nil
 	}
 	return nil, protocolError("unexpected response line")
 }
 
+// readArray reads n replies.
+func (c *conn) readArray(n int) ([]interface{}, error) {
+	r := make([]interface{}, n)
+	for i := range r {
+		var err error
+		r[i], err = c.readReply()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// readBlob reads the data of a bulk string whose header is line.
+func (c *conn) readBlob(line []byte) ([]byte, error) {
+	n, err := parseLen(line[1:])
+	if n < 0 || err != nil {
+		return nil, err
+	}
+	p := make([]byte, n)
+	_, err = io.ReadFull(c.br, p)
+	if err != nil {
+		return nil, err
+	}
+	if line, err := c.readLine(); err != nil {
+		return nil, err
+	} else if len(line) != 0 {
+		return nil, protocolError("bad bulk string format")
+	}
+	return p, nil
+}
+
+// readResponse reads a reply, push frames read before it are passed to the
+// push handler.
+func (c *conn) readResponse() (interface{}, error) {
+	for {
+		reply, err := c.readReply()
+		if err != nil {
+			return nil, err
+		}
+		p, ok := reply.(Push)
+		if !ok {
+			return reply, nil
+		}
+		if c.pushHandler != nil {
+			c.pushHandler(p)
+		}
+	}
+}
+
 func (c *conn) Send(cmd string, args ...interface{}) error {
 	c.mu.Lock()
 	c.pending += 1
@@ -551,7 +695,10 @@ func (c *conn) Receive() (reply interface{}, err error) {
 	// negative value.
 	//
 	// The pending field is decremented after the reply is read to handle the
-	// case where Receive is called before Send.
+	// case where Receive is called before Send. Push frames are not replies.
+	if _, ok := reply.(Push); ok {
+		return reply, nil
+	}
 	c.mu.Lock()
 	if c.pending > 0 {
 		c.pending -= 1
@@ -594,7 +741,7 @@ func (c *conn) Do(cmd string, args ...interface{}) (interface{}, error) {
 	if cmd == "" {
 		reply := make([]interface{}, pending)
 		for i := range reply {
-			r, e := c.readReply()
+			r, e := c.readResponse()
 			if e != nil {
 				return nil, c.fatal(e)
 			}
@@ -607,7 +754,7 @@ func (c *conn) Do(cmd string, args ...interface{}) (interface{}, error) {
 	var reply interface{}
 	for i := 0; i <= pending; i++ {
 		var e error
-		if reply, e = c.readReply(); e != nil {
+		if reply, e = c.readResponse(); e != nil {
 			return nil, c.fatal(e)
 		}
 		if e, ok := reply.(Error); ok && err == nil {
@@ -0,0 +1,64 @@
+package redis
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestConn(data string, handler func(Push)) *conn {
+	return &conn{br: bufio.NewReader(strings.NewReader(data)), pushHandler: handler}
+}
+
+func TestReadReply_RESP3(t *testing.T) {
+	tests := []struct {
+		data string
+		want interface{}
+	}{
+		{"_\r\n", nil},
+		{"#t\r\n", int64(1)},
+		{"#f\r\n", int64(0)},
+		{",3.25\r\n", 3.25},
+		{"(3492890328409238509324850943850943825024385\r\n", []byte("3492890328409238509324850943850943825024385")},
+		{"=15\r\ntxt:Some string\r\n", []byte("Some string")},
+		{"!21\r\nSYNTAX invalid syntax\r\n", Error("SYNTAX invalid syntax")},
+		{"%2\r\n+first\r\n:1\r\n$6\r\nsecond\r\n_\r\n", []interface{}{"first", int64(1), []byte("second"), nil}},
+		{"~2\r\n:1\r\n#t\r\n", []interface{}{int64(1), int64(1)}},
+		{"|1\r\n+key-popularity\r\n%1\r\n$1\r\na\r\n,0.1923\r\n:2039123\r\n", int64(2039123)},
+		{">2\r\n$10\r\ninvalidate\r\n*1\r\n$3\r\nfoo\r\n", Push{Kind: "invalidate", Data: []interface{}{[]interface{}{[]byte("foo")}}}},
+		{"$0\r\n\r\n", []byte{}},
+		{"$-1\r\n", nil},
+	}
+	for _, test := range tests {
+		got, err := newTestConn(test.data, nil).readReply()
+		if err != nil || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("TestReadReply_RESP3 %q expect %#v, got %#v %v", test.data, test.want, got, err)
+		}
+	}
+	if f, err := newTestConn(",-inf\r\n", nil).readReply(); err != nil || f.(float64) > 0 {
+		t.Error("TestReadReply_RESP3 -inf error", f, err)
+	}
+	if _, err := newTestConn("#x\r\n", nil).readReply(); err == nil {
+		t.Error("TestReadReply_RESP3 malformed boolean expect error")
+	}
+}
+
+func TestReadResponse_Push(t *testing.T) {
+	var pushes []Push
+	c := newTestConn(">2\r\n$10\r\ninvalidate\r\n_\r\n+OK\r\n", func(p Push) { pushes = append(pushes, p) })
+	reply, err := c.readResponse()
+	if err != nil || reply != okReply {
+		t.Error("TestReadResponse_Push expect OK, got", reply, err)
+	}
+	if len(pushes) != 1 || pushes[0].Kind != "invalidate" || pushes[0].Data[0] != nil {
+		t.Error("TestReadResponse_Push expect invalidate push, got", pushes)
+	}
+
+	// pub/sub notifications of RESP3 are push frames
+	c = newTestConn(">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$5\r\nhello\r\n", nil)
+	m, ok := PubSubConn{Conn: c}.Receive().(Message)
+	if !ok || m.Channel != "ch" || string(m.Data) != "hello" {
+		t.Error("TestReadResponse_Push expect message, got", m)
+	}
+}
@@ -103,7 +103,12 @@ func (c PubSubConn) Ping(data string) error {
 // or error. The return value is intended to be used directly in a type switch
 // as illustrated in the PubSubConn example.
 func (c PubSubConn) Receive() interface{} {
-	reply, err := Values(c.Conn.Receive())
+	r, err := c.Conn.Receive()
+	if p, ok := r.(Push); ok {
+		// RESP3 sends the notifications as push frames.
+		r = append([]interface{}{[]byte(p.Kind)}, p.Data...)
+	}
+	reply, err := Values(r, err)
 	if err != nil {
 		return err
 	}
@@ -19,6 +19,18 @@ type Error string
 
 func (err Error) Error() string { return string(err) }
 
+// Push represents a RESP3 push frame, sent by the server out of band, like
+// the invalidation messages of CLIENT TRACKING or the pub/sub messages of a
+// connection dialed with DialProtocol(3).
+type Push struct {
+
+	// Kind is the first element of the frame, like "invalidate" or "message".
+	Kind string
+
+	// The other elements of the frame.
+	Data []interface{}
+}
+
 // Conn represents a connection to a Redis server.
 type Conn interface {
 	// Close closes the connection.
@@ -119,6 +119,7 @@ func Uint64(reply interface{}, err error) (uint64, error) {
 //
 //  Reply type    Result
 //  bulk string   parsed reply, nil
+//  double        reply, nil
 //  nil           0, ErrNil
 //  other         0, error
 func Float64(reply interface{}, err error) (float64, error) {
@@ -126,6 +127,8 @@ func Float64(reply interface{}, err error) (float64, error) {
 		return 0, err
 	}
 	switch reply := reply.(type) {
+	case float64:
+		return reply, nil
 	case []byte:
 		n, err := strconv.ParseFloat(string(reply), 64)
 		return n, err
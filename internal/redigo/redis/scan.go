@@ -183,6 +183,23 @@ func convertAssign(d interface{}, s interface{}) (err error) {
 				err = convertAssignInt(d.Elem(), s)
 			}
 		}
+	case float64:
+		switch d := d.(type) {
+		case *float64:
+			*d = s
+		case *interface{}:
+			*d = s
+		case nil:
+			// skip value
+		default:
+			if d := reflect.ValueOf(d); d.Type().Kind() != reflect.Ptr {
+				err = cannotConvert(d, s)
+			} else if k := d.Elem().Kind(); k == reflect.Float32 || k == reflect.Float64 {
+				d.Elem().SetFloat(s)
+			} else {
+				err = cannotConvert(d.Elem(), s)
+			}
+		}
 	case string:
 		switch d := d.(type) {
 		case *string:
@@ -2,14 +2,22 @@
 package internal
 
 import (
+	"context"
 	"encoding/json"
 	"github.com/garyburd/redigo/redis"
 	"sync"
+	"time"
 )
 
 type RedisClient struct {
 	pool    *redis.Pool
 	Address string
+	// refs 由 RetainRedisClient 增加, ReleaseRedisClient 减少
+	refs int
+	// ctx 由 WithContext 设置, 为nil时命令不受超时控制
+	ctx context.Context
+	// cluster 由 Cluster.Client 设置, 不为nil时命令按key路由到集群节点, pool为nil
+	cluster *Cluster
 }
 
 var OnConnError func()
@@ -21,6 +29,10 @@ var (
 
 const (
 	defaultTimeout = 60 * 10 //默认10分钟
+	// 设置ctx时阻塞命令每次最多阻塞的秒数, ctx的取消最迟在此时间后生效
+	blockingPollTimeout = 1
+	// 命令读取超时相对ctx截止时间的余量
+	contextTimeoutMargin = 100 * time.Millisecond
 )
 
 func init() {
@@ -42,6 +54,7 @@ func newPool(redisURL string, maxIdle, maxActive int) *redis.Pool {
 }
 
 //获取指定Address及连接池设置的RedisClient
+//不增加引用计数, Address被ReleaseRedisClient释放后会创建新的连接池, 缓存应持有RetainRedisClient返回的RedisClient
 func GetRedisClient(address string, maxIdle int, maxActive int) *RedisClient {
 	var redis *RedisClient
 	var mok bool
@@ -49,21 +62,89 @@ func GetRedisClient(address string, maxIdle int, maxActive int) *RedisClient {
 	redis, mok = redisMap[address]
 	mapMutex.RUnlock()
 	if !mok {
-		redis = &RedisClient{Address: address, pool: newPool(address, maxIdle, maxActive)}
 		mapMutex.Lock()
-		redisMap[address] = redis
+		// 再次检查, 避免覆盖其他goroutine已创建的RedisClient
+		if redis, mok = redisMap[address]; !mok {
+			redis = &RedisClient{Address: address, pool: newPool(address, maxIdle, maxActive)}
+			redisMap[address] = redis
+		}
 		mapMutex.Unlock()
 	}
 	return redis
 }
 
+//获取指定Address的RedisClient并增加引用计数, 使用完毕后需调用ReleaseRedisClient
+func RetainRedisClient(address string, maxIdle int, maxActive int) *RedisClient {
+	mapMutex.Lock()
+	defer mapMutex.Unlock()
+	redis, mok := redisMap[address]
+	if !mok {
+		redis = &RedisClient{Address: address, pool: newPool(address, maxIdle, maxActive)}
+		redisMap[address] = redis
+	}
+	redis.refs++
+	return redis
+}
+
+//减少指定Address的RedisClient引用计数, 计数归零时关闭连接池并从缓存中移除
+func ReleaseRedisClient(address string) error {
+	mapMutex.Lock()
+	redis, mok := redisMap[address]
+	if !mok || redis.refs <= 0 {
+		mapMutex.Unlock()
+		return nil
+	}
+	redis.refs--
+	if redis.refs > 0 {
+		mapMutex.Unlock()
+		return nil
+	}
+	delete(redisMap, address)
+	mapMutex.Unlock()
+	return redis.pool.Close()
+}
+
+// closedRedisClient 返回连接池已关闭的RedisClient, 其命令均返回连接池已关闭的错误, 用于释放连接池之后的调用
+func closedRedisClient(address string) *RedisClient {
+	pool := newPool(address, 0, 0)
+	pool.Close()
+	return &RedisClient{Address: address, pool: pool}
+}
+
+// WithContext 返回使用ctx的RedisClient副本, 与原RedisClient共享连接池
+// ctx 的截止时间限制等待连接池、建立连接、写入及读取的时间, ctx 取消时命令立即返回
+// ctx 永不结束时(如context.Background())与原RedisClient行为一致
+func (rc *RedisClient) WithContext(ctx context.Context) *RedisClient {
+	if ctx != nil && ctx.Done() == nil {
+		ctx = nil
+	}
+	return &RedisClient{pool: rc.pool, Address: rc.Address, ctx: ctx, cluster: rc.cluster}
+}
+
+// withContextOf 返回使用from的ctx的RedisClient
+func (rc *RedisClient) withContextOf(from *RedisClient) *RedisClient {
+	if from.ctx == nil {
+		return rc
+	}
+	return rc.WithContext(from.ctx)
+}
+
+// Node 返回keys所在的集群节点, 用于需要同一连接的命令, 非集群模式时返回rc
+// keys不在同一哈希槽时返回ErrCrossSlot
+func (rc *RedisClient) Node(keys ...interface{}) (*RedisClient, error) {
+	if rc.cluster == nil {
+		return rc, nil
+	}
+	node, err := rc.cluster.Node(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return node.withContextOf(rc), nil
+}
+
 //获取指定key的内容, interface{}
 func (rc *RedisClient) GetObj(key string) (interface{}, error) {
-	// 从连接池里面获得一个连接
-	conn := rc.pool.Get()
-	// 连接完关闭，其实没有关闭，是放回池里，也就是队列里面，等待下一个重用
-	defer conn.Close()
-	reply, errDo := innerDo(conn, "GET", key)
+	reply, errDo := rc.do("GET", key)
 	return reply, errDo
 }
 
@@ -75,11 +156,7 @@ func (rc *RedisClient) Get(key string) (string, error) {
 
 //检查指定key是否存在
 func (rc *RedisClient) Exists(key string) (bool, error) {
-	// 从连接池里面获得一个连接
-	conn := rc.pool.Get()
-	// 连接完关闭，其实没有关闭，是放回池里，也就是队列里面，等待下一个重用
-	defer conn.Close()
-	reply, errDo := innerDo(conn, "EXISTS", key)
+	reply, errDo := rc.do("EXISTS", key)
 	if errDo == nil && reply == nil {
 		return false, nil
 	}
@@ -87,13 +164,20 @@ func (rc *RedisClient) Exists(key string) (bool, error) {
 	return val > 0, err
 }
 
-//删除指定key
+//删除指定key, 集群模式时按哈希槽拆分
 func (rc *RedisClient) Del(key ...interface{}) (int, error) {
-	// 从连接池里面获得一个连接
-	conn := rc.pool.Get()
-	// 连接完关闭，其实没有关闭，是放回池里，也就是队列里面，等待下一个重用
-	defer conn.Close()
-	reply, errDo := conn.Do("DEL", key...)
+	if rc.cluster != nil && len(key) > 1 {
+		count := 0
+		for _, group := range groupBySlot(key) {
+			n, err := rc.Del(pick(key, group)...)
+			if err != nil {
+				return count, err
+			}
+			count += n
+		}
+		return count, nil
+	}
+	reply, errDo := rc.do("DEL", key...)
 	if errDo == nil && reply == nil {
 		return 0, nil
 	}
@@ -103,9 +187,7 @@ func (rc *RedisClient) Del(key ...interface{}) (int, error) {
 
 //对存储在指定key的数值执行原子的加1操作
 func (rc *RedisClient) INCR(key string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	reply, errDo := innerDo(conn, "INCR", key)
+	reply, errDo := rc.do("INCR", key)
 	if errDo == nil && reply == nil {
 		return 0, nil
 	}
@@ -115,9 +197,7 @@ func (rc *RedisClient) INCR(key string) (int, error) {
 
 //对存储在指定key的数值执行原子的减1操作
 func (rc *RedisClient) DECR(key string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	reply, errDo := innerDo(conn, "DECR", key)
+	reply, errDo := rc.do("DECR", key)
 	if errDo == nil && reply == nil {
 		return 0, nil
 	}
@@ -125,37 +205,111 @@ func (rc *RedisClient) DECR(key string) (int, error) {
 	return val, err
 }
 
+// IncrBy 将 key 所储存的值加上增量 increment
+func (rc *RedisClient) IncrBy(key string, increment int64) (int64, error) {
+	val, err := redis.Int64(rc.do("INCRBY", key, increment))
+	return val, err
+}
+
+// DecrBy 将 key 所储存的值减去减量 decrement
+func (rc *RedisClient) DecrBy(key string, decrement int64) (int64, error) {
+	val, err := redis.Int64(rc.do("DECRBY", key, decrement))
+	return val, err
+}
+
+// IncrByFloat 为 key 中所储存的值加上浮点数增量 increment
+func (rc *RedisClient) IncrByFloat(key string, increment float64) (float64, error) {
+	val, err := redis.Float64(rc.do("INCRBYFLOAT", key, increment))
+	return val, err
+}
+
 func (rc *RedisClient) Set(key string, val interface{}) (interface{}, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := innerDo(conn, "SET", key, val)
+	val, err := rc.do("SET", key, val)
 	return val, err
 }
 
 // SetWithExpire 设置指定key的内容
 func (rc *RedisClient) SetWithExpire(key string, val interface{}, timeOutSeconds int64) (interface{}, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := innerDo(conn, "SET", key, val, "EX", timeOutSeconds)
+	val, err := rc.do("SET", key, val, "EX", timeOutSeconds)
 	return val, err
 }
 
 // SetNX  将 key 的值设为 value ，当且仅当 key 不存在。
 // 若给定的 key 已经存在，则 SETNX 不做任何动作。 成功返回1, 失败返回0
 func (rc *RedisClient) SetNX(key, value string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-
-	val, err := redis.Int(innerDo(conn, "SETNX", key, value))
+	val, err := redis.Int(rc.do("SETNX", key, value))
 	return val, err
 }
 
+// SetNXWithExpire 当且仅当 key 不存在时设置key的内容及过期时间, 过期时间精确到毫秒
+// 设置成功返回true, key 已经存在返回false
+func (rc *RedisClient) SetNXWithExpire(key string, val interface{}, timeOut time.Duration) (bool, error) {
+	_, err := redis.String(rc.do("SET", key, val, "PX", int64(timeOut/time.Millisecond), "NX"))
+	if err == redis.ErrNil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // Expire 设置指定key的过期时间
 func (rc *RedisClient) Expire(key string, timeOutSeconds int) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Int(innerDo(conn, "EXPIRE", key, timeOutSeconds))
-	return val, err
+	val, err := redis.Int(rc.do("EXPIRE", key, timeOutSeconds))
+	return val, err
+}
+
+// MGet 返回所有指定key的值, 不存在的key对应nil, 集群模式时按哈希槽拆分
+func (rc *RedisClient) MGet(key ...interface{}) ([]interface{}, error) {
+	if rc.cluster != nil && len(key) > 1 {
+		vals := make([]interface{}, len(key))
+		for _, group := range groupBySlot(key) {
+			groupVals, err := rc.MGet(pick(key, group)...)
+			if err != nil {
+				return nil, err
+			}
+			for j, i := range group {
+				vals[i] = groupVals[j]
+			}
+		}
+		return vals, nil
+	}
+	val, err := redis.Values(rc.do("MGET", key...))
+	return val, err
+}
+
+// MSetWithExpire 使用MSET设置多个key的内容, timeOutSeconds > 0 时在同一管道中为每个key执行EXPIRE
+// keyValues 为 key1, value1, key2, value2 ..., 集群模式时按哈希槽拆分为多个MSET
+func (rc *RedisClient) MSetWithExpire(timeOutSeconds int64, keyValues ...interface{}) error {
+	var cmds []Command
+	if rc.cluster != nil {
+		keys := make([]interface{}, 0, len(keyValues)/2)
+		for i := 0; i < len(keyValues); i += 2 {
+			keys = append(keys, keyValues[i])
+		}
+		for _, group := range groupBySlot(keys) {
+			args := make([]interface{}, 0, len(group)*2)
+			for _, i := range group {
+				args = append(args, keyValues[2*i], keyValues[2*i+1])
+			}
+			cmds = append(cmds, Command{Name: "MSET", Args: args})
+		}
+	} else {
+		cmds = []Command{{Name: "MSET", Args: keyValues}}
+	}
+	if timeOutSeconds > 0 {
+		for i := 0; i < len(keyValues); i += 2 {
+			cmds = append(cmds, Command{Name: "EXPIRE", Args: []interface{}{keyValues[i], timeOutSeconds}})
+		}
+	}
+	replies, err := rc.Pipeline(cmds...)
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if err, ok := reply.(error); ok {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetJsonObj get obj with SetJsonObj key
@@ -170,39 +324,40 @@ func (rc *RedisClient) GetJsonObj(key string, result interface{}) error {
 
 // SetJsonObj set obj use json encode string
 func (rc *RedisClient) SetJsonObj(key string, val interface{}) (interface{}, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	jsonStr, err := json.Marshal(val)
 	if err != nil {
 		return nil, err
 	}
-	reply, err := redis.String(innerDo(conn, "SET", key, jsonStr))
+	reply, err := redis.String(rc.do("SET", key, jsonStr))
 	return reply, err
 }
 
-//删除当前数据库里面的所有数据
+//删除当前数据库里面的所有数据, 集群模式时删除所有主节点的数据
 //这个命令永远不会出现失败
-func (rc *RedisClient) FlushDB() {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	conn.Do("FLUSHALL")
+func (rc *RedisClient) FlushDB() error {
+	if rc.cluster != nil {
+		for _, node := range rc.cluster.Masters() {
+			if err := node.withContextOf(rc).FlushDB(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	_, err := rc.do("FLUSHALL")
+	return err
 }
 
 //****************** hash 哈希表 ***********************
 
 //获取指定hashset的所有内容
 func (rc *RedisClient) HGetAll(hashID string) (map[string]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	reply, err := redis.StringMap(innerDo(conn, "HGETALL", hashID))
+	reply, err := redis.StringMap(rc.do("HGETALL", hashID))
 	return reply, err
 }
 
 //获取指定hashset的内容
 func (rc *RedisClient) HGet(hashID string, field string) (string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	reply, errDo := conn.Do("HGET", hashID, field)
+	reply, errDo := rc.do("HGET", hashID, field)
 	if errDo == nil && reply == nil {
 		return "", nil
 	}
@@ -210,78 +365,63 @@ func (rc *RedisClient) HGet(hashID string, field string) (string, error) {
 	return val, err
 }
 
+// HGetObj 获取指定hashset的内容, interface{}, 不存在时返回nil
+func (rc *RedisClient) HGetObj(hashID string, field string) (interface{}, error) {
+	return rc.do("HGET", hashID, field)
+}
+
 // HMGet 返回 key 指定的哈希集中指定字段的值
 func (rc *RedisClient) HMGet(hashID string, field ...interface{}) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{hashID}, field...)
-	reply, err := redis.Strings(innerDo(conn, "HMGET", args...))
+	reply, err := redis.Strings(rc.do("HMGET", args...))
 	return reply, err
 }
 
 //设置指定hashset的内容
-func (rc *RedisClient) HSet(hashID string, field string, val string) error {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	_, err := innerDo(conn, "HSET", hashID, field, val)
+func (rc *RedisClient) HSet(hashID string, field string, val interface{}) error {
+	_, err := rc.do("HSET", hashID, field, val)
 	return err
 }
 
 func (rc *RedisClient) HSetNX(hashID string, field string, val string) (string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	reply, err := redis.String(innerDo(conn, "HSETNX", hashID, field, val))
+	reply, err := redis.String(rc.do("HSETNX", hashID, field, val))
 	return reply, err
 }
 
 func (rc *RedisClient) HDel(key string, field ...interface{}) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, field...)
-	val, err := redis.Int(innerDo(conn, "HDEL", args...))
+	val, err := redis.Int(rc.do("HDEL", args...))
 	return val, err
 }
 
 func (rc *RedisClient) HExist(key string, field string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Int(innerDo(conn, "HEXISTS", key, field))
+	val, err := redis.Int(rc.do("HEXISTS", key, field))
 	return val, err
 }
 func (rc *RedisClient) HIncrBy(key string, field string, increment int) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Int(innerDo(conn, "HINCRBY", key, field, increment))
+	val, err := redis.Int(rc.do("HINCRBY", key, field, increment))
 	return val, err
 }
 
 func (rc *RedisClient) HIncrByFloat(key string, field string, increment float64) (float64, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Float64(innerDo(conn, "HINCRBYFLOAT", key, field, increment))
+	val, err := redis.Float64(rc.do("HINCRBYFLOAT", key, field, increment))
 	return val, err
 }
 
 func (rc *RedisClient) HKeys(key string) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Strings(innerDo(conn, "HKEYS", key))
+	val, err := redis.Strings(rc.do("HKEYS", key))
 	return val, err
 }
 
 // HLen 返回哈希表 key 中域的数量, 当 key 不存在时，返回0
 func (rc *RedisClient) HLen(key string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Int(innerDo(conn, "HLEN", key))
+	val, err := redis.Int(rc.do("HLEN", key))
 	return val, err
 }
 
 // HVals 返回哈希表 key 中所有域的值, 当 key 不存在时，返回空
 func (rc *RedisClient) HVals(key string) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Strings(innerDo(conn, "HVALS", key))
+	val, err := redis.Strings(rc.do("HVALS", key))
 	return val, err
 }
 
@@ -289,9 +429,8 @@ func (rc *RedisClient) HVals(key string) ([]string, error) {
 
 //将所有指定的值插入到存于 key 的列表的头部
 func (rc *RedisClient) LPush(key string, value ...interface{}) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	ret, err := redis.Int(innerDo(conn, "LPUSH", key, value))
+	args := append([]interface{}{key}, value...)
+	ret, err := redis.Int(rc.do("LPUSH", args...))
 	if err != nil {
 		return -1, err
 	} else {
@@ -300,124 +439,90 @@ func (rc *RedisClient) LPush(key string, value ...interface{}) (int, error) {
 }
 
 func (rc *RedisClient) LPushX(key string, value string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	resp, err := redis.Int(innerDo(conn, "LPUSHX", key, value))
+	resp, err := redis.Int(rc.do("LPUSHX", key, value))
 	return resp, err
 }
 
 func (rc *RedisClient) LRange(key string, start int, stop int) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	resp, err := redis.Strings(innerDo(conn, "LRANGE", key, start, stop))
+	resp, err := redis.Strings(rc.do("LRANGE", key, start, stop))
 	return resp, err
 }
 
 func (rc *RedisClient) LRem(key string, count int, value string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	resp, err := redis.Int(innerDo(conn, "LREM", key, count, value))
+	resp, err := redis.Int(rc.do("LREM", key, count, value))
 	return resp, err
 }
 
 func (rc *RedisClient) LSet(key string, index int, value string) (string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	resp, err := redis.String(innerDo(conn, "LSET", key, index, value))
+	resp, err := redis.String(rc.do("LSET", key, index, value))
 	return resp, err
 }
 
 func (rc *RedisClient) LTrim(key string, start int, stop int) (string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	resp, err := redis.String(innerDo(conn, "LTRIM", key, start, stop))
+	resp, err := redis.String(rc.do("LTRIM", key, start, stop))
 	return resp, err
 }
 
 func (rc *RedisClient) RPop(key string) (string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	resp, err := redis.String(innerDo(conn, "RPOP", key))
+	resp, err := redis.String(rc.do("RPOP", key))
 	return resp, err
 }
 
 func (rc *RedisClient) RPush(key string, value ...interface{}) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, value...)
-	resp, err := redis.Int(innerDo(conn, "RPUSH", args...))
+	resp, err := redis.Int(rc.do("RPUSH", args...))
 	return resp, err
 }
 
 func (rc *RedisClient) RPushX(key string, value ...interface{}) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, value...)
-	resp, err := redis.Int(innerDo(conn, "RPUSHX", args...))
+	resp, err := redis.Int(rc.do("RPUSHX", args...))
 	return resp, err
 }
 
 func (rc *RedisClient) RPopLPush(source string, destination string) (string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	resp, err := redis.String(innerDo(conn, "RPOPLPUSH", source, destination))
+	resp, err := redis.String(rc.do("RPOPLPUSH", source, destination))
 	return resp, err
 }
 
 func (rc *RedisClient) BLPop(key ...interface{}) (map[string]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.StringMap(innerDo(conn, "BLPOP", key, defaultTimeout))
+	val, err := redis.StringMap(rc.doBlocking("BLPOP", key...))
 	return val, err
 }
 
 //删除，并获得该列表中的最后一个元素，或阻塞，直到有一个可用
 func (rc *RedisClient) BRPop(key ...interface{}) (map[string]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.StringMap(innerDo(conn, "BRPOP", key, defaultTimeout))
+	val, err := redis.StringMap(rc.doBlocking("BRPOP", key...))
 	return val, err
 }
 
 func (rc *RedisClient) BRPopLPush(source string, destination string) (string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.String(innerDo(conn, "BRPOPLPUSH", source, destination))
+	val, err := redis.String(rc.doBlocking("BRPOPLPUSH", source, destination))
 	return val, err
 }
 
 func (rc *RedisClient) LIndex(key string, index int) (string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.String(innerDo(conn, "LINDEX", key, index))
+	val, err := redis.String(rc.do("LINDEX", key, index))
 	return val, err
 }
 
 func (rc *RedisClient) LInsertBefore(key string, pivot string, value string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Int(innerDo(conn, "LINSERT", key, "BEFORE", pivot, value))
+	val, err := redis.Int(rc.do("LINSERT", key, "BEFORE", pivot, value))
 	return val, err
 }
 
 func (rc *RedisClient) LInsertAfter(key string, pivot string, value string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Int(innerDo(conn, "LINSERT", key, "AFTER", pivot, value))
+	val, err := redis.Int(rc.do("LINSERT", key, "AFTER", pivot, value))
 	return val, err
 }
 
 func (rc *RedisClient) LLen(key string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Int(innerDo(conn, "LLEN", key))
+	val, err := redis.Int(rc.do("LLEN", key))
 	return val, err
 }
 
 func (rc *RedisClient) LPop(key string) (string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.String(innerDo(conn, "LPOP", key))
+	val, err := redis.String(rc.do("LPOP", key))
 	return val, err
 }
 
@@ -426,10 +531,8 @@ func (rc *RedisClient) LPop(key string) (string, error) {
 // SAdd 将一个或多个 member 元素加入到集合 key 当中，已经存在于集合的 member 元素将被忽略。
 // 假如 key 不存在，则创建一个只包含 member 元素作成员的集合。
 func (rc *RedisClient) SAdd(key string, member ...interface{}) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, member...)
-	val, err := redis.Int(innerDo(conn, "SADD", args...))
+	val, err := redis.Int(rc.do("SADD", args...))
 	return val, err
 }
 
@@ -438,9 +541,7 @@ func (rc *RedisClient) SAdd(key string, member ...interface{}) (int, error) {
 // 集合的基数。
 // 当 key 不存在时，返回 0
 func (rc *RedisClient) SCard(key string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Int(innerDo(conn, "SCARD", key))
+	val, err := redis.Int(rc.do("SCARD", key))
 	return val, err
 }
 
@@ -448,9 +549,7 @@ func (rc *RedisClient) SCard(key string) (int, error) {
 // 如果只想获取一个随机元素，但不想该元素从集合中被移除的话，可以使用 SRANDMEMBER 命令。
 // count 为 返回的随机元素的数量
 func (rc *RedisClient) SPop(key string) (string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.String(innerDo(conn, "SPOP", key))
+	val, err := redis.String(rc.do("SPOP", key))
 	return val, err
 }
 
@@ -458,9 +557,7 @@ func (rc *RedisClient) SPop(key string) (string, error) {
 // 该操作和 SPOP 相似，但 SPOP 将随机元素从集合中移除并返回，而 SRANDMEMBER 则仅仅返回随机元素，而不对集合进行任何改动。
 // count 为 返回的随机元素的数量
 func (rc *RedisClient) SRandMember(key string, count int) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Strings(innerDo(conn, "SRANDMEMBER", key, count))
+	val, err := redis.Strings(rc.do("SRANDMEMBER", key, count))
 	return val, err
 }
 
@@ -468,77 +565,57 @@ func (rc *RedisClient) SRandMember(key string, count int) ([]string, error) {
 // 当 key 不是集合类型，返回一个错误。
 // 在 Redis 2.4 版本以前， SREM 只接受单个 member 值。
 func (rc *RedisClient) SRem(key string, member ...interface{}) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, member...)
-	val, err := redis.Int(innerDo(conn, "SREM", args...))
+	val, err := redis.Int(rc.do("SREM", args...))
 	return val, err
 }
 
 func (rc *RedisClient) SDiff(key ...interface{}) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Strings(innerDo(conn, "SDIFF", key...))
+	val, err := redis.Strings(rc.do("SDIFF", key...))
 	return val, err
 }
 
 func (rc *RedisClient) SDiffStore(destination string, key ...interface{}) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{destination}, key...)
-	val, err := redis.Int(innerDo(conn, "SDIFFSTORE", args...))
+	val, err := redis.Int(rc.do("SDIFFSTORE", args...))
 	return val, err
 }
 
 func (rc *RedisClient) SInter(key ...interface{}) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Strings(innerDo(conn, "SINTER", key...))
+	val, err := redis.Strings(rc.do("SINTER", key...))
 	return val, err
 }
 
 func (rc *RedisClient) SInterStore(destination string, key ...interface{}) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{destination}, key...)
-	val, err := redis.Int(innerDo(conn, "SINTERSTORE", args...))
+	val, err := redis.Int(rc.do("SINTERSTORE", args...))
 	return val, err
 }
 
 func (rc *RedisClient) SIsMember(key string, member string) (bool, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Bool(innerDo(conn, "SISMEMBER", key, member))
+	val, err := redis.Bool(rc.do("SISMEMBER", key, member))
 	return val, err
 }
 
 func (rc *RedisClient) SMembers(key string) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Strings(innerDo(conn, "SMEMBERS", key))
+	val, err := redis.Strings(rc.do("SMEMBERS", key))
 	return val, err
 }
 
 // smove is a atomic operate
 func (rc *RedisClient) SMove(source string, destination string, member string) (bool, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Bool(innerDo(conn, "SMOVE", source, destination, member))
+	val, err := redis.Bool(rc.do("SMOVE", source, destination, member))
 	return val, err
 }
 
 func (rc *RedisClient) SUnion(key ...interface{}) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Strings(innerDo(conn, "SUNION", key...))
+	val, err := redis.Strings(rc.do("SUNION", key...))
 	return val, err
 }
 
 func (rc *RedisClient) SUnionStore(destination string, key ...interface{}) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{destination}, key...)
-	val, err := redis.Int(innerDo(conn, "SUNIONSTORE", args))
+	val, err := redis.Int(rc.do("SUNIONSTORE", args))
 	return val, err
 }
 
@@ -547,89 +624,71 @@ func (rc *RedisClient) SUnionStore(destination string, key ...interface{}) (int,
 // ZAdd 将所有指定成员添加到键为key有序集合（sorted set）里面。 添加时可以指定多个分数/成员（score/member）对。
 // 如果指定添加的成员已经是有序集合里面的成员，则会更新改成员的分数（scrore）并更新到正确的排序位置
 func (rc *RedisClient) ZAdd(key string, score int64, member interface{}) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, score, member)
-	val, err := redis.Int(innerDo(conn, "ZADD", args...))
+	val, err := redis.Int(rc.do("ZADD", args...))
 	return val, err
 }
 
 // ZCount 返回有序集key中，score值在min和max之间(默认包括score值等于min或max)的成员
 func (rc *RedisClient) ZCount(key string, min, max int64) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, min, max)
-	val, err := redis.Int(innerDo(conn, "ZCOUNT", args...))
+	val, err := redis.Int(rc.do("ZCOUNT", args...))
 	return val, err
 }
 
 // ZRem 从排序的集合中删除一个或多个成员
 // 当key存在，但是其不是有序集合类型，就返回一个错误。
 func (rc *RedisClient) ZRem(key string, member ...interface{}) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, member...)
-	val, err := redis.Int(innerDo(conn, "ZREM", args...))
+	val, err := redis.Int(rc.do("ZREM", args...))
 	return val, err
 }
 
 // ZCard 返回key的有序集元素个数
 func (rc *RedisClient) ZCard(key string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key})
-	val, err := redis.Int(innerDo(conn, "ZCARD", args...))
+	val, err := redis.Int(rc.do("ZCARD", args...))
 	return val, err
 }
 
 // ZRank 返回有序集key中成员member的排名
 func (rc *RedisClient) ZRank(key, member string) (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, member)
-	val, err := redis.Int(innerDo(conn, "ZRANK", args...))
+	val, err := redis.Int(rc.do("ZRANK", args...))
 	return val, err
 }
 
 // ZRange Returns the specified range of elements in the sorted set stored at key
 func (rc *RedisClient) ZRange(key string, start, stop int64) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, start, stop)
-	val, err := redis.Strings(innerDo(conn, "ZRANGE", args...))
+	val, err := redis.Strings(rc.do("ZRANGE", args...))
 	return val, err
 }
 
 // ZRangeByScore Returns all the elements in the sorted set at key with a score between min and max (including elements with score equal to min or max).
 func (rc *RedisClient) ZRangeByScore(key string, start, stop string, isWithScores bool) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, start, stop)
 	if isWithScores {
 		args = append(args, "WITHSCORES")
 	}
-	val, err := redis.Strings(innerDo(conn, "ZRANGEBYSCORE", args...))
+	val, err := redis.Strings(rc.do("ZRANGEBYSCORE", args...))
 	return val, err
 }
 
 // ZREVRangeByScore Returns all the elements in the sorted set at key with a score between max and min (including elements with score equal to max or min). In contrary to the default ordering of sorted sets, for this command the elements are considered to be ordered from high to low scores.
 func (rc *RedisClient) ZREVRangeByScore(key string, max, min string, isWithScores bool) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, max, min)
 	if isWithScores {
 		args = append(args, "WITHSCORES")
 	}
-	val, err := redis.Strings(innerDo(conn, "ZREVRANGEBYSCORE", args...))
+	val, err := redis.Strings(rc.do("ZREVRANGEBYSCORE", args...))
 	return val, err
 }
 
 // ZRange Returns the specified range of elements in the sorted set stored at key
 func (rc *RedisClient) ZRevRange(key string, start, stop int64) ([]string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	args := append([]interface{}{key}, start, stop)
-	val, err := redis.Strings(innerDo(conn, "ZREVRANGE", args...))
+	val, err := redis.Strings(rc.do("ZREVRANGE", args...))
 	return val, err
 }
 
@@ -637,19 +696,15 @@ func (rc *RedisClient) ZRevRange(key string, start, stop int64) ([]string, error
 
 // Publish 将信息 message 发送到指定的频道 channel
 func (rc *RedisClient) Publish(channel string, message interface{}) (int64, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	var args []interface{}
 	args = append([]interface{}{channel}, message)
-	val, err := redis.Int64(innerDo(conn, "PUBLISH", args...))
+	val, err := redis.Int64(rc.do("PUBLISH", args...))
 	return val, err
 }
 
 //****************** lua scripts *********************
 // EVAL 使用内置的 Lua 解释器
 func (rc *RedisClient) EVAL(script string, argsNum int, arg ...interface{}) (interface{}, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	var args []interface{}
 	if len(arg) > 0 {
 		args = append([]interface{}{script, argsNum}, arg...)
@@ -657,34 +712,260 @@ func (rc *RedisClient) EVAL(script string, argsNum int, arg ...interface{}) (int
 		args = append([]interface{}{script, argsNum})
 	}
 	args = append([]interface{}{script, argsNum}, arg...)
-	val, err := innerDo(conn, "EVAL", args...)
+	val, err := rc.do("EVAL", args...)
 	return val, err
 }
 
 //****************** 全局操作 ***********************
-// DBSize 返回当前数据库的 key 的数量
+// DBSize 返回当前数据库的 key 的数量, 集群模式时返回所有主节点的总数
 func (rc *RedisClient) DBSize() (int, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
-	val, err := redis.Int(innerDo(conn, "DBSIZE"))
+	if rc.cluster != nil {
+		total := 0
+		for _, node := range rc.cluster.Masters() {
+			n, err := node.withContextOf(rc).DBSize()
+			if err != nil {
+				return total, err
+			}
+			total += n
+		}
+		return total, nil
+	}
+	val, err := redis.Int(rc.do("DBSIZE"))
 	return val, err
 }
 
 // Ping ping command, if success return pong
 func (rc *RedisClient) Ping() (string, error) {
-	conn := rc.pool.Get()
-	defer conn.Close()
 	var args []interface{}
-	val, err := redis.String(innerDo(conn, "PING", args...))
+	val, err := redis.String(rc.do("PING", args...))
 	return val, err
 }
 
-// GetConn 返回一个从连接池获取的redis连接,
+// GetConn 返回一个从连接池获取的redis连接, 集群模式时为任意节点的连接, 指定key时使用Node
 // 需要手动释放redis连接
 func (rc *RedisClient) GetConn() redis.Conn {
+	if rc.cluster != nil {
+		node, _ := rc.cluster.Node()
+		return node.GetConn()
+	}
 	return rc.pool.Get()
 }
 
+// GetConnContext 返回一个从连接池获取的redis连接, 等待连接池及建立连接的时间受ctx控制,
+// 集群模式时为任意节点的连接, 需要手动释放redis连接
+func (rc *RedisClient) GetConnContext(ctx context.Context) (redis.Conn, error) {
+	if rc.cluster != nil {
+		node, _ := rc.cluster.Node()
+		return node.GetConnContext(ctx)
+	}
+	return getConnContext(ctx, rc.pool)
+}
+
+// Command 管道中的一条命令
+type Command struct {
+	Name string
+	Args []interface{}
+}
+
+// Pipeline 使用同一连接一次发送多条命令, 按顺序返回每条命令的结果
+// 单条命令的错误(redis.Error)作为该命令的结果返回, 连接错误时返回err
+// 集群模式时按节点分组发送
+func (rc *RedisClient) Pipeline(cmds ...Command) ([]interface{}, error) {
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	if rc.cluster != nil {
+		return rc.cluster.pipeline(rc, cmds)
+	}
+	if rc.ctx == nil {
+		conn := rc.pool.Get()
+		defer conn.Close()
+		return pipeline(conn, 0, cmds)
+	}
+	reply, err := runContext(rc.ctx, rc.pool, func(conn redis.Conn) (interface{}, error) {
+		return pipeline(conn, contextTimeout(rc.ctx), cmds)
+	})
+	replies, _ := reply.([]interface{})
+	return replies, err
+}
+
+// pipeline 在conn上发送cmds并读取所有结果, timeout为0时使用连接池的读取超时
+func pipeline(conn redis.Conn, timeout time.Duration, cmds []Command) ([]interface{}, error) {
+	for _, cmd := range cmds {
+		if err := conn.Send(cmd.Name, cmd.Args...); err != nil {
+			return nil, err
+		}
+	}
+	if err := conn.Flush(); err != nil {
+		return nil, err
+	}
+	replies := make([]interface{}, len(cmds))
+	for i := range cmds {
+		var reply interface{}
+		var err error
+		if timeout > 0 {
+			reply, err = redis.ReceiveWithTimeout(conn, timeout)
+		} else {
+			reply, err = conn.Receive()
+		}
+		if e, ok := err.(redis.Error); ok {
+			replies[i] = e
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, nil
+}
+
+// do 从连接池获取连接并执行命令, 设置了ctx时由ctx控制超时及取消
+// 集群模式时按key路由到节点并跟随重定向
+func (rc *RedisClient) do(commandName string, args ...interface{}) (interface{}, error) {
+	if rc.cluster != nil {
+		return rc.cluster.do(rc, commandName, args...)
+	}
+	if rc.ctx == nil {
+		conn := rc.pool.Get()
+		defer conn.Close()
+		return innerDo(conn, commandName, args...)
+	}
+	return doContext(rc.ctx, rc.pool, commandName, args...)
+}
+
+// doBlocking 执行BLPOP等阻塞命令, args不包含超时参数
+// 设置了ctx时每次最多阻塞blockingPollTimeout秒, 直到有结果或ctx结束
+// 已发出的命令不会中途放弃, 避免已弹出的元素丢失
+func (rc *RedisClient) doBlocking(commandName string, args ...interface{}) (interface{}, error) {
+	args = args[:len(args):len(args)]
+	if rc.cluster != nil {
+		// args不包含超时参数, 均为key; 阻塞命令不发送ASKING, 迁移中的key返回重定向错误
+		return rc.cluster.run(args, func(node *RedisClient, asking bool) (interface{}, error) {
+			return node.withContextOf(rc).doBlocking(commandName, args...)
+		})
+	}
+	if rc.ctx == nil {
+		return rc.do(commandName, append(args, defaultTimeout)...)
+	}
+	for {
+		if err := rc.ctx.Err(); err != nil {
+			return nil, err
+		}
+		conn, err := getConnContext(rc.ctx, rc.pool)
+		if err != nil {
+			return nil, err
+		}
+		reply, err := redis.DoWithTimeout(conn, (blockingPollTimeout+5)*time.Second, commandName, append(args, blockingPollTimeout)...)
+		conn.Close()
+		if err != nil || reply != nil {
+			return reply, err
+		}
+	}
+}
+
+// doAsking 在同一连接上发送ASKING及命令, 用于集群的ASK重定向
+func (rc *RedisClient) doAsking(commandName string, args ...interface{}) (interface{}, error) {
+	replies, err := rc.Pipeline(Command{Name: "ASKING"}, Command{Name: commandName, Args: args})
+	if err != nil {
+		return nil, err
+	}
+	if e, ok := replies[1].(redis.Error); ok {
+		return nil, e
+	}
+	return replies[1], nil
+}
+
+// pick 返回keys中下标为indexes的key
+func pick(keys []interface{}, indexes []int) []interface{} {
+	picked := make([]interface{}, len(indexes))
+	for j, i := range indexes {
+		picked[j] = keys[i]
+	}
+	return picked
+}
+
+// getConnContext 从连接池获取连接, 等待连接池及建立连接的时间受ctx控制
+func getConnContext(ctx context.Context, pool *redis.Pool) (redis.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	type result struct {
+		conn redis.Conn
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		conn, err := pool.GetContext(ctx)
+		ch <- result{conn, err}
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return r.conn, r.err
+	case <-ctx.Done():
+		// 连接建立后放回连接池
+		go func() {
+			if r := <-ch; r.err == nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// doContext 执行命令, 等待连接池、建立连接、写入及读取的时间受ctx控制
+func doContext(ctx context.Context, pool *redis.Pool, commandName string, args ...interface{}) (interface{}, error) {
+	return runContext(ctx, pool, func(conn redis.Conn) (interface{}, error) {
+		return redis.DoWithTimeout(conn, contextTimeout(ctx), commandName, args...)
+	})
+}
+
+// runContext 从连接池获取连接并执行f, 等待连接池、建立连接及f的执行时间受ctx控制
+// f 需要使用contextTimeout(ctx)作为读取超时
+func runContext(ctx context.Context, pool *redis.Pool, f func(conn redis.Conn) (interface{}, error)) (interface{}, error) {
+	conn, err := getConnContext(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	type result struct {
+		reply interface{}
+		err   error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		// 超时或取消后连接在命令完成时放回连接池, 读取超时保证其最终完成
+		defer conn.Close()
+		reply, err := f(conn)
+		ch <- result{reply, err}
+	}()
+	select {
+	case r := <-ch:
+		if r.err != nil && ctx.Err() != nil {
+			// 读取超时与ctx截止同时发生
+			return nil, ctx.Err()
+		}
+		return r.reply, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// contextTimeout 返回ctx剩余的时间加上contextTimeoutMargin, 没有截止时间时返回0表示不超时
+// 读取超时略晚于ctx截止, 调用方总是得到ctx.Err(), 读取超时只用于结束后台的命令
+func contextTimeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	if timeout := time.Until(deadline); timeout > 0 {
+		return timeout + contextTimeoutMargin
+	}
+	return contextTimeoutMargin
+}
+
 // Do sends a command to the server and returns the received reply.
 func innerDo(conn redis.Conn, commandName string, args ...interface{}) (interface{}, error) {
 	reply, err := conn.Do(commandName, args...)
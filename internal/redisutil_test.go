@@ -1,9 +1,12 @@
 package internal
 
 import (
-	"testing"
+	"context"
 	"fmt"
+	"net"
 	"reflect"
+	"testing"
+	"time"
 )
 
 var rc *RedisClient
@@ -57,4 +60,50 @@ func TestRedisClient_SDiff(t *testing.T) {
 		fmt.Println(err.Error())
 	}
 	fmt.Println(res, reflect.TypeOf(res))
-}
\ No newline at end of file
+}
+func TestRetainRedisClient_Release(t *testing.T) {
+	address := "redis://127.0.0.1:6379/15"
+	c1 := RetainRedisClient(address, 1, 1)
+	c2 := RetainRedisClient(address, 1, 1)
+	if c1 != c2 {
+		t.Error("TestRetainRedisClient_Release expect same client")
+	}
+	ReleaseRedisClient(address)
+	if GetRedisClient(address, 1, 1) != c1 {
+		t.Error("TestRetainRedisClient_Release client should not be removed while retained")
+	}
+	ReleaseRedisClient(address)
+	if GetRedisClient(address, 1, 1) == c1 {
+		t.Error("TestRetainRedisClient_Release client should be removed after last release")
+	}
+}
+
+func TestRedisClient_WithContext(t *testing.T) {
+	// a server which accepts connections but never replies
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("TestRedisClient_WithContext listen error", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	client := GetRedisClient("redis://"+ln.Addr().String()+"/0", 1, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	begin := time.Now()
+	_, err = client.WithContext(ctx).Get("key")
+	if err != context.DeadlineExceeded {
+		t.Error("TestRedisClient_WithContext expect context.DeadlineExceeded, got", err)
+	}
+	if cost := time.Since(begin); cost > time.Second {
+		t.Error("TestRedisClient_WithContext expect return near deadline, cost", cost)
+	}
+}
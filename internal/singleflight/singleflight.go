@@ -0,0 +1,87 @@
+// Package singleflight collapses concurrent calls with the same key into one,
+// it is used by GetOrLoad of the cache backends so a miss of a hot key calls the loader once.
+package singleflight
+
+import (
+	"fmt"
+	"sync"
+)
+
+type call struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// Group runs one call of a key at a time, the zero value is ready to use.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Do runs fn and returns its results, callers of the same key while fn runs wait for it and share its results.
+// if fn panics, the waiting callers get an error and the panic goes on in the caller running fn.
+func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err
+	}
+	c := g.add(key)
+	g.mu.Unlock()
+	g.run(key, c, fn, true)
+	return c.val, c.err
+}
+
+// Go runs fn in a new goroutine and returns true, unless a call of key is running, it returns false then.
+// callers of Do with the same key while fn runs wait for it and share its results, like a call of Do.
+// if fn panics, the panic is recovered, the waiting callers get an error.
+func (g *Group) Go(key string, fn func() (interface{}, error)) bool {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if _, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		return false
+	}
+	c := g.add(key)
+	g.mu.Unlock()
+	go g.run(key, c, fn, false)
+	return true
+}
+
+// add registers a call of key, the caller must hold mu
+func (g *Group) add(key string) *call {
+	c := new(call)
+	c.wg.Add(1)
+	g.calls[key] = c
+	return c
+}
+
+// run calls fn for c, a panic of fn is recorded as the error of c, and goes on if repanic is true
+func (g *Group) run(key string, c *call, fn func() (interface{}, error), repanic bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("cache: load of %q panicked: %v", key, r)
+			g.done(key, c)
+			if repanic {
+				panic(r)
+			}
+			return
+		}
+		g.done(key, c)
+	}()
+	c.val, c.err = fn()
+}
+
+func (g *Group) done(key string, c *call) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	c.wg.Done()
+}
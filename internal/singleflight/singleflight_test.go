@@ -0,0 +1,112 @@
+package singleflight
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroup_Do(t *testing.T) {
+	var g Group
+	var calls int32
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			v, err := g.Do("key", func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(50 * time.Millisecond)
+				return "value", nil
+			})
+			if err != nil || v != "value" {
+				t.Error("TestGroup_Do expect value, got", v, err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	if calls != 1 {
+		t.Error("TestGroup_Do expect 1 call, got", calls)
+	}
+
+	// calls after the first one returned run again
+	v, _ := g.Do("key", func() (interface{}, error) { return "again", nil })
+	if v != "again" {
+		t.Error("TestGroup_Do expect again, got", v)
+	}
+}
+
+func TestGroup_Panic(t *testing.T) {
+	var g Group
+	running, release := make(chan struct{}), make(chan struct{})
+	waited := make(chan error)
+	go func() {
+		defer func() { recover() }()
+		g.Do("key", func() (interface{}, error) {
+			close(running)
+			<-release
+			panic("boom")
+		})
+	}()
+	<-running
+	go func() {
+		_, err := g.Do("key", func() (interface{}, error) { return nil, nil })
+		waited <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	if err := <-waited; err == nil {
+		t.Error("TestGroup_Panic waiting caller expect error")
+	}
+}
+
+func TestGroup_Go(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	if !g.Go("key", func() (interface{}, error) {
+		<-release
+		return "value", nil
+	}) {
+		t.Error("TestGroup_Go expect first call started")
+	}
+	if g.Go("key", func() (interface{}, error) { return "second", nil }) {
+		t.Error("TestGroup_Go expect second call refused while the first runs")
+	}
+	waited := make(chan interface{})
+	go func() {
+		v, _ := g.Do("key", func() (interface{}, error) { return "do", nil })
+		waited <- v
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if v := <-waited; v != "value" {
+		t.Error("TestGroup_Go Do expect value of the running call, got", v)
+	}
+}
+
+func TestGroup_GoPanic(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	g.Go("key", func() (interface{}, error) {
+		<-release
+		panic("boom")
+	})
+	waited := make(chan error)
+	go func() {
+		_, err := g.Do("key", func() (interface{}, error) { return nil, nil })
+		waited <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	if err := <-waited; err == nil {
+		t.Error("TestGroup_GoPanic waiting caller expect error")
+	}
+	// the process goes on and the key can be loaded again
+	if v, err := g.Do("key", func() (interface{}, error) { return "value", nil }); err != nil || v != "value" {
+		t.Error("TestGroup_GoPanic expect value after panic, got", v, err)
+	}
+}
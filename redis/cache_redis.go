@@ -1,19 +1,34 @@
 package redis
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	"fmt"
+	"github.com/devfeel/cache/codec"
 	"github.com/devfeel/cache/internal" //internal目录 不允许其他包调用, commit时候改回来
+	"github.com/devfeel/cache/internal/cacheerr"
 	"github.com/devfeel/cache/internal/hystrix"
+	"github.com/devfeel/cache/internal/singleflight"
 	"github.com/garyburd/redigo/redis"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
 	ZeroInt64 int64 = 0
 )
 
+var (
+	// ErrNotFound is returned by getters in strict mode when the key does not exist
+	ErrNotFound = cacheerr.ErrNotFound
+	// ErrOverflow is returned by counters when the result overflows
+	ErrOverflow = cacheerr.ErrOverflow
+	// ErrTypeMismatch is returned when the stored value is not of the type required by the operation
+	ErrTypeMismatch = cacheerr.ErrTypeMismatch
+)
+
 const (
 	LInsert_Before    = "BEFORE"
 	LInsert_After     = "AFTER"
@@ -35,6 +50,8 @@ type redisCache struct {
 	hystrix hystrix.Hystrix
 
 	serverUrl string //connection string, like "redis://:password@10.0.1.11:6379/0"
+	// client is retained for serverUrl until Close, nil in sentinel and cluster mode
+	client *internal.RedisClient
 	// Maximum number of idle connections in the pool.
 	maxIdle int
 	// Maximum number of connections allocated by the pool at a given time.
@@ -43,18 +60,52 @@ type redisCache struct {
 
 	//use to readonly server
 	readOnlyServerUrl string
-	readOnlyMaxIdle   int
-	readOnlyMaxActive int
+	readOnlyClient    *internal.RedisClient
 
 	//use to backup server
 	backupServerUrl string
-	backupMaxIdle   int
-	backupMaxActive int
+	backupClient    *internal.RedisClient
+
+	// strict makes getters return ErrNotFound and ErrTypeMismatch
+	strict bool
+	// codec encodes values which are not a string, []byte, number or bool
+	codec codec.Codec
+	// compression is used for values larger than compressThreshold bytes
+	compression       Compression
+	compressThreshold int
+
+	// ctx is only set on the copy returned by withContext
+	ctx context.Context
+	// sentinel is set by NewSentinelRedisCache, it resolves the default server and the replica
+	sentinel *sentinel
+	// cluster is set by NewClusterRedisCache, it routes commands to the node of their keys
+	cluster *internal.Cluster
+	// near is set by NewNearRedisCache, it keeps local copies of values read by GET
+	near *nearCache
+	// loads collapses concurrent loads of GetOrLoad, loadLockTTL enables its distributed mode
+	loads       *singleflight.Group
+	loadLockTTL time.Duration
+	// refreshes runs one refresh of a stale value at a time, apart from loads,
+	// so a load of GetOrLoad never shares the value of a refresh which is not set
+	refreshes *singleflight.Group
+	// loader refreshes values set by SetWithSoftTTL
+	loader func(key string) (interface{}, error)
+
+	closeOnce *sync.Once
 }
 
 // NewRedisCache returns a new *RedisCache.
 func NewRedisCache(serverUrl string, maxIdle int, maxActive int) *redisCache {
-	cache := redisCache{serverUrl: serverUrl, maxIdle: maxIdle, maxActive: maxActive}
+	client := internal.RetainRedisClient(serverUrl, maxIdle, maxActive)
+	return newRedisCache(redisCache{serverUrl: serverUrl, client: client, maxIdle: maxIdle, maxActive: maxActive})
+}
+
+// newRedisCache sets defaults of cache, whose servers are set, and starts hystrix check
+func newRedisCache(cache redisCache) *redisCache {
+	cache.codec = codec.JSONCodec{}
+	cache.closeOnce = new(sync.Once)
+	cache.loads = new(singleflight.Group)
+	cache.refreshes = new(singleflight.Group)
 	cache.hystrix = hystrix.NewHystrix(cache.checkRedisAlive, nil)
 	cache.hystrix.SetMaxFailedNumber(HystrixErrorCount)
 	cache.hystrix.Do()
@@ -63,20 +114,66 @@ func NewRedisCache(serverUrl string, maxIdle int, maxActive int) *redisCache {
 
 // SetReadOnlyServer set readonly redis server
 func (ca *redisCache) SetReadOnlyServer(serverUrl string, maxIdle int, maxActive int) {
+	client := internal.RetainRedisClient(serverUrl, maxIdle, maxActive)
+	if ca.readOnlyServerUrl != "" {
+		internal.ReleaseRedisClient(ca.readOnlyServerUrl)
+	}
 	ca.readOnlyServerUrl = serverUrl
-	ca.readOnlyMaxActive = maxActive
-	ca.readOnlyMaxIdle = maxIdle
+	ca.readOnlyClient = client
 }
 
 // SetBackupServer set backup redis server, only use to read
 func (ca *redisCache) SetBackupServer(serverUrl string, maxIdle int, maxActive int) {
+	client := internal.RetainRedisClient(serverUrl, maxIdle, maxActive)
+	if ca.backupServerUrl != "" {
+		internal.ReleaseRedisClient(ca.backupServerUrl)
+	}
 	ca.backupServerUrl = serverUrl
-	ca.backupMaxActive = maxActive
-	ca.backupMaxIdle = maxIdle
+	ca.backupClient = client
+}
+
+// SetStrictMode set strict mode, default is false.
+// in strict mode, Get, GetString, GetInt, GetInt64 and GetJsonObj return ErrNotFound if key not exists,
+// GetInt and GetInt64 return ErrTypeMismatch if value is not an integer.
+func (ca *redisCache) SetStrictMode(strict bool) {
+	ca.strict = strict
+}
+
+// Close stop hystrix check and close connection pools of default, readonly and backup server.
+// pools shared with other RedisCache of same server url are closed after the last one is closed.
+// the cache must not be used after Close.
+func (ca *redisCache) Close() error {
+	var err error
+	ca.closeOnce.Do(func() {
+		ca.hystrix.Stop()
+		if ca.sentinel != nil {
+			ca.sentinel.close()
+		}
+		if ca.cluster != nil {
+			err = ca.cluster.Close()
+		}
+		if ca.near != nil {
+			ca.near.close()
+		}
+		for _, serverUrl := range []string{ca.serverUrl, ca.readOnlyServerUrl, ca.backupServerUrl} {
+			if serverUrl == "" {
+				continue
+			}
+			if e := internal.ReleaseRedisClient(serverUrl); e != nil && err == nil {
+				err = e
+			}
+		}
+	})
+	return err
 }
 
 // Exists check item exist in redis cache.
 func (ca *redisCache) Exists(key string) (bool, error) {
+	if ca.near != nil {
+		if _, ok := ca.near.get(key); ok {
+			return true, nil
+		}
+	}
 	client := ca.getReadRedisClient()
 	exists, err := client.Exists(key)
 	if ca.checkConnErrorAndNeedRetry(err) {
@@ -90,8 +187,9 @@ func (ca *redisCache) Exists(key string) (bool, error) {
 func (ca *redisCache) Incr(key string) (int64, error) {
 	client := ca.getDefaultRedis()
 	val, err := client.INCR(key)
+	ca.nearEvict(key)
 	if err != nil {
-		return 0, err
+		return 0, convertCounterError(err)
 	}
 	return int64(val), nil
 }
@@ -100,46 +198,77 @@ func (ca *redisCache) Incr(key string) (int64, error) {
 func (ca *redisCache) Decr(key string) (int64, error) {
 	client := ca.getDefaultRedis()
 	val, err := client.DECR(key)
+	ca.nearEvict(key)
 	if err != nil {
-		return 0, err
+		return 0, convertCounterError(err)
 	}
 	return int64(val), nil
 }
 
+// IncrBy increase int64 counter in redis cache by delta.
+// return ErrOverflow if result overflows, ErrTypeMismatch if value is not an integer
+func (ca *redisCache) IncrBy(key string, delta int64) (int64, error) {
+	client := ca.getDefaultRedis()
+	val, err := client.IncrBy(key, delta)
+	ca.nearEvict(key)
+	if err != nil {
+		return 0, convertCounterError(err)
+	}
+	return val, nil
+}
+
+// DecrBy decrease int64 counter in redis cache by delta.
+// return ErrOverflow if result overflows, ErrTypeMismatch if value is not an integer
+func (ca *redisCache) DecrBy(key string, delta int64) (int64, error) {
+	client := ca.getDefaultRedis()
+	val, err := client.DecrBy(key, delta)
+	ca.nearEvict(key)
+	if err != nil {
+		return 0, convertCounterError(err)
+	}
+	return val, nil
+}
+
+// IncrByFloat increase float counter in redis cache by delta.
+// return ErrOverflow if result is NaN or Infinity, ErrTypeMismatch if value is not a number
+func (ca *redisCache) IncrByFloat(key string, delta float64) (float64, error) {
+	client := ca.getDefaultRedis()
+	val, err := client.IncrByFloat(key, delta)
+	ca.nearEvict(key)
+	if err != nil {
+		return 0, convertCounterError(err)
+	}
+	return val, nil
+}
+
 // Get cache from redis cache.
-// if non-existed or expired, return nil.
+// if non-existed or expired, return nil, or ErrNotFound in strict mode.
 func (ca *redisCache) Get(key string) (interface{}, error) {
-	client := ca.getReadRedisClient()
-	reply, err := client.GetObj(key)
-	if ca.checkConnErrorAndNeedRetry(err) {
-		client = ca.getBackupRedis()
-		return client.GetObj(key)
+	reply, err := ca.getReply(key)
+	if ca.strict && err == nil && reply == nil {
+		return nil, ErrNotFound
 	}
-	return reply, err
+	return decompressReply(reply), err
 }
 
 // GetString returns value string format by given key
-// if non-existed or expired, return "".
+// if non-existed or expired, return redis.ErrNil, or ErrNotFound in strict mode.
 func (ca *redisCache) GetString(key string) (string, error) {
-	client := ca.getReadRedisClient()
-	reply, err := client.Get(key)
-	if ca.checkConnErrorAndNeedRetry(err) {
-		client = ca.getBackupRedis()
-		return client.Get(key)
-	}
-	return reply, err
+	reply, err := redis.String(ca.getReply(key))
+	return decompressString(reply), ca.convertNotFoundError(err)
 }
 
 // GetInt returns value int format by given key
 // if non-existed or expired, return nil.
+// in strict mode, return ErrNotFound if non-existed, ErrTypeMismatch if not an integer.
 func (ca *redisCache) GetInt(key string) (int, error) {
 	v, err := ca.GetString(key)
-	if err != nil || v == "" {
+	if err != nil || (v == "" && !ca.strict) {
 		return 0, err
 	} else {
 		i, e := strconv.Atoi(v)
 		if e != nil {
-			return 0, err
+			return 0, ca.convertTypeError(err)
 		} else {
 			return i, nil
 		}
@@ -148,14 +277,15 @@ func (ca *redisCache) GetInt(key string) (int, error) {
 
 // GetInt64 returns value int64 format by given key
 // if non-existed or expired, return nil.
+// in strict mode, return ErrNotFound if non-existed, ErrTypeMismatch if not an integer.
 func (ca *redisCache) GetInt64(key string) (int64, error) {
 	v, err := ca.GetString(key)
-	if err != nil || v == "" {
+	if err != nil || (v == "" && !ca.strict) {
 		return ZeroInt64, err
 	} else {
 		i, e := strconv.ParseInt(v, 10, 64)
 		if e != nil {
-			return ZeroInt64, err
+			return ZeroInt64, ca.convertTypeError(err)
 		} else {
 			return i, nil
 		}
@@ -165,46 +295,131 @@ func (ca *redisCache) GetInt64(key string) (int64, error) {
 // Set cache to redis.
 // ttl is second, if ttl is 0, it will be forever.
 func (ca *redisCache) Set(key string, value interface{}, ttl int64) error {
+	value, err := ca.encode(value)
+	if err != nil {
+		return err
+	}
+	return ca.setValue(key, ca.compress(value), ttl)
+}
+
+// setValue sets the encoded value of key with ttl
+func (ca *redisCache) setValue(key string, value interface{}, ttl int64) error {
 	var err error
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	if ttl > 0 {
 		_, err = client.SetWithExpire(key, value, ttl)
 	} else {
 		_, err = client.Set(key, value)
 	}
+	ca.nearEvict(key)
 	return err
 }
 
 // Delete item in redis cacha.
 // if not exists, we think it's success
 func (ca *redisCache) Delete(key string) error {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	_, err := client.Del(key)
+	ca.nearEvict(key)
 	return err
 }
 
 // Expire Set a timeout on key. After the timeout has expired, the key will automatically be deleted.
 func (ca *redisCache) Expire(key string, timeOutSeconds int) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.Expire(key, timeOutSeconds)
+	ca.nearEvict(key)
 	return reply, err
 }
 
+// MGet returns values of keys with one MGET command,
+// keys which non-existed or expired are not in the returned map.
+func (ca *redisCache) MGet(keys ...string) (map[string]interface{}, error) {
+	items := make(map[string]interface{}, len(keys))
+	if len(keys) == 0 {
+		return items, nil
+	}
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	var reply []interface{}
+	var err error
+	if ca.near != nil {
+		reply, err = ca.nearMGet(keys)
+	} else {
+		client := ca.getReadRedisClient()
+		reply, err = client.MGet(args...)
+		if ca.checkConnErrorAndNeedRetry(err) {
+			client = ca.getBackupRedis()
+			reply, err = client.MGet(args...)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range reply {
+		if v != nil && i < len(keys) {
+			items[keys[i]] = decompressReply(ca.revalidate(keys[i], v))
+		}
+	}
+	return items, nil
+}
+
+// MSet set all items with one MSET command, and a pipelined EXPIRE for each key if ttl > 0.
+// ttl is second, if ttl is 0, it will be forever.
+func (ca *redisCache) MSet(items map[string]interface{}, ttl int64) error {
+	if len(items) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, len(items)*2)
+	for key, value := range items {
+		value, err := ca.encode(value)
+		if err != nil {
+			return err
+		}
+		args = append(args, key, ca.compress(value))
+	}
+	err := ca.getDefaultRedis().MSetWithExpire(ttl, args...)
+	for key := range items {
+		ca.nearEvict(key)
+	}
+	return err
+}
+
+// MDelete delete items by given keys with one DEL command.
+// if not exists, we think it's success
+func (ca *redisCache) MDelete(keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	_, err := ca.getDefaultRedis().Del(args...)
+	ca.nearEvict(keys...)
+	return err
+}
+
 // GetJsonObj get obj with SetJsonObj key
 func (ca *redisCache) GetJsonObj(key string, result interface{}) error {
-	client := ca.getReadRedisClient()
-	err := client.GetJsonObj(key, result)
-	if ca.checkConnErrorAndNeedRetry(err) {
-		client = ca.getBackupRedis()
-		return client.GetJsonObj(key, result)
+	data, err := redis.Bytes(ca.getReply(key))
+	if err != nil {
+		return ca.convertNotFoundError(err)
 	}
-	return err
+	return json.Unmarshal(decompress(data), result)
 }
 
 // SetJsonObj set obj use json encode string
 func (ca *redisCache) SetJsonObj(key string, val interface{}) (interface{}, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
-	reply, err := client.SetJsonObj(key, val)
+	data, err := json.Marshal(val)
+	if err != nil {
+		return nil, err
+	}
+	client := ca.getDefaultRedis()
+	reply, err := redis.String(client.Set(key, ca.compress(data)))
+	ca.nearEvict(key)
 	return reply, err
 }
 
@@ -215,9 +430,9 @@ func (ca *redisCache) HGet(key, field string) (string, error) {
 	reply, err := client.HGet(key, field)
 	if ca.checkConnErrorAndNeedRetry(err) {
 		client = ca.getBackupRedis()
-		return client.HGet(key, field)
+		reply, err = client.HGet(key, field)
 	}
-	return reply, err
+	return decompressString(reply), err
 }
 
 // HMGet Returns the values associated with the specified fields in the hash stored at key.
@@ -226,9 +441,9 @@ func (ca *redisCache) HMGet(hashID string, field ...interface{}) ([]string, erro
 	reply, err := client.HMGet(hashID, field...)
 	if ca.checkConnErrorAndNeedRetry(err) {
 		client = ca.getBackupRedis()
-		return client.HMGet(hashID, field...)
+		reply, err = client.HMGet(hashID, field...)
 	}
-	return reply, err
+	return decompressStrings(reply), err
 }
 
 // HGetAll Returns all fields and values of the hash stored at key
@@ -237,22 +452,25 @@ func (ca *redisCache) HGetAll(key string) (map[string]string, error) {
 	reply, err := client.HGetAll(key)
 	if ca.checkConnErrorAndNeedRetry(err) {
 		client = ca.getBackupRedis()
-		return client.HGetAll(key)
+		reply, err = client.HGetAll(key)
 	}
-	return reply, err
+	return decompressStringMap(reply), err
 }
 
 // HSet Sets field in the hash stored at key to value. If key does not exist, a new key holding a hash is created.
 // If field already exists in the hash, it is overwritten.
-func (ca *redisCache) HSet(key, field, value string) error {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
-	err := client.HSet(key, field, value)
-	return err
+func (ca *redisCache) HSet(key, field string, value interface{}) error {
+	value, err := ca.encode(value)
+	if err != nil {
+		return err
+	}
+	client := ca.getDefaultRedis()
+	return client.HSet(key, field, ca.compress(value))
 }
 
 // HDel Removes the specified fields from the hash stored at key.
 func (ca *redisCache) HDel(key string, field ...interface{}) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.HDel(key, field...)
 	return reply, err
 }
@@ -270,21 +488,21 @@ func (ca *redisCache) HExists(key string, field string) (int, error) {
 
 // HSetNX Sets field in the hash stored at key to value, only if field does not yet exist
 func (ca *redisCache) HSetNX(key string, field string, value string) (string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.HSetNX(key, field, value)
 	return reply, err
 }
 
 // HIncrBy Increments the number stored at field in the hash stored at key by increment.
 func (ca *redisCache) HIncrBy(key string, field string, increment int) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.HIncrBy(key, field, increment)
 	return reply, err
 }
 
 // HIncrByFloat Increment the specified field of a hash stored at key, and representing a floating point number, by the specified increment
 func (ca *redisCache) HIncrByFloat(key string, field string, increment float64) (float64, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.HIncrByFloat(key, field, increment)
 	return reply, err
 }
@@ -317,40 +535,41 @@ func (ca *redisCache) HVals(key string) ([]string, error) {
 	reply, err := client.HVals(key)
 	if ca.checkConnErrorAndNeedRetry(err) {
 		client = ca.getBackupRedis()
-		return client.HVals(key)
+		reply, err = client.HVals(key)
 	}
-	return reply, err
+	return decompressStrings(reply), err
 }
 
 /*---------- List -----------*/
 // BLPop BLPOP is a blocking list pop primitive.
 // It is the blocking version of LPOP because it blocks the connection when there are no elements to pop from any of the given lists
 func (ca *redisCache) BLPop(key ...interface{}) (map[string]string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.BLPop(key...)
-	return reply, err
+	return decompressStringMap(reply), err
 }
 
 // BRPOP is a blocking list pop primitive
 // It is the blocking version of RPOP because it blocks the connection when there are no elements to pop from any of the given lists
 func (ca *redisCache) BRPop(key ...interface{}) (map[string]string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
-	reply, err := client.BRPop(key)
-	return reply, err
+	client := ca.getDefaultRedis()
+	reply, err := client.BRPop(key...)
+	return decompressStringMap(reply), err
 }
 
 // BRPOPLPUSH is a operation like RPOPLPUSH but blocking
 func (ca *redisCache) BRPopLPush(source string, destination string) (string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.BRPopLPush(source, destination)
-	return reply, err
+	return decompressString(reply), err
 }
 
 // LIndex return element which subscript is index,
 // if index is -1, return last one element of list and so on
 func (ca *redisCache) LIndex(key string, index int) (string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
-	return client.LIndex(key, index)
+	client := ca.getDefaultRedis()
+	reply, err := client.LIndex(key, index)
+	return decompressString(reply), err
 }
 
 // LInsert Inserts value in the list stored at key either before or after the reference value pivot.
@@ -358,7 +577,7 @@ func (ca *redisCache) LInsert(key string, direction string, pivot string, value
 	if direction != LInsert_Before && direction != LInsert_After {
 		return -1, errors.New("direction only accept BEFORE or AFTER")
 	}
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	if direction == LInsert_Before {
 		return client.LInsertBefore(key, pivot, value)
 	}
@@ -368,97 +587,114 @@ func (ca *redisCache) LInsert(key string, direction string, pivot string, value
 
 // LLen return length of list
 func (ca *redisCache) LLen(key string) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	return client.LLen(key)
 }
 
 // LPop remove and return head element of list
 func (ca *redisCache) LPop(key string) (string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.LPop(key)
-	return reply, err
+	return decompressString(reply), err
 }
 
 // LPush Insert all the specified values at the head of the list stored at key
 func (ca *redisCache) LPush(key string, value ...interface{}) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
-	reply, err := client.LPush(key, value)
+	value, err := ca.encodeValues(value)
+	if err != nil {
+		return 0, err
+	}
+	client := ca.getDefaultRedis()
+	reply, err := client.LPush(key, ca.compressValues(value)...)
 	return reply, err
 }
 
 // LPushX insert an element at the head of the list
 func (ca *redisCache) LPushX(key string, value string) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.LPushX(key, value)
 	return reply, err
 }
 
 // LRange Returns the specified elements of the list stored at key
 func (ca *redisCache) LRange(key string, start int, stop int) ([]string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
-	return client.LRange(key, start, stop)
+	client := ca.getDefaultRedis()
+	reply, err := client.LRange(key, start, stop)
+	return decompressStrings(reply), err
 }
 
 // LRem Removes the first count occurrences of elements equal to value from the list stored at key.
 func (ca *redisCache) LRem(key string, count int, value string) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.LRem(key, count, value)
 	return reply, err
 }
 
 // LSet Sets the list element at index to value
 func (ca *redisCache) LSet(key string, index int, value string) (string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.LSet(key, index, value)
 	return reply, err
 }
 
 // LTrim Trim an existing list so that it will contain only the specified range of elements specified
 func (ca *redisCache) LTrim(key string, start int, stop int) (string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.LTrim(key, start, stop)
 	return reply, err
 }
 
 // RPop Removes and returns the last element of the list stored at key
 func (ca *redisCache) RPop(key string) (string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.RPop(key)
-	return reply, err
+	return decompressString(reply), err
 }
 
 // RPopLPush Atomically returns and removes the last element (tail) of the list stored at source, and pushes the element at the first element (head) of the list stored at destination
 func (ca *redisCache) RPopLPush(source string, destination string) (string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.RPopLPush(source, destination)
-	return reply, err
+	return decompressString(reply), err
 }
 
 // RPush Insert all the specified values at the tail of the list stored at key.
 func (ca *redisCache) RPush(key string, value ...interface{}) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
-	reply, err := client.RPush(key, value...)
+	value, err := ca.encodeValues(value)
+	if err != nil {
+		return 0, err
+	}
+	client := ca.getDefaultRedis()
+	reply, err := client.RPush(key, ca.compressValues(value)...)
 	return reply, err
 }
 
 // RPushX Inserts value at the tail of the list stored at key, only if key already exists and holds a list
 func (ca *redisCache) RPushX(key string, value ...interface{}) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
-	reply, err := client.RPushX(key, value...)
+	value, err := ca.encodeValues(value)
+	if err != nil {
+		return 0, err
+	}
+	client := ca.getDefaultRedis()
+	reply, err := client.RPushX(key, ca.compressValues(value)...)
 	return reply, err
 }
 
 /*---------- Set -----------*/
 // SAdd Add the specified members to the set stored at key
 func (ca *redisCache) SAdd(key string, member ...interface{}) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
-	reply, err := client.SAdd(key, member)
+	member, err := ca.encodeValues(member)
+	if err != nil {
+		return 0, err
+	}
+	client := ca.getDefaultRedis()
+	reply, err := client.SAdd(key, member...)
 	return reply, err
 }
 
 // SCard Returns the set cardinality (number of elements) of the set stored at key
 func (ca *redisCache) SCard(key string) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.SCard(key)
 	return reply, err
 }
@@ -531,13 +767,13 @@ func (ca *redisCache) SMembers(key string) ([]string, error) {
 
 // SMove Move member from the set at source to the set at destination
 func (ca *redisCache) SMove(source string, destination string, member string) (bool, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	return client.SMove(source, destination, member)
 }
 
 // SPop Removes and returns one or more random elements from the set value store at key.
 func (ca *redisCache) SPop(key string) (string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	return client.SPop(key)
 }
 
@@ -554,7 +790,7 @@ func (ca *redisCache) SRandMember(key string, count int) ([]string, error) {
 
 // SRem Remove the specified members from the set stored at key
 func (ca *redisCache) SRem(key string, member ...interface{}) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	return client.SRem(key, member...)
 }
 
@@ -571,7 +807,7 @@ func (ca *redisCache) SUnion(key ...interface{}) ([]string, error) {
 
 // SUnionStore This command is equal to SUNION, but instead of returning the resulting set, it is stored in destination
 func (ca *redisCache) SUnionStore(destination string, key ...interface{}) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	reply, err := client.SUnionStore(destination, key...)
 	if ca.checkConnErrorAndNeedRetry(err) {
 		client = ca.getBackupRedis()
@@ -583,7 +819,7 @@ func (ca *redisCache) SUnionStore(destination string, key ...interface{}) (int,
 //****************** sorted set 集合 ***********************
 // ZAdd Adds all the specified members with the specified scores to the sorted set stored at key
 func (ca *redisCache) ZAdd(key string, score int64, member interface{}) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	return client.ZAdd(key, score, member)
 }
 
@@ -600,7 +836,7 @@ func (ca *redisCache) ZCount(key string, min, max int64) (int, error) {
 
 // ZRem Removes the specified members from the sorted set stored at key. Non existing members are ignored.
 func (ca *redisCache) ZRem(key string, member ...interface{}) (int, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	return client.ZRem(key, member...)
 }
 
@@ -673,13 +909,14 @@ func (ca *redisCache) ZRevRange(key string, start, stop int64) ([]string, error)
 //****************** PUB/SUB *********************
 // Publish Posts a message to the given channel.
 func (ca *redisCache) Publish(channel string, message interface{}) (int64, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	return client.Publish(channel, message)
 }
 
 // Subscribe Subscribes the client to the specified channels
+// it blocks until the connection fails, and returns the error, use SubscribeCtx to stop it.
 func (ca *redisCache) Subscribe(receive chan Message, channels ...interface{}) error {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	conn := client.GetConn()
 	psc := redis.PubSubConn{Conn: conn}
 	defer func() {
@@ -694,13 +931,11 @@ func (ca *redisCache) Subscribe(receive chan Message, channels ...interface{}) e
 	for {
 		switch v := psc.Receive().(type) {
 		case redis.Message:
-			fmt.Printf("%s: messages: %s\n", v.Channel, v.Data)
 			receive <- Message{Channel: v.Channel, Data: v.Data}
 		case redis.Subscription:
-			fmt.Printf("%s: %s %d\n", v.Channel, v.Kind, v.Count)
 			continue
 		case error:
-			return err
+			return v
 		}
 	}
 }
@@ -708,23 +943,45 @@ func (ca *redisCache) Subscribe(receive chan Message, channels ...interface{}) e
 //****************** lua scripts *********************
 // EVAL used to evaluate scripts using the Lua interpreter built into Redis starting from version 2.6.0
 func (ca *redisCache) EVAL(script string, argsNum int, arg ...interface{}) (interface{}, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	return client.EVAL(script, argsNum, arg...)
 }
 
 //****************** 全局操作 ***********************
 // Ping ping command, if success return pong
 func (ca *redisCache) Ping() (string, error) {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	client := ca.getDefaultRedis()
 	return client.Ping()
 }
 
 // ClearAll will delete all item in redis cache.
 // never error
 func (ca *redisCache) ClearAll() error {
-	client := internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
-	client.FlushDB()
-	return nil
+	client := ca.getDefaultRedis()
+	err := client.FlushDB()
+	if ca.near != nil {
+		ca.near.evictAll()
+	}
+	return err
+}
+
+// getReply returns the reply of GET key, from the near cache if it is enabled,
+// or from the read server, and from the backup server on connection errors.
+// the soft deadline of values set by SetWithSoftTTL is removed.
+func (ca *redisCache) getReply(key string) (interface{}, error) {
+	var reply interface{}
+	var err error
+	if ca.near != nil {
+		reply, err = ca.nearGet(key)
+	} else {
+		client := ca.getReadRedisClient()
+		reply, err = client.GetObj(key)
+		if ca.checkConnErrorAndNeedRetry(err) {
+			client = ca.getBackupRedis()
+			reply, err = client.GetObj(key)
+		}
+	}
+	return ca.revalidate(key, reply), err
 }
 
 // getReadRedisClient get read mode redis client
@@ -734,7 +991,7 @@ func (ca *redisCache) getReadRedisClient() *internal.RedisClient {
 			return ca.getBackupRedis()
 		}
 	}
-	if ca.readOnlyServerUrl != "" {
+	if ca.hasReadOnly() {
 		return ca.getReadOnlyRedis()
 	}
 	return ca.getDefaultRedis()
@@ -742,15 +999,34 @@ func (ca *redisCache) getReadRedisClient() *internal.RedisClient {
 
 // getRedisClient get default redis client
 func (ca *redisCache) getDefaultRedis() *internal.RedisClient {
-	return internal.GetRedisClient(ca.serverUrl, ca.maxIdle, ca.maxActive)
+	if ca.sentinel != nil {
+		return ca.bindContext(ca.sentinel.masterClient())
+	}
+	if ca.cluster != nil {
+		return ca.bindContext(ca.cluster.Client())
+	}
+	return ca.bindContext(ca.client)
 }
 
 func (ca *redisCache) getBackupRedis() *internal.RedisClient {
-	return internal.GetRedisClient(ca.backupServerUrl, ca.backupMaxIdle, ca.backupMaxActive)
+	return ca.bindContext(ca.backupClient)
 }
 
 func (ca *redisCache) getReadOnlyRedis() *internal.RedisClient {
-	return internal.GetRedisClient(ca.readOnlyServerUrl, ca.readOnlyMaxIdle, ca.readOnlyMaxActive)
+	if ca.readOnlyServerUrl == "" && ca.sentinel != nil {
+		if replica := ca.sentinel.replicaClient(); replica != nil {
+			return ca.bindContext(replica)
+		}
+	}
+	return ca.bindContext(ca.readOnlyClient)
+}
+
+// bindContext returns client bound to ctx of the cache, if it is created by withContext
+func (ca *redisCache) bindContext(client *internal.RedisClient) *internal.RedisClient {
+	if ca.ctx == nil {
+		return client
+	}
+	return client.WithContext(ca.ctx)
 }
 
 // checkConnErrorAndNeedRetry check err is Conn error and is need to retry
@@ -775,13 +1051,18 @@ func (ca *redisCache) checkConnErrorAndNeedRetry(err error) bool {
 	return false
 }
 
+// hasReadOnly returns true if a readonly server is set, or a replica is chosen by sentinel
+func (ca *redisCache) hasReadOnly() bool {
+	return ca.readOnlyServerUrl != "" || (ca.sentinel != nil && ca.sentinel.replicaClient() != nil)
+}
+
 // checkRedisAlive check redis is alive use ping
 // if set readonly redis, check readonly redis
 // if not set readonly redis, check default redis
 func (ca *redisCache) checkRedisAlive() bool {
 	isAlive := false
 	var redisClient *internal.RedisClient
-	if ca.readOnlyServerUrl != "" {
+	if ca.hasReadOnly() {
 		redisClient = ca.getReadOnlyRedis()
 	} else {
 		redisClient = ca.getDefaultRedis()
@@ -802,3 +1083,36 @@ func (ca *redisCache) checkRedisAlive() bool {
 	}
 	return isAlive
 }
+
+// convertNotFoundError converts redis.ErrNil to ErrNotFound in strict mode
+func (ca *redisCache) convertNotFoundError(err error) error {
+	if ca.strict && err == redis.ErrNil {
+		return ErrNotFound
+	}
+	return err
+}
+
+// convertTypeError returns ErrTypeMismatch in strict mode when the value can not be parsed,
+// otherwise returns err unchanged to keep the old behavior
+func (ca *redisCache) convertTypeError(err error) error {
+	if ca.strict {
+		return ErrTypeMismatch
+	}
+	return err
+}
+
+// convertCounterError converts redis counter errors to ErrOverflow or ErrTypeMismatch,
+// so they can be compared with the runtime cache ones.
+func convertCounterError(err error) error {
+	if _, ok := err.(redis.Error); !ok {
+		return err
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "overflow"), strings.Contains(msg, "NaN or Infinity"):
+		return ErrOverflow
+	case strings.Contains(msg, "not an integer"), strings.Contains(msg, "not a valid float"), strings.HasPrefix(msg, "WRONGTYPE"):
+		return ErrTypeMismatch
+	}
+	return err
+}
@@ -0,0 +1,450 @@
+package redis
+
+import (
+	"context"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// withContext returns a copy of the cache whose commands are bounded by ctx,
+// the deadline of ctx bounds pool wait, dial, write and read, and commands return when ctx is canceled.
+func (ca *redisCache) withContext(ctx context.Context) *redisCache {
+	c := *ca
+	c.ctx = ctx
+	return &c
+}
+
+// ExistsCtx is Exists bounded by ctx.
+func (ca *redisCache) ExistsCtx(ctx context.Context, key string) (bool, error) {
+	return ca.withContext(ctx).Exists(key)
+}
+
+// GetCtx is Get bounded by ctx.
+func (ca *redisCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	return ca.withContext(ctx).Get(key)
+}
+
+// GetStringCtx is GetString bounded by ctx.
+func (ca *redisCache) GetStringCtx(ctx context.Context, key string) (string, error) {
+	return ca.withContext(ctx).GetString(key)
+}
+
+// GetIntCtx is GetInt bounded by ctx.
+func (ca *redisCache) GetIntCtx(ctx context.Context, key string) (int, error) {
+	return ca.withContext(ctx).GetInt(key)
+}
+
+// GetInt64Ctx is GetInt64 bounded by ctx.
+func (ca *redisCache) GetInt64Ctx(ctx context.Context, key string) (int64, error) {
+	return ca.withContext(ctx).GetInt64(key)
+}
+
+// SetCtx is Set bounded by ctx.
+func (ca *redisCache) SetCtx(ctx context.Context, key string, v interface{}, ttl int64) error {
+	return ca.withContext(ctx).Set(key, v, ttl)
+}
+
+// IncrCtx is Incr bounded by ctx.
+func (ca *redisCache) IncrCtx(ctx context.Context, key string) (int64, error) {
+	return ca.withContext(ctx).Incr(key)
+}
+
+// DecrCtx is Decr bounded by ctx.
+func (ca *redisCache) DecrCtx(ctx context.Context, key string) (int64, error) {
+	return ca.withContext(ctx).Decr(key)
+}
+
+// IncrByCtx is IncrBy bounded by ctx.
+func (ca *redisCache) IncrByCtx(ctx context.Context, key string, delta int64) (int64, error) {
+	return ca.withContext(ctx).IncrBy(key, delta)
+}
+
+// DecrByCtx is DecrBy bounded by ctx.
+func (ca *redisCache) DecrByCtx(ctx context.Context, key string, delta int64) (int64, error) {
+	return ca.withContext(ctx).DecrBy(key, delta)
+}
+
+// IncrByFloatCtx is IncrByFloat bounded by ctx.
+func (ca *redisCache) IncrByFloatCtx(ctx context.Context, key string, delta float64) (float64, error) {
+	return ca.withContext(ctx).IncrByFloat(key, delta)
+}
+
+// DeleteCtx is Delete bounded by ctx.
+func (ca *redisCache) DeleteCtx(ctx context.Context, key string) error {
+	return ca.withContext(ctx).Delete(key)
+}
+
+// ClearAllCtx is ClearAll bounded by ctx.
+func (ca *redisCache) ClearAllCtx(ctx context.Context) error {
+	return ca.withContext(ctx).ClearAll()
+}
+
+// ExpireCtx is Expire bounded by ctx.
+func (ca *redisCache) ExpireCtx(ctx context.Context, key string, timeOutSeconds int) (int, error) {
+	return ca.withContext(ctx).Expire(key, timeOutSeconds)
+}
+
+// MGetCtx is MGet bounded by ctx.
+func (ca *redisCache) MGetCtx(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+	return ca.withContext(ctx).MGet(keys...)
+}
+
+// MSetCtx is MSet bounded by ctx.
+func (ca *redisCache) MSetCtx(ctx context.Context, items map[string]interface{}, ttl int64) error {
+	return ca.withContext(ctx).MSet(items, ttl)
+}
+
+// MDeleteCtx is MDelete bounded by ctx.
+func (ca *redisCache) MDeleteCtx(ctx context.Context, keys ...string) error {
+	return ca.withContext(ctx).MDelete(keys...)
+}
+
+// HGetCtx is HGet bounded by ctx.
+func (ca *redisCache) HGetCtx(ctx context.Context, hashID string, field string) (string, error) {
+	return ca.withContext(ctx).HGet(hashID, field)
+}
+
+// HMGetCtx is HMGet bounded by ctx.
+func (ca *redisCache) HMGetCtx(ctx context.Context, hashID string, field ...interface{}) ([]string, error) {
+	return ca.withContext(ctx).HMGet(hashID, field...)
+}
+
+// HSetCtx is HSet bounded by ctx.
+func (ca *redisCache) HSetCtx(ctx context.Context, hashID string, field string, val interface{}) error {
+	return ca.withContext(ctx).HSet(hashID, field, val)
+}
+
+// HGetAllCtx is HGetAll bounded by ctx.
+func (ca *redisCache) HGetAllCtx(ctx context.Context, hashID string) (map[string]string, error) {
+	return ca.withContext(ctx).HGetAll(hashID)
+}
+
+// HSetNXCtx is HSetNX bounded by ctx.
+func (ca *redisCache) HSetNXCtx(ctx context.Context, hashID string, field string, val string) (string, error) {
+	return ca.withContext(ctx).HSetNX(hashID, field, val)
+}
+
+// HDelCtx is HDel bounded by ctx.
+func (ca *redisCache) HDelCtx(ctx context.Context, hashID string, fields ...interface{}) (int, error) {
+	return ca.withContext(ctx).HDel(hashID, fields...)
+}
+
+// HExistsCtx is HExists bounded by ctx.
+func (ca *redisCache) HExistsCtx(ctx context.Context, hashID string, field string) (int, error) {
+	return ca.withContext(ctx).HExists(hashID, field)
+}
+
+// HIncrByCtx is HIncrBy bounded by ctx.
+func (ca *redisCache) HIncrByCtx(ctx context.Context, hashID string, field string, increment int) (int, error) {
+	return ca.withContext(ctx).HIncrBy(hashID, field, increment)
+}
+
+// HIncrByFloatCtx is HIncrByFloat bounded by ctx.
+func (ca *redisCache) HIncrByFloatCtx(ctx context.Context, hashID string, field string, increment float64) (float64, error) {
+	return ca.withContext(ctx).HIncrByFloat(hashID, field, increment)
+}
+
+// HKeysCtx is HKeys bounded by ctx.
+func (ca *redisCache) HKeysCtx(ctx context.Context, hashID string) ([]string, error) {
+	return ca.withContext(ctx).HKeys(hashID)
+}
+
+// HLenCtx is HLen bounded by ctx.
+func (ca *redisCache) HLenCtx(ctx context.Context, hashID string) (int, error) {
+	return ca.withContext(ctx).HLen(hashID)
+}
+
+// HValsCtx is HVals bounded by ctx.
+func (ca *redisCache) HValsCtx(ctx context.Context, hashID string) ([]string, error) {
+	return ca.withContext(ctx).HVals(hashID)
+}
+
+// GetJsonObjCtx is GetJsonObj bounded by ctx.
+func (ca *redisCache) GetJsonObjCtx(ctx context.Context, key string, result interface{}) error {
+	return ca.withContext(ctx).GetJsonObj(key, result)
+}
+
+// SetJsonObjCtx is SetJsonObj bounded by ctx.
+func (ca *redisCache) SetJsonObjCtx(ctx context.Context, key string, val interface{}) (interface{}, error) {
+	return ca.withContext(ctx).SetJsonObj(key, val)
+}
+
+// BLPopCtx is BLPop bounded by ctx.
+// the command is sent again every second until an element is popped or ctx is done.
+func (ca *redisCache) BLPopCtx(ctx context.Context, key ...interface{}) (map[string]string, error) {
+	return ca.withContext(ctx).BLPop(key...)
+}
+
+// BRPopCtx is BRPop bounded by ctx.
+// the command is sent again every second until an element is popped or ctx is done.
+func (ca *redisCache) BRPopCtx(ctx context.Context, key ...interface{}) (map[string]string, error) {
+	return ca.withContext(ctx).BRPop(key...)
+}
+
+// BRPopLPushCtx is BRPopLPush bounded by ctx.
+// the command is sent again every second until an element is popped or ctx is done.
+func (ca *redisCache) BRPopLPushCtx(ctx context.Context, source string, destination string) (string, error) {
+	return ca.withContext(ctx).BRPopLPush(source, destination)
+}
+
+// LIndexCtx is LIndex bounded by ctx.
+func (ca *redisCache) LIndexCtx(ctx context.Context, key string, index int) (string, error) {
+	return ca.withContext(ctx).LIndex(key, index)
+}
+
+// LInsertCtx is LInsert bounded by ctx.
+func (ca *redisCache) LInsertCtx(ctx context.Context, key string, direction string, pivot string, value string) (int, error) {
+	return ca.withContext(ctx).LInsert(key, direction, pivot, value)
+}
+
+// LLenCtx is LLen bounded by ctx.
+func (ca *redisCache) LLenCtx(ctx context.Context, key string) (int, error) {
+	return ca.withContext(ctx).LLen(key)
+}
+
+// LPopCtx is LPop bounded by ctx.
+func (ca *redisCache) LPopCtx(ctx context.Context, key string) (string, error) {
+	return ca.withContext(ctx).LPop(key)
+}
+
+// LPushCtx is LPush bounded by ctx.
+func (ca *redisCache) LPushCtx(ctx context.Context, key string, value ...interface{}) (int, error) {
+	return ca.withContext(ctx).LPush(key, value...)
+}
+
+// LPushXCtx is LPushX bounded by ctx.
+func (ca *redisCache) LPushXCtx(ctx context.Context, key string, value string) (int, error) {
+	return ca.withContext(ctx).LPushX(key, value)
+}
+
+// LRangeCtx is LRange bounded by ctx.
+func (ca *redisCache) LRangeCtx(ctx context.Context, key string, start int, end int) ([]string, error) {
+	return ca.withContext(ctx).LRange(key, start, end)
+}
+
+// LRemCtx is LRem bounded by ctx.
+func (ca *redisCache) LRemCtx(ctx context.Context, key string, count int, value string) (int, error) {
+	return ca.withContext(ctx).LRem(key, count, value)
+}
+
+// LSetCtx is LSet bounded by ctx.
+func (ca *redisCache) LSetCtx(ctx context.Context, key string, index int, value string) (string, error) {
+	return ca.withContext(ctx).LSet(key, index, value)
+}
+
+// LTrimCtx is LTrim bounded by ctx.
+func (ca *redisCache) LTrimCtx(ctx context.Context, key string, start int, stop int) (string, error) {
+	return ca.withContext(ctx).LTrim(key, start, stop)
+}
+
+// RPopCtx is RPop bounded by ctx.
+func (ca *redisCache) RPopCtx(ctx context.Context, key string) (string, error) {
+	return ca.withContext(ctx).RPop(key)
+}
+
+// RPopLPushCtx is RPopLPush bounded by ctx.
+func (ca *redisCache) RPopLPushCtx(ctx context.Context, source string, destination string) (string, error) {
+	return ca.withContext(ctx).RPopLPush(source, destination)
+}
+
+// RPushCtx is RPush bounded by ctx.
+func (ca *redisCache) RPushCtx(ctx context.Context, key string, value ...interface{}) (int, error) {
+	return ca.withContext(ctx).RPush(key, value...)
+}
+
+// RPushXCtx is RPushX bounded by ctx.
+func (ca *redisCache) RPushXCtx(ctx context.Context, key string, value ...interface{}) (int, error) {
+	return ca.withContext(ctx).RPushX(key, value...)
+}
+
+// SAddCtx is SAdd bounded by ctx.
+func (ca *redisCache) SAddCtx(ctx context.Context, key string, value ...interface{}) (int, error) {
+	return ca.withContext(ctx).SAdd(key, value...)
+}
+
+// SCardCtx is SCard bounded by ctx.
+func (ca *redisCache) SCardCtx(ctx context.Context, key string) (int, error) {
+	return ca.withContext(ctx).SCard(key)
+}
+
+// SDiffCtx is SDiff bounded by ctx.
+func (ca *redisCache) SDiffCtx(ctx context.Context, key ...interface{}) ([]string, error) {
+	return ca.withContext(ctx).SDiff(key...)
+}
+
+// SDiffStoreCtx is SDiffStore bounded by ctx.
+func (ca *redisCache) SDiffStoreCtx(ctx context.Context, destination string, key ...interface{}) (int, error) {
+	return ca.withContext(ctx).SDiffStore(destination, key...)
+}
+
+// SInterCtx is SInter bounded by ctx.
+func (ca *redisCache) SInterCtx(ctx context.Context, key ...interface{}) ([]string, error) {
+	return ca.withContext(ctx).SInter(key...)
+}
+
+// SInterStoreCtx is SInterStore bounded by ctx.
+func (ca *redisCache) SInterStoreCtx(ctx context.Context, destination string, key ...interface{}) (int, error) {
+	return ca.withContext(ctx).SInterStore(destination, key...)
+}
+
+// SIsMemberCtx is SIsMember bounded by ctx.
+func (ca *redisCache) SIsMemberCtx(ctx context.Context, key string, value string) (bool, error) {
+	return ca.withContext(ctx).SIsMember(key, value)
+}
+
+// SMembersCtx is SMembers bounded by ctx.
+func (ca *redisCache) SMembersCtx(ctx context.Context, key string) ([]string, error) {
+	return ca.withContext(ctx).SMembers(key)
+}
+
+// SMoveCtx is SMove bounded by ctx.
+func (ca *redisCache) SMoveCtx(ctx context.Context, source string, destination string, value string) (bool, error) {
+	return ca.withContext(ctx).SMove(source, destination, value)
+}
+
+// SPopCtx is SPop bounded by ctx.
+func (ca *redisCache) SPopCtx(ctx context.Context, key string) (string, error) {
+	return ca.withContext(ctx).SPop(key)
+}
+
+// SRandMemberCtx is SRandMember bounded by ctx.
+func (ca *redisCache) SRandMemberCtx(ctx context.Context, key string, count int) ([]string, error) {
+	return ca.withContext(ctx).SRandMember(key, count)
+}
+
+// SRemCtx is SRem bounded by ctx.
+func (ca *redisCache) SRemCtx(ctx context.Context, key string, value ...interface{}) (int, error) {
+	return ca.withContext(ctx).SRem(key, value...)
+}
+
+// SUnionCtx is SUnion bounded by ctx.
+func (ca *redisCache) SUnionCtx(ctx context.Context, key ...interface{}) ([]string, error) {
+	return ca.withContext(ctx).SUnion(key...)
+}
+
+// SUnionStoreCtx is SUnionStore bounded by ctx.
+func (ca *redisCache) SUnionStoreCtx(ctx context.Context, destination string, key ...interface{}) (int, error) {
+	return ca.withContext(ctx).SUnionStore(destination, key...)
+}
+
+// ZAddCtx is ZAdd bounded by ctx.
+func (ca *redisCache) ZAddCtx(ctx context.Context, key string, score int64, member interface{}) (int, error) {
+	return ca.withContext(ctx).ZAdd(key, score, member)
+}
+
+// ZCountCtx is ZCount bounded by ctx.
+func (ca *redisCache) ZCountCtx(ctx context.Context, key string, min, max int64) (int, error) {
+	return ca.withContext(ctx).ZCount(key, min, max)
+}
+
+// ZRemCtx is ZRem bounded by ctx.
+func (ca *redisCache) ZRemCtx(ctx context.Context, key string, member ...interface{}) (int, error) {
+	return ca.withContext(ctx).ZRem(key, member...)
+}
+
+// ZCardCtx is ZCard bounded by ctx.
+func (ca *redisCache) ZCardCtx(ctx context.Context, key string) (int, error) {
+	return ca.withContext(ctx).ZCard(key)
+}
+
+// ZRankCtx is ZRank bounded by ctx.
+func (ca *redisCache) ZRankCtx(ctx context.Context, key, member string) (int, error) {
+	return ca.withContext(ctx).ZRank(key, member)
+}
+
+// ZRangeCtx is ZRange bounded by ctx.
+func (ca *redisCache) ZRangeCtx(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return ca.withContext(ctx).ZRange(key, start, stop)
+}
+
+// ZRangeByScoreCtx is ZRangeByScore bounded by ctx.
+func (ca *redisCache) ZRangeByScoreCtx(ctx context.Context, key string, start, stop string, isWithScores bool) ([]string, error) {
+	return ca.withContext(ctx).ZRangeByScore(key, start, stop, isWithScores)
+}
+
+// ZREVRangeByScoreCtx is ZREVRangeByScore bounded by ctx.
+func (ca *redisCache) ZREVRangeByScoreCtx(ctx context.Context, key string, max, min string, isWithScores bool) ([]string, error) {
+	return ca.withContext(ctx).ZREVRangeByScore(key, max, min, isWithScores)
+}
+
+// ZRevRangeCtx is ZRevRange bounded by ctx.
+func (ca *redisCache) ZRevRangeCtx(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return ca.withContext(ctx).ZRevRange(key, start, stop)
+}
+
+// PublishCtx is Publish bounded by ctx.
+func (ca *redisCache) PublishCtx(ctx context.Context, channel string, message interface{}) (int64, error) {
+	return ca.withContext(ctx).Publish(channel, message)
+}
+
+// EVALCtx is EVAL bounded by ctx.
+func (ca *redisCache) EVALCtx(ctx context.Context, script string, argsNum int, arg ...interface{}) (interface{}, error) {
+	return ca.withContext(ctx).EVAL(script, argsNum, arg...)
+}
+
+// GetObjCtx is GetObj bounded by ctx.
+func (ca *redisCache) GetObjCtx(ctx context.Context, key string, result interface{}) error {
+	return ca.withContext(ctx).GetObj(key, result)
+}
+
+// HGetObjCtx is HGetObj bounded by ctx.
+func (ca *redisCache) HGetObjCtx(ctx context.Context, hashID string, field string, result interface{}) error {
+	return ca.withContext(ctx).HGetObj(hashID, field, result)
+}
+
+// GetOrLoadCtx is GetOrLoad bounded by ctx, loads shared by concurrent callers are bounded by ctx of the first one.
+func (ca *redisCache) GetOrLoadCtx(ctx context.Context, key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	return ca.withContext(ctx).GetOrLoad(key, ttl, loader)
+}
+
+// SetWithSoftTTLCtx is SetWithSoftTTL bounded by ctx.
+func (ca *redisCache) SetWithSoftTTLCtx(ctx context.Context, key string, value interface{}, softTTL int64, ttl int64) error {
+	return ca.withContext(ctx).SetWithSoftTTL(key, value, softTTL, ttl)
+}
+
+// SubscribeCtx is Subscribe bounded by ctx, it unsubscribes and returns ctx.Err() when ctx is done.
+func (ca *redisCache) SubscribeCtx(ctx context.Context, receive chan Message, channels ...interface{}) error {
+	conn, err := ca.getDefaultRedis().GetConnContext(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	psc := redis.PubSubConn{Conn: conn}
+	if err := psc.Subscribe(channels...); err != nil {
+		return err
+	}
+	done, stopped := make(chan struct{}), make(chan struct{})
+	defer func() {
+		// conn is closed after the goroutine, they both write to it
+		close(done)
+		<-stopped
+	}()
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			// unblock Receive, it gets a subscription with count 0
+			psc.Unsubscribe()
+		case <-done:
+		}
+	}()
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			select {
+			case receive <- Message{Channel: v.Channel, Data: v.Data}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		case redis.Subscription:
+			if v.Count == 0 {
+				return ctx.Err()
+			}
+		case error:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return v
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package redis
 
 import (
+	"context"
 	"fmt"
+	"github.com/devfeel/cache/codec"
+	"strings"
 	"testing"
+	"time"
 )
 
 var rc *redisCache
@@ -37,6 +41,12 @@ func TestRedisCache_ZAdd(t *testing.T){
 	fmt.Println(rc.ZAdd("dottest", 1, 1))
 }
 
+func TestRedisCache_IncrBy(t *testing.T) {
+	fmt.Println(rc.IncrBy("incrtest", 10))
+	fmt.Println(rc.DecrBy("incrtest", 3))
+	fmt.Println(rc.IncrByFloat("incrfloattest", 0.5))
+}
+
 func TestRedisCache_Set(t *testing.T) {
 	fmt.Println(rc.Set("dottest", 1, 0))
 }
@@ -89,3 +99,145 @@ func TestRedisCache_HSet(t *testing.T) {
 func TestRedisCache_HSetNX(t *testing.T) {
 	fmt.Println(rc.HSetNX("hkey1", "hkey1field1", "hkey1field1value"))
 }
+
+func TestRedisCache_StrictMode(t *testing.T) {
+	rc.SetStrictMode(true)
+	defer rc.SetStrictMode(false)
+	rc.Delete("strict-none")
+	_, err := rc.GetString("strict-none")
+	fmt.Println(err == ErrNotFound, err)
+	rc.Set("strict-text", "abc", 10)
+	_, err = rc.GetInt("strict-text")
+	fmt.Println(err == ErrTypeMismatch, err)
+}
+
+func TestRedisCache_BLPopCtx(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	fmt.Println(rc.BLPopCtx(ctx, "blpop-ctx-none"))
+}
+
+func TestRedisCache_Codec(t *testing.T) {
+	type user struct {
+		Name string
+		Age  int
+	}
+	rc.SetCodec(codec.MsgpackCodec{})
+	defer rc.SetCodec(codec.JSONCodec{})
+	rc.Set("codec-user", user{Name: "devfeel", Age: 10}, 10)
+	var u user
+	err := rc.GetObj("codec-user", &u)
+	fmt.Println(u, err)
+	rc.Set("codec-int", 10, 10)
+	var i int64
+	err = rc.GetObj("codec-int", &i)
+	fmt.Println(i, err)
+}
+
+func TestRedisCache_MGetMSet(t *testing.T) {
+	err := rc.MSet(map[string]interface{}{"m1": 1, "m2": "2"}, 10)
+	fmt.Println(err)
+	items, err := rc.MGet("m1", "m2", "m-none")
+	fmt.Println(len(items), items, err)
+	fmt.Println(rc.MDelete("m1", "m2"))
+}
+
+func TestRedisCache_Pipeline(t *testing.T) {
+	p := rc.Pipeline()
+	set := p.Set("pipe-1", 1, 10)
+	incr := p.Incr("pipe-1")
+	get := p.GetString("pipe-1")
+	err := p.Exec()
+	fmt.Println(err)
+	fmt.Println(set.Result())
+	fmt.Println(incr.Result())
+	fmt.Println(get.Result())
+}
+
+func TestRedisCache_Watch(t *testing.T) {
+	rc.HSet("tx-inv-a", "apple", 10)
+	err := rc.Watch(func(tx *Tx) error {
+		v, err := tx.ReadInt64("HGET", "tx-inv-a", "apple")
+		if err != nil {
+			return err
+		}
+		tx.HSet("tx-inv-a", "apple", v-3)
+		tx.HIncrBy("tx-inv-b", "apple", 3)
+		return nil
+	}, "tx-inv-a")
+	fmt.Println(err)
+	fmt.Println(rc.HGetAll("tx-inv-a"))
+	fmt.Println(rc.HGetAll("tx-inv-b"))
+}
+
+func TestRedisCache_Redlock(t *testing.T) {
+	var locker DistLocker = NewRedlock([]*Locker{rc.NewLocker()})
+	lock, err := locker.TryLock("redlock-key", time.Second)
+	fmt.Println(err)
+	if err == nil {
+		fmt.Println(lock.Unlock())
+	}
+}
+
+func TestRedisCache_Cluster(t *testing.T) {
+	cc, err := NewClusterRedisCache([]string{"redis://192.168.8.175:7000/0"}, 10, 10)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer cc.Close()
+	fmt.Println(cc.MSet(map[string]interface{}{"{user1}.name": "a", "user2": "b"}, 60))
+	fmt.Println(cc.MGet("{user1}.name", "user2"))
+	_, err = cc.SInter("user1", "user2")
+	fmt.Println(err == ErrCrossSlot)
+}
+
+func TestShardedRedisCache(t *testing.T) {
+	sc, err := NewShardedRedisCache([]string{"redis://192.168.8.175:6379/0", "redis://192.168.8.175:6379/1"}, 10, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	fmt.Println(sc.MSet(map[string]interface{}{"sharded-1": 1, "sharded-2": 2}, 60))
+	fmt.Println(sc.MGet("sharded-1", "sharded-2"))
+	_, err = sc.SInter("{sharded}.a", "{sharded}.b")
+	fmt.Println(err)
+}
+
+func TestRedisCache_GetOrLoad(t *testing.T) {
+	rc.SetLoadLock(time.Second)
+	defer rc.SetLoadLock(0)
+	rc.Delete("getorload-key")
+	loader := func() (interface{}, error) {
+		return 42, nil
+	}
+	miss, err := rc.GetOrLoad("getorload-key", 60, loader)
+	if b, ok := miss.([]byte); err != nil || !ok || string(b) != "42" {
+		t.Errorf("TestRedisCache_GetOrLoad miss expect []byte 42, got %T %v %v", miss, miss, err)
+	}
+	hit, err := rc.GetOrLoad("getorload-key", 60, loader)
+	if b, ok := hit.([]byte); err != nil || !ok || string(b) != "42" {
+		t.Errorf("TestRedisCache_GetOrLoad hit expect []byte 42, got %T %v %v", hit, hit, err)
+	}
+}
+
+func TestRedisCache_SetWithSoftTTL(t *testing.T) {
+	rc.SetLoader(func(key string) (interface{}, error) {
+		return "refreshed", nil
+	})
+	defer rc.SetLoader(nil)
+	fmt.Println(rc.SetWithSoftTTL("softttl-key", "stale", 1, 60))
+	time.Sleep(1100 * time.Millisecond)
+	fmt.Println(rc.GetString("softttl-key"))
+	time.Sleep(100 * time.Millisecond)
+	fmt.Println(rc.GetString("softttl-key"))
+}
+
+func TestRedisCache_UseAfterClose(t *testing.T) {
+	c := NewRedisCache("redis://127.0.0.1:1/15", 1, 1)
+	c.Close()
+	// the released pool is closed, not created again
+	if _, err := c.Get("key"); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Error("TestRedisCache_UseAfterClose expect error of closed pool, got", err)
+	}
+}
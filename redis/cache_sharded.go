@@ -0,0 +1,836 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/devfeel/cache/codec"
+	"github.com/devfeel/cache/internal"
+)
+
+// ErrCrossShard is returned by ShardedRedisCache when keys of a multi-key command, like SInter or RPopLPush,
+// are on different shards. use a {hashtag} in keys to put them on the same shard.
+// MGet, MSet, MDelete and Pipeline are split by shard, they do not return it.
+var ErrCrossShard = errors.New("cache: keys are on different shards")
+
+type (
+	// ShardOption configures a ShardedRedisCache created by NewShardedRedisCache
+	ShardOption func(*shardOptions)
+
+	shardOptions struct {
+		readOnly []shardServer
+		backup   []shardServer
+	}
+
+	// shardServer is a readonly or backup server of the shard of masterUrl
+	shardServer struct {
+		option    string
+		masterUrl string
+		serverUrl string
+	}
+)
+
+// WithShardReplica set the readonly server of the shard of masterUrl, with the pool size of the shards.
+// SetReadOnlyServer of ShardedRedisCache only works with one shard, use it for each shard of several ones.
+func WithShardReplica(masterUrl string, readOnlyUrl string) ShardOption {
+	return func(o *shardOptions) {
+		o.readOnly = append(o.readOnly, shardServer{option: "WithShardReplica", masterUrl: masterUrl, serverUrl: readOnlyUrl})
+	}
+}
+
+// WithShardBackup set the backup server of the shard of masterUrl, with the pool size of the shards.
+// SetBackupServer of ShardedRedisCache only works with one shard, use it for each shard of several ones.
+func WithShardBackup(masterUrl string, backupUrl string) ShardOption {
+	return func(o *shardOptions) {
+		o.backup = append(o.backup, shardServer{option: "WithShardBackup", masterUrl: masterUrl, serverUrl: backupUrl})
+	}
+}
+
+// checkShardServers returns an error if the master of a server is not in urls, or has two servers
+func checkShardServers(servers []shardServer, urls map[string]bool) error {
+	seen := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		if !urls[server.masterUrl] {
+			return fmt.Errorf("cache: %s of %s is not a server of ShardedRedisCache", shardName(server.masterUrl), server.option)
+		}
+		if seen[server.masterUrl] {
+			return fmt.Errorf("cache: duplicate %s of %s", server.option, shardName(server.masterUrl))
+		}
+		seen[server.masterUrl] = true
+	}
+	return nil
+}
+
+// ShardedRedisCache is a RedisCache over several independent redis servers,
+// keys are spread by a consistent hash ring with DefaultVirtualNodes virtual nodes per server,
+// so a key is always on the same server, and adding a server moves only about 1/N of keys.
+// only the {hashtag} of a key is hashed if it has a non-empty one.
+// each shard is a RedisCache of its own, with its own readonly and backup server, see WithShardReplica and Shard.
+type ShardedRedisCache struct {
+	shards []*redisCache
+	urls   map[string]*redisCache
+	ring   *hashRing
+}
+
+// NewShardedRedisCache returns a new *ShardedRedisCache on serverUrls, like "redis://:password@10.0.1.11:6379/0",
+// each server has its own connection pool of maxIdle and maxActive.
+// the readonly and backup servers of shards are set by WithShardReplica and WithShardBackup.
+// return an error if serverUrls is empty, or if a server is in it twice, passwords aside,
+// or if an option names a server which is not in serverUrls, or a server twice.
+func NewShardedRedisCache(serverUrls []string, maxIdle int, maxActive int, opts ...ShardOption) (*ShardedRedisCache, error) {
+	if len(serverUrls) == 0 {
+		return nil, errors.New("cache: no server of ShardedRedisCache")
+	}
+	names := make([]string, len(serverUrls))
+	seen := make(map[string]bool, len(serverUrls))
+	urls := make(map[string]bool, len(serverUrls))
+	for i, serverUrl := range serverUrls {
+		names[i] = shardName(serverUrl)
+		if seen[names[i]] {
+			return nil, fmt.Errorf("cache: duplicate server %s of ShardedRedisCache", names[i])
+		}
+		seen[names[i]] = true
+		urls[serverUrl] = true
+	}
+	o := &shardOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if err := checkShardServers(o.readOnly, urls); err != nil {
+		return nil, err
+	}
+	if err := checkShardServers(o.backup, urls); err != nil {
+		return nil, err
+	}
+	ca := &ShardedRedisCache{
+		shards: make([]*redisCache, len(serverUrls)),
+		urls:   make(map[string]*redisCache, len(serverUrls)),
+	}
+	for i, serverUrl := range serverUrls {
+		ca.shards[i] = NewRedisCache(serverUrl, maxIdle, maxActive)
+		ca.urls[serverUrl] = ca.shards[i]
+	}
+	for _, server := range o.readOnly {
+		ca.urls[server.masterUrl].SetReadOnlyServer(server.serverUrl, maxIdle, maxActive)
+	}
+	for _, server := range o.backup {
+		ca.urls[server.masterUrl].SetBackupServer(server.serverUrl, maxIdle, maxActive)
+	}
+	ca.ring = newHashRing(names, DefaultVirtualNodes)
+	return ca, nil
+}
+
+// Shard returns the shard of serverUrl, nil if serverUrl is not a shard,
+// use it to set the readonly and backup server of the shard:
+// ca.Shard("redis://10.0.1.11:6379/0").SetReadOnlyServer("redis://10.0.1.21:6379/0", 10, 10)
+func (ca *ShardedRedisCache) Shard(serverUrl string) *redisCache {
+	return ca.urls[serverUrl]
+}
+
+// ShardOf returns the shard holding key
+func (ca *ShardedRedisCache) ShardOf(key string) *redisCache {
+	return ca.shard(key)
+}
+
+// SetReadOnlyServer set readonly redis server when there is only one shard.
+// a single readonly server can not serve several shards, so it does nothing with several shards,
+// use WithShardReplica of NewShardedRedisCache, or Shard(serverUrl).SetReadOnlyServer instead.
+func (ca *ShardedRedisCache) SetReadOnlyServer(serverUrl string, maxIdle int, maxActive int) {
+	if len(ca.shards) != 1 {
+		return
+	}
+	ca.shards[0].SetReadOnlyServer(serverUrl, maxIdle, maxActive)
+}
+
+// SetBackupServer set backup redis server when there is only one shard.
+// a single backup server can not serve several shards, so it does nothing with several shards,
+// use WithShardBackup of NewShardedRedisCache, or Shard(serverUrl).SetBackupServer instead.
+func (ca *ShardedRedisCache) SetBackupServer(serverUrl string, maxIdle int, maxActive int) {
+	if len(ca.shards) != 1 {
+		return
+	}
+	ca.shards[0].SetBackupServer(serverUrl, maxIdle, maxActive)
+}
+
+// SetStrictMode set strict mode of all shards, default is false.
+func (ca *ShardedRedisCache) SetStrictMode(strict bool) {
+	for _, shard := range ca.shards {
+		shard.SetStrictMode(strict)
+	}
+}
+
+// SetLoadLock enable the distributed mode of GetOrLoad on all shards, 0 disables it.
+func (ca *ShardedRedisCache) SetLoadLock(ttl time.Duration) {
+	for _, shard := range ca.shards {
+		shard.SetLoadLock(ttl)
+	}
+}
+
+// SetLoader set the loader which refreshes values set by SetWithSoftTTL on all shards, default is nil.
+func (ca *ShardedRedisCache) SetLoader(loader func(key string) (interface{}, error)) {
+	for _, shard := range ca.shards {
+		shard.SetLoader(loader)
+	}
+}
+
+// SetCodec set codec of all shards, default is codec.JSONCodec
+func (ca *ShardedRedisCache) SetCodec(c codec.Codec) {
+	for _, shard := range ca.shards {
+		shard.SetCodec(c)
+	}
+}
+
+// SetCompression set compression of all shards, default is CompressionNone
+func (ca *ShardedRedisCache) SetCompression(compression Compression, threshold int) {
+	for _, shard := range ca.shards {
+		shard.SetCompression(compression, threshold)
+	}
+}
+
+// Decode decode data returned by commands like LPop, LRange or SMembers into result
+func (ca *ShardedRedisCache) Decode(data string, result interface{}) error {
+	return ca.shards[0].Decode(data, result)
+}
+
+// Close closes all shards, it returns the first error.
+func (ca *ShardedRedisCache) Close() error {
+	var err error
+	for _, shard := range ca.shards {
+		if e := shard.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// Exists check item exist in redis cache.
+func (ca *ShardedRedisCache) Exists(key string) (bool, error) {
+	return ca.shard(key).Exists(key)
+}
+
+// Incr increase int64 counter in redis cache.
+func (ca *ShardedRedisCache) Incr(key string) (int64, error) {
+	return ca.shard(key).Incr(key)
+}
+
+// Decr decrease counter in redis cache.
+func (ca *ShardedRedisCache) Decr(key string) (int64, error) {
+	return ca.shard(key).Decr(key)
+}
+
+// IncrBy increase int64 counter in redis cache by delta.
+// return ErrOverflow if result overflows, ErrTypeMismatch if value is not an integer
+func (ca *ShardedRedisCache) IncrBy(key string, delta int64) (int64, error) {
+	return ca.shard(key).IncrBy(key, delta)
+}
+
+// DecrBy decrease int64 counter in redis cache by delta.
+// return ErrOverflow if result overflows, ErrTypeMismatch if value is not an integer
+func (ca *ShardedRedisCache) DecrBy(key string, delta int64) (int64, error) {
+	return ca.shard(key).DecrBy(key, delta)
+}
+
+// IncrByFloat increase float counter in redis cache by delta.
+// return ErrOverflow if result is NaN or Infinity, ErrTypeMismatch if value is not a number
+func (ca *ShardedRedisCache) IncrByFloat(key string, delta float64) (float64, error) {
+	return ca.shard(key).IncrByFloat(key, delta)
+}
+
+// Get cache from redis cache.
+// if non-existed or expired, return nil, or ErrNotFound in strict mode.
+func (ca *ShardedRedisCache) Get(key string) (interface{}, error) {
+	return ca.shard(key).Get(key)
+}
+
+// GetString returns value string format by given key
+// if non-existed or expired, return redis.ErrNil, or ErrNotFound in strict mode.
+func (ca *ShardedRedisCache) GetString(key string) (string, error) {
+	return ca.shard(key).GetString(key)
+}
+
+// GetInt returns value int format by given key
+// if non-existed or expired, return nil.
+// in strict mode, return ErrNotFound if non-existed, ErrTypeMismatch if not an integer.
+func (ca *ShardedRedisCache) GetInt(key string) (int, error) {
+	return ca.shard(key).GetInt(key)
+}
+
+// GetInt64 returns value int64 format by given key
+// if non-existed or expired, return nil.
+// in strict mode, return ErrNotFound if non-existed, ErrTypeMismatch if not an integer.
+func (ca *ShardedRedisCache) GetInt64(key string) (int64, error) {
+	return ca.shard(key).GetInt64(key)
+}
+
+// Set cache to redis.
+// ttl is second, if ttl is 0, it will be forever.
+func (ca *ShardedRedisCache) Set(key string, value interface{}, ttl int64) error {
+	return ca.shard(key).Set(key, value, ttl)
+}
+
+// Delete item in redis cacha.
+// if not exists, we think it's success
+func (ca *ShardedRedisCache) Delete(key string) error {
+	return ca.shard(key).Delete(key)
+}
+
+// Expire Set a timeout on key. After the timeout has expired, the key will automatically be deleted.
+func (ca *ShardedRedisCache) Expire(key string, timeOutSeconds int) (int, error) {
+	return ca.shard(key).Expire(key, timeOutSeconds)
+}
+
+// GetJsonObj get obj with SetJsonObj key
+func (ca *ShardedRedisCache) GetJsonObj(key string, result interface{}) error {
+	return ca.shard(key).GetJsonObj(key, result)
+}
+
+// SetJsonObj set obj use json encode string
+func (ca *ShardedRedisCache) SetJsonObj(key string, val interface{}) (interface{}, error) {
+	return ca.shard(key).SetJsonObj(key, val)
+}
+
+// HGet Returns the value associated with field in the hash stored at key.
+func (ca *ShardedRedisCache) HGet(key, field string) (string, error) {
+	return ca.shard(key).HGet(key, field)
+}
+
+// HMGet Returns the values associated with the specified fields in the hash stored at key.
+func (ca *ShardedRedisCache) HMGet(hashID string, field ...interface{}) ([]string, error) {
+	return ca.shard(hashID).HMGet(hashID, field...)
+}
+
+// HGetAll Returns all fields and values of the hash stored at key
+func (ca *ShardedRedisCache) HGetAll(key string) (map[string]string, error) {
+	return ca.shard(key).HGetAll(key)
+}
+
+// HSet Sets field in the hash stored at key to value. If key does not exist, a new key holding a hash is created.
+// If field already exists in the hash, it is overwritten.
+func (ca *ShardedRedisCache) HSet(key, field string, value interface{}) error {
+	return ca.shard(key).HSet(key, field, value)
+}
+
+// HDel Removes the specified fields from the hash stored at key.
+func (ca *ShardedRedisCache) HDel(key string, field ...interface{}) (int, error) {
+	return ca.shard(key).HDel(key, field...)
+}
+
+// HExists Returns if field is an existing field in the hash stored at key
+func (ca *ShardedRedisCache) HExists(key string, field string) (int, error) {
+	return ca.shard(key).HExists(key, field)
+}
+
+// HSetNX Sets field in the hash stored at key to value, only if field does not yet exist
+func (ca *ShardedRedisCache) HSetNX(key string, field string, value string) (string, error) {
+	return ca.shard(key).HSetNX(key, field, value)
+}
+
+// HIncrBy Increments the number stored at field in the hash stored at key by increment.
+func (ca *ShardedRedisCache) HIncrBy(key string, field string, increment int) (int, error) {
+	return ca.shard(key).HIncrBy(key, field, increment)
+}
+
+// HIncrByFloat Increment the specified field of a hash stored at key, and representing a floating point number, by the specified increment
+func (ca *ShardedRedisCache) HIncrByFloat(key string, field string, increment float64) (float64, error) {
+	return ca.shard(key).HIncrByFloat(key, field, increment)
+}
+
+// HKeys Returns all field names in the hash stored at key.
+func (ca *ShardedRedisCache) HKeys(key string) ([]string, error) {
+	return ca.shard(key).HKeys(key)
+}
+
+// HLen Returns the number of fields contained in the hash stored at key
+func (ca *ShardedRedisCache) HLen(key string) (int, error) {
+	return ca.shard(key).HLen(key)
+}
+
+// HVals Returns all values in the hash stored at key
+func (ca *ShardedRedisCache) HVals(key string) ([]string, error) {
+	return ca.shard(key).HVals(key)
+}
+
+// LIndex return element which subscript is index,
+// if index is -1, return last one element of list and so on
+func (ca *ShardedRedisCache) LIndex(key string, index int) (string, error) {
+	return ca.shard(key).LIndex(key, index)
+}
+
+// LInsert Inserts value in the list stored at key either before or after the reference value pivot.
+func (ca *ShardedRedisCache) LInsert(key string, direction string, pivot string, value string) (int, error) {
+	return ca.shard(key).LInsert(key, direction, pivot, value)
+}
+
+// LLen return length of list
+func (ca *ShardedRedisCache) LLen(key string) (int, error) {
+	return ca.shard(key).LLen(key)
+}
+
+// LPop remove and return head element of list
+func (ca *ShardedRedisCache) LPop(key string) (string, error) {
+	return ca.shard(key).LPop(key)
+}
+
+// LPush Insert all the specified values at the head of the list stored at key
+func (ca *ShardedRedisCache) LPush(key string, value ...interface{}) (int, error) {
+	return ca.shard(key).LPush(key, value...)
+}
+
+// LPushX insert an element at the head of the list
+func (ca *ShardedRedisCache) LPushX(key string, value string) (int, error) {
+	return ca.shard(key).LPushX(key, value)
+}
+
+// LRange Returns the specified elements of the list stored at key
+func (ca *ShardedRedisCache) LRange(key string, start int, stop int) ([]string, error) {
+	return ca.shard(key).LRange(key, start, stop)
+}
+
+// LRem Removes the first count occurrences of elements equal to value from the list stored at key.
+func (ca *ShardedRedisCache) LRem(key string, count int, value string) (int, error) {
+	return ca.shard(key).LRem(key, count, value)
+}
+
+// LSet Sets the list element at index to value
+func (ca *ShardedRedisCache) LSet(key string, index int, value string) (string, error) {
+	return ca.shard(key).LSet(key, index, value)
+}
+
+// LTrim Trim an existing list so that it will contain only the specified range of elements specified
+func (ca *ShardedRedisCache) LTrim(key string, start int, stop int) (string, error) {
+	return ca.shard(key).LTrim(key, start, stop)
+}
+
+// RPop Removes and returns the last element of the list stored at key
+func (ca *ShardedRedisCache) RPop(key string) (string, error) {
+	return ca.shard(key).RPop(key)
+}
+
+// RPush Insert all the specified values at the tail of the list stored at key.
+func (ca *ShardedRedisCache) RPush(key string, value ...interface{}) (int, error) {
+	return ca.shard(key).RPush(key, value...)
+}
+
+// RPushX Inserts value at the tail of the list stored at key, only if key already exists and holds a list
+func (ca *ShardedRedisCache) RPushX(key string, value ...interface{}) (int, error) {
+	return ca.shard(key).RPushX(key, value...)
+}
+
+// SAdd Add the specified members to the set stored at key
+func (ca *ShardedRedisCache) SAdd(key string, member ...interface{}) (int, error) {
+	return ca.shard(key).SAdd(key, member...)
+}
+
+// SCard Returns the set cardinality (number of elements) of the set stored at key
+func (ca *ShardedRedisCache) SCard(key string) (int, error) {
+	return ca.shard(key).SCard(key)
+}
+
+// SIsMember Returns if member is a member of the set stored at key.
+func (ca *ShardedRedisCache) SIsMember(key string, member string) (bool, error) {
+	return ca.shard(key).SIsMember(key, member)
+}
+
+// SMembers Returns all the members of the set value stored at key.
+func (ca *ShardedRedisCache) SMembers(key string) ([]string, error) {
+	return ca.shard(key).SMembers(key)
+}
+
+// SPop Removes and returns one or more random elements from the set value store at key.
+func (ca *ShardedRedisCache) SPop(key string) (string, error) {
+	return ca.shard(key).SPop(key)
+}
+
+// SRandMember When called with just the key argument, return a random element from the set value stored at key
+func (ca *ShardedRedisCache) SRandMember(key string, count int) ([]string, error) {
+	return ca.shard(key).SRandMember(key, count)
+}
+
+// SRem Remove the specified members from the set stored at key
+func (ca *ShardedRedisCache) SRem(key string, member ...interface{}) (int, error) {
+	return ca.shard(key).SRem(key, member...)
+}
+
+// ZAdd Adds all the specified members with the specified scores to the sorted set stored at key
+func (ca *ShardedRedisCache) ZAdd(key string, score int64, member interface{}) (int, error) {
+	return ca.shard(key).ZAdd(key, score, member)
+}
+
+// ZCount Returns the number of elements in the sorted set at key with a score between min and max
+func (ca *ShardedRedisCache) ZCount(key string, min, max int64) (int, error) {
+	return ca.shard(key).ZCount(key, min, max)
+}
+
+// ZRem Removes the specified members from the sorted set stored at key. Non existing members are ignored.
+func (ca *ShardedRedisCache) ZRem(key string, member ...interface{}) (int, error) {
+	return ca.shard(key).ZRem(key, member...)
+}
+
+// ZCard Returns the sorted set cardinality (number of elements) of the sorted set stored at key.
+func (ca *ShardedRedisCache) ZCard(key string) (int, error) {
+	return ca.shard(key).ZCard(key)
+}
+
+// ZRank Returns the rank of member in the sorted set stored at key, with the scores ordered from low to high
+func (ca *ShardedRedisCache) ZRank(key, member string) (int, error) {
+	return ca.shard(key).ZRank(key, member)
+}
+
+// ZRange Returns the specified range of elements in the sorted set stored at key
+func (ca *ShardedRedisCache) ZRange(key string, start, stop int64) ([]string, error) {
+	return ca.shard(key).ZRange(key, start, stop)
+}
+
+// ZRangeByScore Returns all the elements in the sorted set at key with a score between min and max (including elements with score equal to min or max).
+func (ca *ShardedRedisCache) ZRangeByScore(key string, start, stop string, isWithScores bool) ([]string, error) {
+	return ca.shard(key).ZRangeByScore(key, start, stop, isWithScores)
+}
+
+// ZREVRangeByScore Returns all the elements in the sorted set at key with a score between max and min (including elements with score equal to max or min). In contrary to the default ordering of sorted sets, for this command the elements are considered to be ordered from high to low scores.
+func (ca *ShardedRedisCache) ZREVRangeByScore(key string, max, min string, isWithScores bool) ([]string, error) {
+	return ca.shard(key).ZREVRangeByScore(key, max, min, isWithScores)
+}
+
+// ZRange Returns the specified range of elements in the sorted set stored at key
+func (ca *ShardedRedisCache) ZRevRange(key string, start, stop int64) ([]string, error) {
+	return ca.shard(key).ZRevRange(key, start, stop)
+}
+
+// GetObj get value stored by Set and decode it into result
+// if non-existed or expired, return ErrNotFound
+func (ca *ShardedRedisCache) GetObj(key string, result interface{}) error {
+	return ca.shard(key).GetObj(key, result)
+}
+
+// HGetObj get field value stored by HSet and decode it into result
+// if non-existed, return ErrNotFound
+func (ca *ShardedRedisCache) HGetObj(hashID string, field string, result interface{}) error {
+	return ca.shard(hashID).HGetObj(hashID, field, result)
+}
+
+// MGet returns values of keys, with one MGET per shard,
+// keys which non-existed or expired are not in the returned map.
+func (ca *ShardedRedisCache) MGet(keys ...string) (map[string]interface{}, error) {
+	items := make(map[string]interface{}, len(keys))
+	for shard, shardKeys := range ca.groupKeys(keys) {
+		values, err := shard.MGet(shardKeys...)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			items[key] = value
+		}
+	}
+	return items, nil
+}
+
+// MSet set all items, with one MSET per shard.
+// ttl is second, if ttl is 0, it will be forever
+func (ca *ShardedRedisCache) MSet(items map[string]interface{}, ttl int64) error {
+	groups := make(map[*redisCache]map[string]interface{})
+	for key, value := range items {
+		shard := ca.shard(key)
+		if groups[shard] == nil {
+			groups[shard] = make(map[string]interface{})
+		}
+		groups[shard][key] = value
+	}
+	for shard, shardItems := range groups {
+		if err := shard.MSet(shardItems, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MDelete delete items by given keys, with one DEL per shard.
+func (ca *ShardedRedisCache) MDelete(keys ...string) error {
+	for shard, shardKeys := range ca.groupKeys(keys) {
+		if err := shard.MDelete(shardKeys...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetOrLoad returns value by given key, on a miss it calls loader and sets its value with ttl,
+// the load lock of the distributed mode is on the shard of key.
+func (ca *ShardedRedisCache) GetOrLoad(key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	return ca.shard(key).GetOrLoad(key, ttl, loader)
+}
+
+// SetWithSoftTTL set cache to the shard of key with a soft ttl, softTTL and ttl are second.
+func (ca *ShardedRedisCache) SetWithSoftTTL(key string, value interface{}, softTTL int64, ttl int64) error {
+	return ca.shard(key).SetWithSoftTTL(key, value, softTTL, ttl)
+}
+
+// BLPop BLPOP is a blocking list pop primitive, keys must be on the same shard.
+func (ca *ShardedRedisCache) BLPop(key ...interface{}) (map[string]string, error) {
+	shard, err := ca.keysShard(key...)
+	if err != nil {
+		return nil, err
+	}
+	return shard.BLPop(key...)
+}
+
+// BRPop BRPOP is a blocking list pop primitive, keys must be on the same shard.
+func (ca *ShardedRedisCache) BRPop(key ...interface{}) (map[string]string, error) {
+	shard, err := ca.keysShard(key...)
+	if err != nil {
+		return nil, err
+	}
+	return shard.BRPop(key...)
+}
+
+// BRPopLPush BRPOPLPUSH is a operation like RPOPLPUSH but blocking, source and destination must be on the same shard.
+func (ca *ShardedRedisCache) BRPopLPush(source string, destination string) (string, error) {
+	shard, err := ca.keysShard(source, destination)
+	if err != nil {
+		return "", err
+	}
+	return shard.BRPopLPush(source, destination)
+}
+
+// RPopLPush Atomically returns and removes the last element (tail) of the list stored at source, and pushes the element at the first element (head) of the list stored at destination,
+// source and destination must be on the same shard.
+func (ca *ShardedRedisCache) RPopLPush(source string, destination string) (string, error) {
+	shard, err := ca.keysShard(source, destination)
+	if err != nil {
+		return "", err
+	}
+	return shard.RPopLPush(source, destination)
+}
+
+// SDiff Returns the members of the set resulting from the difference between the first set and all the successive sets,
+// keys must be on the same shard.
+func (ca *ShardedRedisCache) SDiff(key ...interface{}) ([]string, error) {
+	shard, err := ca.keysShard(key...)
+	if err != nil {
+		return nil, err
+	}
+	return shard.SDiff(key...)
+}
+
+// SDiffStore This command is equal to SDIFF, but instead of returning the resulting set, it is stored in destination,
+// destination and keys must be on the same shard.
+func (ca *ShardedRedisCache) SDiffStore(destination string, key ...interface{}) (int, error) {
+	shard, err := ca.keysShard(append([]interface{}{destination}, key...)...)
+	if err != nil {
+		return 0, err
+	}
+	return shard.SDiffStore(destination, key...)
+}
+
+// SInter Returns the members of the set resulting from the intersection of all the given sets,
+// keys must be on the same shard.
+func (ca *ShardedRedisCache) SInter(key ...interface{}) ([]string, error) {
+	shard, err := ca.keysShard(key...)
+	if err != nil {
+		return nil, err
+	}
+	return shard.SInter(key...)
+}
+
+// SInterStore This command is equal to SINTER, but instead of returning the resulting set, it is stored in destination,
+// destination and keys must be on the same shard.
+func (ca *ShardedRedisCache) SInterStore(destination string, key ...interface{}) (int, error) {
+	shard, err := ca.keysShard(append([]interface{}{destination}, key...)...)
+	if err != nil {
+		return 0, err
+	}
+	return shard.SInterStore(destination, key...)
+}
+
+// SMove Move member from the set at source to the set at destination, source and destination must be on the same shard.
+func (ca *ShardedRedisCache) SMove(source string, destination string, member string) (bool, error) {
+	shard, err := ca.keysShard(source, destination)
+	if err != nil {
+		return false, err
+	}
+	return shard.SMove(source, destination, member)
+}
+
+// SUnion Returns the members of the set resulting from the union of all the given sets,
+// keys must be on the same shard.
+func (ca *ShardedRedisCache) SUnion(key ...interface{}) ([]string, error) {
+	shard, err := ca.keysShard(key...)
+	if err != nil {
+		return nil, err
+	}
+	return shard.SUnion(key...)
+}
+
+// SUnionStore This command is equal to SUNION, but instead of returning the resulting set, it is stored in destination,
+// destination and keys must be on the same shard.
+func (ca *ShardedRedisCache) SUnionStore(destination string, key ...interface{}) (int, error) {
+	shard, err := ca.keysShard(append([]interface{}{destination}, key...)...)
+	if err != nil {
+		return 0, err
+	}
+	return shard.SUnionStore(destination, key...)
+}
+
+// Publish Posts a message to the given channel, on the shard of channel like a key.
+func (ca *ShardedRedisCache) Publish(channel string, message interface{}) (int64, error) {
+	return ca.shard(channel).Publish(channel, message)
+}
+
+// Subscribe Subscribes the client to the specified channels, channels must be on the same shard.
+func (ca *ShardedRedisCache) Subscribe(receive chan Message, channels ...interface{}) error {
+	shard, err := ca.keysShard(channels...)
+	if err != nil {
+		return err
+	}
+	return shard.Subscribe(receive, channels...)
+}
+
+// EVAL used to evaluate scripts using the Lua interpreter built into Redis starting from version 2.6.0,
+// the first argsNum args are keys, they must be on the same shard. scripts without keys run on the first shard.
+func (ca *ShardedRedisCache) EVAL(script string, argsNum int, arg ...interface{}) (interface{}, error) {
+	var keys []interface{}
+	if argsNum > 0 && argsNum <= len(arg) {
+		keys = arg[:argsNum]
+	}
+	shard, err := ca.keysShard(keys...)
+	if err != nil {
+		return nil, err
+	}
+	return shard.EVAL(script, argsNum, arg...)
+}
+
+// Ping ping all shards, if success return pong
+func (ca *ShardedRedisCache) Ping() (string, error) {
+	var reply string
+	for _, shard := range ca.shards {
+		var err error
+		if reply, err = shard.Ping(); err != nil {
+			return reply, err
+		}
+	}
+	return reply, nil
+}
+
+// ClearAll will delete all item in all shards.
+func (ca *ShardedRedisCache) ClearAll() error {
+	for _, shard := range ca.shards {
+		if err := shard.ClearAll(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pipeline returns a new Pipeline, commands are grouped by the shard of their keys,
+// and each group is sent in one round-trip. a command whose keys are on different shards gets ErrCrossShard.
+func (ca *ShardedRedisCache) Pipeline() *Pipeline {
+	return &Pipeline{commands: commands{ca: ca.shards[0]}, sharded: ca}
+}
+
+// Tx runs fn on the only shard. the shard of a transaction can not be chosen without keys,
+// so it returns ErrCrossShard with several shards, use Watch or ShardOf(key).Tx instead.
+func (ca *ShardedRedisCache) Tx(fn func(tx *Tx) error) error {
+	if len(ca.shards) != 1 {
+		return ErrCrossShard
+	}
+	return ca.shards[0].Tx(fn)
+}
+
+// Watch is Tx with optimistic locking on the shard of keys, keys must be on the same shard.
+func (ca *ShardedRedisCache) Watch(fn func(tx *Tx) error, keys ...string) error {
+	shard, err := ca.keysShard(stringsToInterfaces(keys)...)
+	if err != nil {
+		return err
+	}
+	return shard.Watch(fn, keys...)
+}
+
+// NewLocker returns a new *Locker, each lock is on the shard of its key
+func (ca *ShardedRedisCache) NewLocker(opts ...LockOption) *Locker {
+	return &Locker{cache: ca.shard, opts: newLockOptions(opts)}
+}
+
+// execPipeline sends commands queued in p to their shards, one round-trip per shard,
+// shards use the read routing if no command of p is a write command.
+func (ca *ShardedRedisCache) execPipeline(p *Pipeline, ctx context.Context) error {
+	cmds, setters, write, err := p.reset()
+	if len(cmds) == 0 {
+		return err
+	}
+	if err != nil {
+		fail(setters, err)
+		return err
+	}
+	var order []*redisCache
+	groups := make(map[*redisCache]*Pipeline)
+	for i, cmd := range cmds {
+		keys := internal.CommandKeys(cmd.Name, cmd.Args)
+		shard, e := ca.keysShard(stringsToInterfaces(keys)...)
+		if e != nil {
+			setters[i](nil, e)
+			if err == nil {
+				err = e
+			}
+			continue
+		}
+		group := groups[shard]
+		if group == nil {
+			group = &Pipeline{commands: commands{ca: shard, write: write}}
+			groups[shard] = group
+			order = append(order, shard)
+		}
+		group.cmds = append(group.cmds, cmd)
+		group.setters = append(group.setters, setters[i])
+	}
+	for _, shard := range order {
+		exec := shard
+		if ctx != nil {
+			exec = shard.withContext(ctx)
+		}
+		if e := groups[shard].exec(exec); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// groupKeys groups keys by the shard holding them.
+func (ca *ShardedRedisCache) groupKeys(keys []string) map[*redisCache][]string {
+	groups := make(map[*redisCache][]string)
+	for _, key := range keys {
+		shard := ca.shard(key)
+		groups[shard] = append(groups[shard], key)
+	}
+	return groups
+}
+
+// keysShard returns the shard holding all keys, the first shard if there is no key,
+// or ErrCrossShard if keys are on different shards.
+func (ca *ShardedRedisCache) keysShard(keys ...interface{}) (*redisCache, error) {
+	var shard *redisCache
+	for _, key := range keys {
+		s := ca.shard(internal.KeyString(key))
+		if shard != nil && s != shard {
+			return nil, ErrCrossShard
+		}
+		shard = s
+	}
+	if shard == nil {
+		return ca.shards[0], nil
+	}
+	return shard, nil
+}
+
+// shard returns the shard holding key.
+func (ca *ShardedRedisCache) shard(key string) *redisCache {
+	return ca.shards[ca.ring.get(key)]
+}
+
+func stringsToInterfaces(keys []string) []interface{} {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	return args
+}
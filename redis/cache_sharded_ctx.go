@@ -0,0 +1,417 @@
+package redis
+
+import "context"
+
+// withContext returns a copy of the cache whose shards are bounded by ctx.
+func (ca *ShardedRedisCache) withContext(ctx context.Context) *ShardedRedisCache {
+	c := *ca
+	c.shards = make([]*redisCache, len(ca.shards))
+	for i, shard := range ca.shards {
+		c.shards[i] = shard.withContext(ctx)
+	}
+	return &c
+}
+
+// ExistsCtx is Exists bounded by ctx.
+func (ca *ShardedRedisCache) ExistsCtx(ctx context.Context, key string) (bool, error) {
+	return ca.shard(key).ExistsCtx(ctx, key)
+}
+
+// GetCtx is Get bounded by ctx.
+func (ca *ShardedRedisCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	return ca.shard(key).GetCtx(ctx, key)
+}
+
+// GetStringCtx is GetString bounded by ctx.
+func (ca *ShardedRedisCache) GetStringCtx(ctx context.Context, key string) (string, error) {
+	return ca.shard(key).GetStringCtx(ctx, key)
+}
+
+// GetIntCtx is GetInt bounded by ctx.
+func (ca *ShardedRedisCache) GetIntCtx(ctx context.Context, key string) (int, error) {
+	return ca.shard(key).GetIntCtx(ctx, key)
+}
+
+// GetInt64Ctx is GetInt64 bounded by ctx.
+func (ca *ShardedRedisCache) GetInt64Ctx(ctx context.Context, key string) (int64, error) {
+	return ca.shard(key).GetInt64Ctx(ctx, key)
+}
+
+// SetCtx is Set bounded by ctx.
+func (ca *ShardedRedisCache) SetCtx(ctx context.Context, key string, v interface{}, ttl int64) error {
+	return ca.shard(key).SetCtx(ctx, key, v, ttl)
+}
+
+// IncrCtx is Incr bounded by ctx.
+func (ca *ShardedRedisCache) IncrCtx(ctx context.Context, key string) (int64, error) {
+	return ca.shard(key).IncrCtx(ctx, key)
+}
+
+// DecrCtx is Decr bounded by ctx.
+func (ca *ShardedRedisCache) DecrCtx(ctx context.Context, key string) (int64, error) {
+	return ca.shard(key).DecrCtx(ctx, key)
+}
+
+// IncrByCtx is IncrBy bounded by ctx.
+func (ca *ShardedRedisCache) IncrByCtx(ctx context.Context, key string, delta int64) (int64, error) {
+	return ca.shard(key).IncrByCtx(ctx, key, delta)
+}
+
+// DecrByCtx is DecrBy bounded by ctx.
+func (ca *ShardedRedisCache) DecrByCtx(ctx context.Context, key string, delta int64) (int64, error) {
+	return ca.shard(key).DecrByCtx(ctx, key, delta)
+}
+
+// IncrByFloatCtx is IncrByFloat bounded by ctx.
+func (ca *ShardedRedisCache) IncrByFloatCtx(ctx context.Context, key string, delta float64) (float64, error) {
+	return ca.shard(key).IncrByFloatCtx(ctx, key, delta)
+}
+
+// DeleteCtx is Delete bounded by ctx.
+func (ca *ShardedRedisCache) DeleteCtx(ctx context.Context, key string) error {
+	return ca.shard(key).DeleteCtx(ctx, key)
+}
+
+// ExpireCtx is Expire bounded by ctx.
+func (ca *ShardedRedisCache) ExpireCtx(ctx context.Context, key string, timeOutSeconds int) (int, error) {
+	return ca.shard(key).ExpireCtx(ctx, key, timeOutSeconds)
+}
+
+// HGetCtx is HGet bounded by ctx.
+func (ca *ShardedRedisCache) HGetCtx(ctx context.Context, hashID string, field string) (string, error) {
+	return ca.shard(hashID).HGetCtx(ctx, hashID, field)
+}
+
+// HMGetCtx is HMGet bounded by ctx.
+func (ca *ShardedRedisCache) HMGetCtx(ctx context.Context, hashID string, field ...interface{}) ([]string, error) {
+	return ca.shard(hashID).HMGetCtx(ctx, hashID, field...)
+}
+
+// HSetCtx is HSet bounded by ctx.
+func (ca *ShardedRedisCache) HSetCtx(ctx context.Context, hashID string, field string, val interface{}) error {
+	return ca.shard(hashID).HSetCtx(ctx, hashID, field, val)
+}
+
+// HGetAllCtx is HGetAll bounded by ctx.
+func (ca *ShardedRedisCache) HGetAllCtx(ctx context.Context, hashID string) (map[string]string, error) {
+	return ca.shard(hashID).HGetAllCtx(ctx, hashID)
+}
+
+// HSetNXCtx is HSetNX bounded by ctx.
+func (ca *ShardedRedisCache) HSetNXCtx(ctx context.Context, hashID string, field string, val string) (string, error) {
+	return ca.shard(hashID).HSetNXCtx(ctx, hashID, field, val)
+}
+
+// HDelCtx is HDel bounded by ctx.
+func (ca *ShardedRedisCache) HDelCtx(ctx context.Context, hashID string, fields ...interface{}) (int, error) {
+	return ca.shard(hashID).HDelCtx(ctx, hashID, fields...)
+}
+
+// HExistsCtx is HExists bounded by ctx.
+func (ca *ShardedRedisCache) HExistsCtx(ctx context.Context, hashID string, field string) (int, error) {
+	return ca.shard(hashID).HExistsCtx(ctx, hashID, field)
+}
+
+// HIncrByCtx is HIncrBy bounded by ctx.
+func (ca *ShardedRedisCache) HIncrByCtx(ctx context.Context, hashID string, field string, increment int) (int, error) {
+	return ca.shard(hashID).HIncrByCtx(ctx, hashID, field, increment)
+}
+
+// HIncrByFloatCtx is HIncrByFloat bounded by ctx.
+func (ca *ShardedRedisCache) HIncrByFloatCtx(ctx context.Context, hashID string, field string, increment float64) (float64, error) {
+	return ca.shard(hashID).HIncrByFloatCtx(ctx, hashID, field, increment)
+}
+
+// HKeysCtx is HKeys bounded by ctx.
+func (ca *ShardedRedisCache) HKeysCtx(ctx context.Context, hashID string) ([]string, error) {
+	return ca.shard(hashID).HKeysCtx(ctx, hashID)
+}
+
+// HLenCtx is HLen bounded by ctx.
+func (ca *ShardedRedisCache) HLenCtx(ctx context.Context, hashID string) (int, error) {
+	return ca.shard(hashID).HLenCtx(ctx, hashID)
+}
+
+// HValsCtx is HVals bounded by ctx.
+func (ca *ShardedRedisCache) HValsCtx(ctx context.Context, hashID string) ([]string, error) {
+	return ca.shard(hashID).HValsCtx(ctx, hashID)
+}
+
+// GetJsonObjCtx is GetJsonObj bounded by ctx.
+func (ca *ShardedRedisCache) GetJsonObjCtx(ctx context.Context, key string, result interface{}) error {
+	return ca.shard(key).GetJsonObjCtx(ctx, key, result)
+}
+
+// SetJsonObjCtx is SetJsonObj bounded by ctx.
+func (ca *ShardedRedisCache) SetJsonObjCtx(ctx context.Context, key string, val interface{}) (interface{}, error) {
+	return ca.shard(key).SetJsonObjCtx(ctx, key, val)
+}
+
+// LIndexCtx is LIndex bounded by ctx.
+func (ca *ShardedRedisCache) LIndexCtx(ctx context.Context, key string, index int) (string, error) {
+	return ca.shard(key).LIndexCtx(ctx, key, index)
+}
+
+// LInsertCtx is LInsert bounded by ctx.
+func (ca *ShardedRedisCache) LInsertCtx(ctx context.Context, key string, direction string, pivot string, value string) (int, error) {
+	return ca.shard(key).LInsertCtx(ctx, key, direction, pivot, value)
+}
+
+// LLenCtx is LLen bounded by ctx.
+func (ca *ShardedRedisCache) LLenCtx(ctx context.Context, key string) (int, error) {
+	return ca.shard(key).LLenCtx(ctx, key)
+}
+
+// LPopCtx is LPop bounded by ctx.
+func (ca *ShardedRedisCache) LPopCtx(ctx context.Context, key string) (string, error) {
+	return ca.shard(key).LPopCtx(ctx, key)
+}
+
+// LPushCtx is LPush bounded by ctx.
+func (ca *ShardedRedisCache) LPushCtx(ctx context.Context, key string, value ...interface{}) (int, error) {
+	return ca.shard(key).LPushCtx(ctx, key, value...)
+}
+
+// LPushXCtx is LPushX bounded by ctx.
+func (ca *ShardedRedisCache) LPushXCtx(ctx context.Context, key string, value string) (int, error) {
+	return ca.shard(key).LPushXCtx(ctx, key, value)
+}
+
+// LRangeCtx is LRange bounded by ctx.
+func (ca *ShardedRedisCache) LRangeCtx(ctx context.Context, key string, start int, end int) ([]string, error) {
+	return ca.shard(key).LRangeCtx(ctx, key, start, end)
+}
+
+// LRemCtx is LRem bounded by ctx.
+func (ca *ShardedRedisCache) LRemCtx(ctx context.Context, key string, count int, value string) (int, error) {
+	return ca.shard(key).LRemCtx(ctx, key, count, value)
+}
+
+// LSetCtx is LSet bounded by ctx.
+func (ca *ShardedRedisCache) LSetCtx(ctx context.Context, key string, index int, value string) (string, error) {
+	return ca.shard(key).LSetCtx(ctx, key, index, value)
+}
+
+// LTrimCtx is LTrim bounded by ctx.
+func (ca *ShardedRedisCache) LTrimCtx(ctx context.Context, key string, start int, stop int) (string, error) {
+	return ca.shard(key).LTrimCtx(ctx, key, start, stop)
+}
+
+// RPopCtx is RPop bounded by ctx.
+func (ca *ShardedRedisCache) RPopCtx(ctx context.Context, key string) (string, error) {
+	return ca.shard(key).RPopCtx(ctx, key)
+}
+
+// RPushCtx is RPush bounded by ctx.
+func (ca *ShardedRedisCache) RPushCtx(ctx context.Context, key string, value ...interface{}) (int, error) {
+	return ca.shard(key).RPushCtx(ctx, key, value...)
+}
+
+// RPushXCtx is RPushX bounded by ctx.
+func (ca *ShardedRedisCache) RPushXCtx(ctx context.Context, key string, value ...interface{}) (int, error) {
+	return ca.shard(key).RPushXCtx(ctx, key, value...)
+}
+
+// SAddCtx is SAdd bounded by ctx.
+func (ca *ShardedRedisCache) SAddCtx(ctx context.Context, key string, value ...interface{}) (int, error) {
+	return ca.shard(key).SAddCtx(ctx, key, value...)
+}
+
+// SCardCtx is SCard bounded by ctx.
+func (ca *ShardedRedisCache) SCardCtx(ctx context.Context, key string) (int, error) {
+	return ca.shard(key).SCardCtx(ctx, key)
+}
+
+// SIsMemberCtx is SIsMember bounded by ctx.
+func (ca *ShardedRedisCache) SIsMemberCtx(ctx context.Context, key string, value string) (bool, error) {
+	return ca.shard(key).SIsMemberCtx(ctx, key, value)
+}
+
+// SMembersCtx is SMembers bounded by ctx.
+func (ca *ShardedRedisCache) SMembersCtx(ctx context.Context, key string) ([]string, error) {
+	return ca.shard(key).SMembersCtx(ctx, key)
+}
+
+// SPopCtx is SPop bounded by ctx.
+func (ca *ShardedRedisCache) SPopCtx(ctx context.Context, key string) (string, error) {
+	return ca.shard(key).SPopCtx(ctx, key)
+}
+
+// SRandMemberCtx is SRandMember bounded by ctx.
+func (ca *ShardedRedisCache) SRandMemberCtx(ctx context.Context, key string, count int) ([]string, error) {
+	return ca.shard(key).SRandMemberCtx(ctx, key, count)
+}
+
+// SRemCtx is SRem bounded by ctx.
+func (ca *ShardedRedisCache) SRemCtx(ctx context.Context, key string, value ...interface{}) (int, error) {
+	return ca.shard(key).SRemCtx(ctx, key, value...)
+}
+
+// ZAddCtx is ZAdd bounded by ctx.
+func (ca *ShardedRedisCache) ZAddCtx(ctx context.Context, key string, score int64, member interface{}) (int, error) {
+	return ca.shard(key).ZAddCtx(ctx, key, score, member)
+}
+
+// ZCountCtx is ZCount bounded by ctx.
+func (ca *ShardedRedisCache) ZCountCtx(ctx context.Context, key string, min, max int64) (int, error) {
+	return ca.shard(key).ZCountCtx(ctx, key, min, max)
+}
+
+// ZRemCtx is ZRem bounded by ctx.
+func (ca *ShardedRedisCache) ZRemCtx(ctx context.Context, key string, member ...interface{}) (int, error) {
+	return ca.shard(key).ZRemCtx(ctx, key, member...)
+}
+
+// ZCardCtx is ZCard bounded by ctx.
+func (ca *ShardedRedisCache) ZCardCtx(ctx context.Context, key string) (int, error) {
+	return ca.shard(key).ZCardCtx(ctx, key)
+}
+
+// ZRankCtx is ZRank bounded by ctx.
+func (ca *ShardedRedisCache) ZRankCtx(ctx context.Context, key, member string) (int, error) {
+	return ca.shard(key).ZRankCtx(ctx, key, member)
+}
+
+// ZRangeCtx is ZRange bounded by ctx.
+func (ca *ShardedRedisCache) ZRangeCtx(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return ca.shard(key).ZRangeCtx(ctx, key, start, stop)
+}
+
+// ZRangeByScoreCtx is ZRangeByScore bounded by ctx.
+func (ca *ShardedRedisCache) ZRangeByScoreCtx(ctx context.Context, key string, start, stop string, isWithScores bool) ([]string, error) {
+	return ca.shard(key).ZRangeByScoreCtx(ctx, key, start, stop, isWithScores)
+}
+
+// ZREVRangeByScoreCtx is ZREVRangeByScore bounded by ctx.
+func (ca *ShardedRedisCache) ZREVRangeByScoreCtx(ctx context.Context, key string, max, min string, isWithScores bool) ([]string, error) {
+	return ca.shard(key).ZREVRangeByScoreCtx(ctx, key, max, min, isWithScores)
+}
+
+// ZRevRangeCtx is ZRevRange bounded by ctx.
+func (ca *ShardedRedisCache) ZRevRangeCtx(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return ca.shard(key).ZRevRangeCtx(ctx, key, start, stop)
+}
+
+// GetObjCtx is GetObj bounded by ctx.
+func (ca *ShardedRedisCache) GetObjCtx(ctx context.Context, key string, result interface{}) error {
+	return ca.shard(key).GetObjCtx(ctx, key, result)
+}
+
+// HGetObjCtx is HGetObj bounded by ctx.
+func (ca *ShardedRedisCache) HGetObjCtx(ctx context.Context, hashID string, field string, result interface{}) error {
+	return ca.shard(hashID).HGetObjCtx(ctx, hashID, field, result)
+}
+
+// ClearAllCtx is ClearAll bounded by ctx.
+func (ca *ShardedRedisCache) ClearAllCtx(ctx context.Context) error {
+	return ca.withContext(ctx).ClearAll()
+}
+
+// MGetCtx is MGet bounded by ctx.
+func (ca *ShardedRedisCache) MGetCtx(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+	return ca.withContext(ctx).MGet(keys...)
+}
+
+// MSetCtx is MSet bounded by ctx.
+func (ca *ShardedRedisCache) MSetCtx(ctx context.Context, items map[string]interface{}, ttl int64) error {
+	return ca.withContext(ctx).MSet(items, ttl)
+}
+
+// MDeleteCtx is MDelete bounded by ctx.
+func (ca *ShardedRedisCache) MDeleteCtx(ctx context.Context, keys ...string) error {
+	return ca.withContext(ctx).MDelete(keys...)
+}
+
+// GetOrLoadCtx is GetOrLoad bounded by ctx.
+func (ca *ShardedRedisCache) GetOrLoadCtx(ctx context.Context, key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	return ca.shard(key).GetOrLoadCtx(ctx, key, ttl, loader)
+}
+
+// SetWithSoftTTLCtx is SetWithSoftTTL bounded by ctx.
+func (ca *ShardedRedisCache) SetWithSoftTTLCtx(ctx context.Context, key string, value interface{}, softTTL int64, ttl int64) error {
+	return ca.shard(key).SetWithSoftTTLCtx(ctx, key, value, softTTL, ttl)
+}
+
+// BLPopCtx is BLPop bounded by ctx.
+func (ca *ShardedRedisCache) BLPopCtx(ctx context.Context, key ...interface{}) (map[string]string, error) {
+	return ca.withContext(ctx).BLPop(key...)
+}
+
+// BRPopCtx is BRPop bounded by ctx.
+func (ca *ShardedRedisCache) BRPopCtx(ctx context.Context, key ...interface{}) (map[string]string, error) {
+	return ca.withContext(ctx).BRPop(key...)
+}
+
+// BRPopLPushCtx is BRPopLPush bounded by ctx.
+func (ca *ShardedRedisCache) BRPopLPushCtx(ctx context.Context, source string, destination string) (string, error) {
+	return ca.withContext(ctx).BRPopLPush(source, destination)
+}
+
+// RPopLPushCtx is RPopLPush bounded by ctx.
+func (ca *ShardedRedisCache) RPopLPushCtx(ctx context.Context, source string, destination string) (string, error) {
+	return ca.withContext(ctx).RPopLPush(source, destination)
+}
+
+// SDiffCtx is SDiff bounded by ctx.
+func (ca *ShardedRedisCache) SDiffCtx(ctx context.Context, key ...interface{}) ([]string, error) {
+	return ca.withContext(ctx).SDiff(key...)
+}
+
+// SDiffStoreCtx is SDiffStore bounded by ctx.
+func (ca *ShardedRedisCache) SDiffStoreCtx(ctx context.Context, destination string, key ...interface{}) (int, error) {
+	return ca.withContext(ctx).SDiffStore(destination, key...)
+}
+
+// SInterCtx is SInter bounded by ctx.
+func (ca *ShardedRedisCache) SInterCtx(ctx context.Context, key ...interface{}) ([]string, error) {
+	return ca.withContext(ctx).SInter(key...)
+}
+
+// SInterStoreCtx is SInterStore bounded by ctx.
+func (ca *ShardedRedisCache) SInterStoreCtx(ctx context.Context, destination string, key ...interface{}) (int, error) {
+	return ca.withContext(ctx).SInterStore(destination, key...)
+}
+
+// SMoveCtx is SMove bounded by ctx.
+func (ca *ShardedRedisCache) SMoveCtx(ctx context.Context, source string, destination string, value string) (bool, error) {
+	return ca.withContext(ctx).SMove(source, destination, value)
+}
+
+// SUnionCtx is SUnion bounded by ctx.
+func (ca *ShardedRedisCache) SUnionCtx(ctx context.Context, key ...interface{}) ([]string, error) {
+	return ca.withContext(ctx).SUnion(key...)
+}
+
+// SUnionStoreCtx is SUnionStore bounded by ctx.
+func (ca *ShardedRedisCache) SUnionStoreCtx(ctx context.Context, destination string, key ...interface{}) (int, error) {
+	return ca.withContext(ctx).SUnionStore(destination, key...)
+}
+
+// PublishCtx is Publish bounded by ctx.
+func (ca *ShardedRedisCache) PublishCtx(ctx context.Context, channel string, message interface{}) (int64, error) {
+	return ca.shard(channel).PublishCtx(ctx, channel, message)
+}
+
+// EVALCtx is EVAL bounded by ctx.
+func (ca *ShardedRedisCache) EVALCtx(ctx context.Context, script string, argsNum int, arg ...interface{}) (interface{}, error) {
+	return ca.withContext(ctx).EVAL(script, argsNum, arg...)
+}
+
+// SubscribeCtx is Subscribe bounded by ctx, channels must be on the same shard.
+func (ca *ShardedRedisCache) SubscribeCtx(ctx context.Context, receive chan Message, channels ...interface{}) error {
+	shard, err := ca.keysShard(channels...)
+	if err != nil {
+		return err
+	}
+	return shard.SubscribeCtx(ctx, receive, channels...)
+}
+
+// TxCtx is Tx bounded by ctx.
+func (ca *ShardedRedisCache) TxCtx(ctx context.Context, fn func(tx *Tx) error) error {
+	return ca.withContext(ctx).Tx(fn)
+}
+
+// WatchCtx is Watch bounded by ctx.
+func (ca *ShardedRedisCache) WatchCtx(ctx context.Context, fn func(tx *Tx) error, keys ...string) error {
+	return ca.withContext(ctx).Watch(fn, keys...)
+}
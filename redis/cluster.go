@@ -0,0 +1,32 @@
+package redis
+
+import (
+	"github.com/devfeel/cache/internal"
+)
+
+var (
+	// ErrCrossSlot is returned in cluster mode by multi-key commands, like SInter, SMove or RPopLPush,
+	// whose keys do not hash to the same slot. use a {hashtag} in keys to put them in the same slot.
+	// MGet, MSet, MDelete and Pipeline are split by slot, they do not return it.
+	ErrCrossSlot = internal.ErrCrossSlot
+	// ErrNoClusterNode is returned by NewClusterRedisCache when no node replies to CLUSTER SLOTS
+	ErrNoClusterNode = internal.ErrNoClusterNode
+)
+
+// NewClusterRedisCache returns a new *RedisCache on a redis cluster, serverUrls are some nodes of the cluster,
+// like "redis://:password@10.0.1.11:7000/0", all nodes use the password of the first url.
+// the slot of each key is computed with CRC16, and commands are sent to the master of the slot,
+// following MOVED and ASK redirections. the map of slots is loaded by CLUSTER SLOTS, and reloaded after MOVED.
+// Tx runs on a single node, use Watch with keys in the same slot.
+func NewClusterRedisCache(serverUrls []string, maxIdle int, maxActive int) (*redisCache, error) {
+	cluster, err := internal.NewCluster(serverUrls, maxIdle, maxActive)
+	if err != nil {
+		return nil, err
+	}
+	return newRedisCache(redisCache{cluster: cluster, maxIdle: maxIdle, maxActive: maxActive}), nil
+}
+
+// KeySlot returns the cluster slot of key, only the {hashtag} of key is hashed if it has a non-empty one
+func KeySlot(key string) int {
+	return internal.KeySlot(key)
+}
@@ -0,0 +1,153 @@
+package redis
+
+import (
+	"reflect"
+	"strconv"
+
+	"github.com/devfeel/cache/codec"
+	"github.com/garyburd/redigo/redis"
+)
+
+// SetCodec set codec used to encode values, default is codec.JSONCodec
+// values stored by Set, HSet, LPush, RPush, RPushX and SAdd are encoded by it,
+// except string, []byte, number and bool, which are stored as they are.
+func (ca *redisCache) SetCodec(c codec.Codec) {
+	if c != nil {
+		ca.codec = c
+	}
+}
+
+// GetObj get value stored by Set and decode it into result
+// if non-existed or expired, return ErrNotFound
+func (ca *redisCache) GetObj(key string, result interface{}) error {
+	reply, err := ca.getReply(key)
+	return ca.decodeReply(reply, err, result)
+}
+
+// HGetObj get field value stored by HSet and decode it into result
+// if non-existed, return ErrNotFound
+func (ca *redisCache) HGetObj(hashID string, field string, result interface{}) error {
+	client := ca.getReadRedisClient()
+	reply, err := client.HGetObj(hashID, field)
+	if ca.checkConnErrorAndNeedRetry(err) {
+		client = ca.getBackupRedis()
+		reply, err = client.HGetObj(hashID, field)
+	}
+	return ca.decodeReply(reply, err, result)
+}
+
+// Decode decode data returned by commands like LPop, LRange or SMembers into result
+func (ca *redisCache) Decode(data string, result interface{}) error {
+	return ca.decode(decompress([]byte(data)), result)
+}
+
+func (ca *redisCache) decodeReply(reply interface{}, err error, result interface{}) error {
+	data, err := redis.Bytes(reply, err)
+	if err == redis.ErrNil {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return ca.decode(decompress(data), result)
+}
+
+// encode returns the text form of string, number and bool values, named types included,
+// []byte as it is, and the encoding by codec for other values
+func (ca *redisCache) encode(value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case nil, string, []byte:
+		return value, nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Bool:
+		// same as redigo
+		if rv.Bool() {
+			return "1", nil
+		}
+		return "0", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(rv.Float(), 'g', -1, rv.Type().Bits()), nil
+	}
+	return ca.codec.Marshal(value)
+}
+
+func (ca *redisCache) encodeValues(values []interface{}) ([]interface{}, error) {
+	encoded := make([]interface{}, len(values))
+	for i, value := range values {
+		v, err := ca.encode(value)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = v
+	}
+	return encoded, nil
+}
+
+// decode is the reverse of encode, scalar results are parsed, others are decoded by codec
+// return ErrTypeMismatch if data can not be parsed as a scalar result
+func (ca *redisCache) decode(data []byte, result interface{}) error {
+	switch r := result.(type) {
+	case *string:
+		*r = string(data)
+		return nil
+	case *[]byte:
+		*r = append([]byte(nil), data...)
+		return nil
+	}
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || !isScalar(rv.Elem().Kind()) {
+		return ca.codec.Unmarshal(data, result)
+	}
+	elem := rv.Elem()
+	s := string(data)
+	switch elem.Kind() {
+	case reflect.String:
+		elem.SetString(s)
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return ErrTypeMismatch
+		}
+		elem.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, elem.Type().Bits())
+		if err != nil {
+			return ErrTypeMismatch
+		}
+		elem.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(s, 10, elem.Type().Bits())
+		if err != nil {
+			return ErrTypeMismatch
+		}
+		elem.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, elem.Type().Bits())
+		if err != nil {
+			return ErrTypeMismatch
+		}
+		elem.SetFloat(f)
+	}
+	return nil
+}
+
+// isScalar reports whether values of kind are stored as their text form by encode
+func isScalar(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
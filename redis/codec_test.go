@@ -0,0 +1,40 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/devfeel/cache/codec"
+)
+
+type codecStatus int
+
+func (s codecStatus) String() string {
+	return "status"
+}
+
+func TestRedisCache_EncodeDecode(t *testing.T) {
+	ca := &redisCache{codec: codec.JSONCodec{}}
+	v, _ := ca.encode(codecStatus(3))
+	if v != "3" {
+		t.Error("TestRedisCache_EncodeDecode named int expect 3, got", v)
+	}
+	var status codecStatus
+	if err := ca.decode([]byte("3"), &status); err != nil || status != 3 {
+		t.Error("TestRedisCache_EncodeDecode expect 3, got", status, err)
+	}
+	var b bool
+	v, _ = ca.encode(true)
+	if err := ca.Decode(v.(string), &b); err != nil || !b {
+		t.Error("TestRedisCache_EncodeDecode expect true, got", b, err)
+	}
+	type user struct{ Name string }
+	v, _ = ca.encode(user{Name: "devfeel"})
+	var u user
+	if err := ca.decode(v.([]byte), &u); err != nil || u.Name != "devfeel" {
+		t.Error("TestRedisCache_EncodeDecode expect devfeel, got", u, err)
+	}
+	var i int
+	if err := ca.Decode("abc", &i); err != ErrTypeMismatch {
+		t.Error("TestRedisCache_EncodeDecode expect ErrTypeMismatch, got", err)
+	}
+}
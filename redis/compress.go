@@ -0,0 +1,169 @@
+package redis
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// Compression is the algorithm used to compress large values.
+type Compression byte
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZlib
+	CompressionSnappy
+)
+
+const (
+	// DefaultCompressThreshold is used by SetCompression when threshold <= 0, unit is byte
+	DefaultCompressThreshold = 1024
+	// compressMagic starts every compressed value, followed by the Compression byte,
+	// the crc32 of the original value and the compressed value.
+	// 0xC1 never starts a valid utf-8 text or a json value, but may start a protobuf or a raw []byte value,
+	// so a value is only read as compressed if the crc32 of its decompressed value matches.
+	compressMagic = "\xC1\xDC\xAC\x5E"
+	// compressHeaderSize is the size of compressMagic, the Compression byte and the crc32
+	compressHeaderSize = len(compressMagic) + 1 + 4
+)
+
+// SetCompression set compression used for values larger than threshold bytes, default is CompressionNone
+// values stored by Set, SetJsonObj, HSet, LPush, RPush and RPushX are compressed,
+// compressed values are flagged with a header, so they are read correctly whatever the current compression is.
+// if threshold <= 0, use DefaultCompressThreshold
+func (ca *redisCache) SetCompression(compression Compression, threshold int) {
+	if threshold <= 0 {
+		threshold = DefaultCompressThreshold
+	}
+	ca.compression = compression
+	ca.compressThreshold = threshold
+}
+
+// compress returns the compressed form of value if it is a string or []byte larger than threshold,
+// else value as it is
+func (ca *redisCache) compress(value interface{}) interface{} {
+	if ca.compression == CompressionNone {
+		return value
+	}
+	var data []byte
+	switch v := value.(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return value
+	}
+	if len(data) < ca.compressThreshold {
+		return value
+	}
+	compressed, err := compressBytes(ca.compression, data)
+	if err != nil || len(compressed) >= len(data) {
+		return value
+	}
+	return compressed
+}
+
+func (ca *redisCache) compressValues(values []interface{}) []interface{} {
+	for i, value := range values {
+		values[i] = ca.compress(value)
+	}
+	return values
+}
+
+func compressBytes(compression Compression, data []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+	buf.WriteString(compressMagic)
+	buf.WriteByte(byte(compression))
+	binary.Write(buf, binary.BigEndian, crc32.ChecksumIEEE(data))
+	switch compression {
+	case CompressionGzip:
+		w := gzip.NewWriter(buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case CompressionZlib:
+		w := zlib.NewWriter(buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	case CompressionSnappy:
+		buf.Write(snappy.Encode(nil, data))
+	default:
+		return data, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress returns the original value of data compressed by compress,
+// data without header, or which fails to decompress, or whose crc32 does not match, is returned as it is.
+func decompress(data []byte) []byte {
+	if len(data) < compressHeaderSize || string(data[:len(compressMagic)]) != compressMagic {
+		return data
+	}
+	payload := data[compressHeaderSize:]
+	var original []byte
+	var err error
+	switch Compression(data[len(compressMagic)]) {
+	case CompressionGzip:
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(payload)); err == nil {
+			original, err = io.ReadAll(r)
+		}
+	case CompressionZlib:
+		var r io.ReadCloser
+		if r, err = zlib.NewReader(bytes.NewReader(payload)); err == nil {
+			original, err = io.ReadAll(r)
+		}
+	case CompressionSnappy:
+		original, err = snappy.Decode(nil, payload)
+	default:
+		return data
+	}
+	if err != nil || crc32.ChecksumIEEE(original) != binary.BigEndian.Uint32(data[len(compressMagic)+1:]) {
+		return data
+	}
+	return original
+}
+
+func decompressString(s string) string {
+	if !strings.HasPrefix(s, compressMagic) {
+		return s
+	}
+	return string(decompress([]byte(s)))
+}
+
+func decompressStrings(values []string) []string {
+	for i, v := range values {
+		values[i] = decompressString(v)
+	}
+	return values
+}
+
+func decompressStringMap(values map[string]string) map[string]string {
+	for k, v := range values {
+		values[k] = decompressString(v)
+	}
+	return values
+}
+
+// decompressReply decompresses a bulk string reply
+func decompressReply(reply interface{}) interface{} {
+	if data, ok := reply.([]byte); ok {
+		return decompress(data)
+	}
+	return reply
+}
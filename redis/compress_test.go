@@ -0,0 +1,51 @@
+package redis
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+func TestRedisCache_Compress(t *testing.T) {
+	page := strings.Repeat("<div>devfeel cache</div>", 100)
+	for _, compression := range []Compression{CompressionGzip, CompressionZlib, CompressionSnappy} {
+		ca := &redisCache{}
+		ca.SetCompression(compression, 0)
+		compressed, ok := ca.compress(page).([]byte)
+		if !ok || len(compressed) >= len(page) || !strings.HasPrefix(string(compressed), compressMagic) {
+			t.Error("TestRedisCache_Compress", compression, "expect compressed value")
+			continue
+		}
+		if v := decompressString(string(compressed)); v != page {
+			t.Error("TestRedisCache_Compress", compression, "expect original value after decompress")
+		}
+		if v := ca.compress("small"); v != "small" {
+			t.Error("TestRedisCache_Compress", compression, "expect small value not compressed, got", v)
+		}
+	}
+	// old values and values with a fake header are read as they are
+	for _, v := range []string{page, "", "a", compressMagic + string([]byte{byte(CompressionGzip), 1, 2})} {
+		if decompressString(v) != v {
+			t.Error("TestRedisCache_Compress expect uncompressed value unchanged", v)
+		}
+	}
+}
+
+func TestRedisCache_CompressLookalike(t *testing.T) {
+	// raw values which decompress by snappy, without the magic, or with a wrong crc32
+	payload := snappy.Encode(nil, []byte("devfeel"))
+	values := [][]byte{
+		append([]byte{0xC1, byte(CompressionSnappy)}, payload...),
+		append(append([]byte(compressMagic), byte(CompressionSnappy), 0, 0, 0, 0), payload...),
+	}
+	for _, v := range values {
+		if d := decompress(v); !bytes.Equal(d, v) {
+			t.Errorf("TestRedisCache_CompressLookalike expect %q unchanged, got %q", v, d)
+		}
+		if d := decompressString(string(v)); d != string(v) {
+			t.Errorf("TestRedisCache_CompressLookalike expect string %q unchanged, got %q", v, d)
+		}
+	}
+}
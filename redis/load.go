@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// loadLockSuffix is appended to a key to get the key of its load lock
+	loadLockSuffix = ":loadlock"
+	// loadRetryInterval is the interval between two reads of a value loaded by another process
+	loadRetryInterval = 20 * time.Millisecond
+)
+
+// SetLoadLock enable the distributed mode of GetOrLoad, 0 disables it, default is disabled.
+// a miss is loaded by the process holding the lock "key:loadlock", which is extended while the loader runs,
+// other processes read the value every 20ms, and take the lock if it is released before the value is set.
+func (ca *redisCache) SetLoadLock(ttl time.Duration) {
+	ca.loadLockTTL = ttl
+}
+
+// GetOrLoad returns value by given key, on a miss it calls loader and sets its value with ttl.
+// concurrent misses of the same key in the process wait for one loader call and share its result,
+// with SetLoadLock, only one process of all processes sharing the server calls it.
+// the value returned by loader is returned like Get, as the []byte stored in redis, so hits and misses have the same type.
+// if loader returns an error or a nil value, nothing is set.
+func (ca *redisCache) GetOrLoad(key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	if v, err := ca.Get(key); v != nil || (err != nil && err != ErrNotFound) {
+		return v, err
+	}
+	return ca.loads.Do(key, func() (interface{}, error) {
+		if ca.loadLockTTL > 0 {
+			return ca.lockedLoad(key, ttl, loader)
+		}
+		return ca.load(key, ttl, loader)
+	})
+}
+
+// load calls loader, sets its value and returns it encoded, like Get
+func (ca *redisCache) load(key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	v, err := loader()
+	if err != nil || v == nil {
+		return v, err
+	}
+	value, err := ca.encode(v)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	switch e := value.(type) {
+	case string:
+		data = []byte(e)
+	case []byte:
+		data = e
+	}
+	return data, ca.setValue(key, ca.compress(value), ttl)
+}
+
+// lockedLoad loads key while holding its load lock, or waits for the value loaded by the holder
+func (ca *redisCache) lockedLoad(key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	ctx := ca.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	locker := ca.NewLocker()
+	timer := time.NewTimer(loadRetryInterval)
+	defer timer.Stop()
+	for {
+		lock, err := tryLock(ctx, locker, key+loadLockSuffix, ca.loadLockTTL)
+		if err == nil {
+			defer lock.Unlock()
+			// the value may be set by the previous holder
+			if v, err := ca.Get(key); v != nil || (err != nil && err != ErrNotFound) {
+				return v, err
+			}
+			return ca.load(key, ttl, loader)
+		}
+		if err != ErrLockNotObtained {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+			timer.Reset(loadRetryInterval)
+		}
+		if v, err := ca.Get(key); v != nil || (err != nil && err != ErrNotFound) {
+			return v, err
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+var (
+	// ErrLockNotObtained is returned by TryLock when the lock is held by another owner
+	ErrLockNotObtained = errors.New("cache: lock not obtained")
+	// ErrLockNotHeld is returned by Unlock when the lock is expired or released
+	ErrLockNotHeld = errors.New("cache: lock not held")
+	// ErrLockTTL is returned when the ttl of a lock is less than 1ms
+	ErrLockTTL = errors.New("cache: lock ttl must be at least 1ms")
+)
+
+const (
+	// DefaultLockRetryInterval is the interval between two attempts of Lock
+	DefaultLockRetryInterval = 100 * time.Millisecond
+
+	// releaseScript deletes the key only if it still holds the token of the owner
+	releaseScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+	// extendScript resets the ttl only if the key still holds the token of the owner
+	extendScript = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`
+)
+
+type (
+	// DistLocker is implemented by Locker and Redlock, so code can switch between them
+	DistLocker interface {
+		// TryLock tries to obtain the lock once, return ErrLockNotObtained if it is held by another owner
+		TryLock(key string, ttl time.Duration) (*Lock, error)
+		// Lock waits until the lock is obtained
+		Lock(key string, ttl time.Duration) (*Lock, error)
+		// LockCtx waits until the lock is obtained or ctx is done
+		LockCtx(ctx context.Context, key string, ttl time.Duration) (*Lock, error)
+	}
+
+	// LockOption configures a Locker or Redlock
+	LockOption func(*lockOptions)
+
+	lockOptions struct {
+		retryInterval time.Duration
+		autoExtend    bool
+	}
+
+	// lockBackend acquires, extends and releases a key holding a token, it is implemented by Locker and Redlock.
+	// acquire and extend return the time the lock stays valid, 0 if not obtained.
+	lockBackend interface {
+		acquire(ctx context.Context, key string, token string, ttl time.Duration) (time.Duration, error)
+		extend(ctx context.Context, key string, token string, ttl time.Duration) (time.Duration, error)
+		release(ctx context.Context, key string, token string) (bool, error)
+		options() *lockOptions
+	}
+)
+
+// WithLockRetryInterval set the interval between two attempts of Lock, default is DefaultLockRetryInterval
+func WithLockRetryInterval(interval time.Duration) LockOption {
+	return func(o *lockOptions) {
+		if interval > 0 {
+			o.retryInterval = interval
+		}
+	}
+}
+
+// WithAutoExtend set whether the lease is extended automatically while the lock is held, default is true
+func WithAutoExtend(autoExtend bool) LockOption {
+	return func(o *lockOptions) {
+		o.autoExtend = autoExtend
+	}
+}
+
+func newLockOptions(opts []LockOption) *lockOptions {
+	o := &lockOptions{retryInterval: DefaultLockRetryInterval, autoExtend: true}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Locker is a distributed lock on the default redis server.
+// the key holds a random token of the owner, so only the owner can extend or release it.
+type Locker struct {
+	// cache returns the cache holding the lock of key
+	cache func(key string) *redisCache
+	opts  *lockOptions
+}
+
+// NewLocker returns a new *Locker on the default server of the cache
+func (ca *redisCache) NewLocker(opts ...LockOption) *Locker {
+	return &Locker{cache: func(string) *redisCache { return ca }, opts: newLockOptions(opts)}
+}
+
+// TryLock tries to obtain the lock once, return ErrLockNotObtained if it is held by another owner.
+// ttl is the lease of the lock, it is extended automatically while held unless WithAutoExtend(false).
+func (l *Locker) TryLock(key string, ttl time.Duration) (*Lock, error) {
+	return tryLock(context.Background(), l, key, ttl)
+}
+
+// Lock waits until the lock is obtained.
+func (l *Locker) Lock(key string, ttl time.Duration) (*Lock, error) {
+	return obtainLock(context.Background(), l, key, ttl)
+}
+
+// LockCtx waits until the lock is obtained or ctx is done.
+func (l *Locker) LockCtx(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	return obtainLock(ctx, l, key, ttl)
+}
+
+func (l *Locker) acquire(ctx context.Context, key string, token string, ttl time.Duration) (time.Duration, error) {
+	start := time.Now()
+	ok, err := l.cache(key).withContext(ctx).getDefaultRedis().SetNXWithExpire(key, token, ttl)
+	if err != nil || !ok {
+		return 0, err
+	}
+	return ttl - time.Since(start), nil
+}
+
+func (l *Locker) extend(ctx context.Context, key string, token string, ttl time.Duration) (time.Duration, error) {
+	start := time.Now()
+	reply, err := redis.Int(l.cache(key).withContext(ctx).getDefaultRedis().EVAL(extendScript, 1, key, token, int64(ttl/time.Millisecond)))
+	if err != nil || reply == 0 {
+		return 0, err
+	}
+	return ttl - time.Since(start), nil
+}
+
+func (l *Locker) release(ctx context.Context, key string, token string) (bool, error) {
+	reply, err := redis.Int(l.cache(key).withContext(ctx).getDefaultRedis().EVAL(releaseScript, 1, key, token))
+	return reply == 1, err
+}
+
+func (l *Locker) options() *lockOptions {
+	return l.opts
+}
+
+// Lock is a lock obtained by Locker or Redlock, it must be released by Unlock
+type Lock struct {
+	backend lockBackend
+	key     string
+	token   string
+	ttl     time.Duration
+
+	mu       sync.Mutex
+	validity time.Time
+	released bool
+	done     chan struct{}
+	lost     chan struct{}
+	lostOnce sync.Once
+}
+
+// tryLock makes one attempt to obtain key
+func tryLock(ctx context.Context, backend lockBackend, key string, ttl time.Duration) (*Lock, error) {
+	if ttl < time.Millisecond {
+		return nil, ErrLockTTL
+	}
+	token, err := newLockToken()
+	if err != nil {
+		return nil, err
+	}
+	validity, err := backend.acquire(ctx, key, token, ttl)
+	if err != nil {
+		return nil, err
+	}
+	if validity <= 0 {
+		return nil, ErrLockNotObtained
+	}
+	lock := &Lock{
+		backend:  backend,
+		key:      key,
+		token:    token,
+		ttl:      ttl,
+		validity: time.Now().Add(validity),
+		done:     make(chan struct{}),
+		lost:     make(chan struct{}),
+	}
+	if backend.options().autoExtend {
+		go lock.keepalive()
+	}
+	return lock, nil
+}
+
+// obtainLock retries tryLock until it is obtained or ctx is done
+func obtainLock(ctx context.Context, backend lockBackend, key string, ttl time.Duration) (*Lock, error) {
+	var timer *time.Timer
+	for {
+		lock, err := tryLock(ctx, backend, key, ttl)
+		if err != ErrLockNotObtained {
+			return lock, err
+		}
+		if timer == nil {
+			timer = time.NewTimer(backend.options().retryInterval)
+			defer timer.Stop()
+		} else {
+			timer.Reset(backend.options().retryInterval)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func newLockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Key returns the key of the lock
+func (lock *Lock) Key() string {
+	return lock.key
+}
+
+// Token returns the random token of the owner
+func (lock *Lock) Token() string {
+	return lock.token
+}
+
+// Lost returns a channel which is closed when the lock is lost, because its lease expired or it was taken by another owner.
+// it is detected by Extend, so it is not closed with WithAutoExtend(false) unless Extend is called. it is never closed by Unlock.
+func (lock *Lock) Lost() <-chan struct{} {
+	return lock.lost
+}
+
+// Extend resets the lease of the lock to its ttl, return ErrLockNotHeld if it is expired or released
+func (lock *Lock) Extend() error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.released {
+		return ErrLockNotHeld
+	}
+	validity, err := lock.backend.extend(context.Background(), lock.key, lock.token, lock.ttl)
+	if err != nil {
+		if time.Now().After(lock.validity) {
+			lock.markLost()
+		}
+		return err
+	}
+	if validity <= 0 {
+		lock.markLost()
+		return ErrLockNotHeld
+	}
+	lock.validity = time.Now().Add(validity)
+	return nil
+}
+
+// Unlock releases the lock and stops the lease extension, return ErrLockNotHeld if it is expired or released
+func (lock *Lock) Unlock() error {
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lock.released {
+		return ErrLockNotHeld
+	}
+	lock.released = true
+	close(lock.done)
+	ok, err := lock.backend.release(context.Background(), lock.key, lock.token)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+// keepalive extends the lease every third of ttl until the lock is released or lost
+func (lock *Lock) keepalive() {
+	ticker := time.NewTicker(lock.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-lock.done:
+			return
+		case <-lock.lost:
+			return
+		case <-ticker.C:
+			lock.Extend()
+		}
+	}
+}
+
+// markLost closes the lost channel once, the caller must hold mu
+func (lock *Lock) markLost() {
+	lock.lostOnce.Do(func() {
+		close(lock.lost)
+	})
+}
@@ -0,0 +1,114 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memLockBackend is an in-memory lockBackend to test Lock without redis
+type memLockBackend struct {
+	mu     sync.Mutex
+	tokens map[string]string
+	fail   error
+	opts   *lockOptions
+}
+
+func (b *memLockBackend) acquire(ctx context.Context, key string, token string, ttl time.Duration) (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.tokens[key]; ok {
+		return 0, nil
+	}
+	b.tokens[key] = token
+	return ttl, nil
+}
+
+func (b *memLockBackend) extend(ctx context.Context, key string, token string, ttl time.Duration) (time.Duration, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.fail != nil {
+		return 0, b.fail
+	}
+	if b.tokens[key] != token {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+func (b *memLockBackend) release(ctx context.Context, key string, token string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens[key] != token {
+		return false, nil
+	}
+	delete(b.tokens, key)
+	return true, nil
+}
+
+func (b *memLockBackend) options() *lockOptions {
+	return b.opts
+}
+
+func TestLock_TryLockUnlock(t *testing.T) {
+	b := &memLockBackend{tokens: map[string]string{}, opts: newLockOptions([]LockOption{WithAutoExtend(false)})}
+	lock, err := tryLock(context.Background(), b, "lock", time.Second)
+	if err != nil || lock.Token() == "" {
+		t.Fatal("TestLock_TryLockUnlock expect lock, got", err)
+	}
+	if _, err := tryLock(context.Background(), b, "lock", time.Second); err != ErrLockNotObtained {
+		t.Error("TestLock_TryLockUnlock expect ErrLockNotObtained, got", err)
+	}
+	if _, err := tryLock(context.Background(), b, "lock", 0); err != ErrLockTTL {
+		t.Error("TestLock_TryLockUnlock expect ErrLockTTL, got", err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Error("TestLock_TryLockUnlock Unlock expect nil, got", err)
+	}
+	if err := lock.Unlock(); err != ErrLockNotHeld {
+		t.Error("TestLock_TryLockUnlock second Unlock expect ErrLockNotHeld, got", err)
+	}
+}
+
+func TestLock_Wait(t *testing.T) {
+	b := &memLockBackend{tokens: map[string]string{"lock": "other"}, opts: newLockOptions([]LockOption{WithLockRetryInterval(time.Millisecond)})}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := obtainLock(ctx, b, "lock", time.Second); err != context.DeadlineExceeded {
+		t.Error("TestLock_Wait expect DeadlineExceeded, got", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.release(context.Background(), "lock", "other")
+	}()
+	lock, err := obtainLock(context.Background(), b, "lock", time.Second)
+	if err != nil {
+		t.Fatal("TestLock_Wait expect lock, got", err)
+	}
+	lock.Unlock()
+}
+
+func TestLock_Lost(t *testing.T) {
+	b := &memLockBackend{tokens: map[string]string{}, opts: newLockOptions(nil)}
+	lock, _ := tryLock(context.Background(), b, "lock", 30*time.Millisecond)
+	b.mu.Lock()
+	b.tokens["lock"] = "other"
+	b.mu.Unlock()
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Error("TestLock_Lost lock taken by another owner should be lost")
+	}
+
+	lock, _ = tryLock(context.Background(), b, "lock2", 30*time.Millisecond)
+	b.mu.Lock()
+	b.fail = errors.New("conn error")
+	b.mu.Unlock()
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Error("TestLock_Lost lock not extended before expiry should be lost")
+	}
+}
@@ -0,0 +1,313 @@
+package redis
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devfeel/cache/internal"
+	resp3 "github.com/devfeel/cache/internal/redigo/redis"
+	"github.com/devfeel/cache/runtime"
+)
+
+const (
+	// DefaultNearCacheTTL is the ttl in seconds of local copies of a near cache
+	DefaultNearCacheTTL = 300
+	// DefaultNearCacheMaxEntries is the max number of local copies of a near cache, the least recently used are evicted
+	DefaultNearCacheMaxEntries = 10000
+
+	// nearRetryInterval is the delay before dialing the tracking connection again
+	nearRetryInterval = time.Second
+	nearDialTimeout   = 5 * time.Second
+)
+
+var errNearCacheClosed = errors.New("cache: near cache is closed")
+
+type (
+	// NearCacheOption configures a RedisCache created by NewNearRedisCache
+	NearCacheOption func(*nearCacheOptions)
+
+	nearCacheOptions struct {
+		ttl        int64
+		maxEntries int
+		prefixes   []string
+	}
+)
+
+// WithNearCacheTTL sets the ttl in seconds of local copies, DefaultNearCacheTTL by default.
+// copies are evicted by invalidation messages, the ttl only bounds the memory of keys rarely read.
+func WithNearCacheTTL(ttl int64) NearCacheOption {
+	return func(o *nearCacheOptions) {
+		if ttl > 0 {
+			o.ttl = ttl
+		}
+	}
+}
+
+// WithNearCacheMaxEntries sets the max number of local copies, DefaultNearCacheMaxEntries by default.
+func WithNearCacheMaxEntries(maxEntries int) NearCacheOption {
+	return func(o *nearCacheOptions) {
+		if maxEntries > 0 {
+			o.maxEntries = maxEntries
+		}
+	}
+}
+
+// WithNearCachePrefixes limits the near cache to keys starting with one of prefixes,
+// the server only sends invalidation messages for them, other keys are always read from the server.
+func WithNearCachePrefixes(prefixes ...string) NearCacheOption {
+	return func(o *nearCacheOptions) {
+		o.prefixes = append(o.prefixes, prefixes...)
+	}
+}
+
+// nearCache keeps local copies of values read by GET, it enables CLIENT TRACKING in broadcasting mode
+// on a RESP3 connection, and evicts copies of keys of the invalidation messages pushed by the server.
+type nearCache struct {
+	serverUrl string
+	opts      *nearCacheOptions
+	local     *runtime.RuntimeCache
+
+	// mu orders copies with invalidations, gen counts invalidations and reconnections,
+	// a value read from the server is not copied if gen changed during the read.
+	// ready is false while the tracking connection is down, nothing is copied then.
+	mu     sync.Mutex
+	gen    uint64
+	ready  bool
+	conn   resp3.Conn
+	closed bool
+	done   chan struct{}
+}
+
+// NewNearRedisCache returns a new *RedisCache keeping local copies of values read by Get, GetString,
+// GetInt, GetInt64, GetObj, GetJsonObj and MGet, which are read from the default server.
+// it needs redis 6.0 or later, copies are evicted when the server pushes invalidation messages,
+// and when the cache changes the keys by Set, MSet, counters, Delete, MDelete and Expire.
+// while the tracking connection is down, the copies are cleared and reads go to the server.
+func NewNearRedisCache(serverUrl string, maxIdle int, maxActive int, opts ...NearCacheOption) (*redisCache, error) {
+	o := &nearCacheOptions{ttl: DefaultNearCacheTTL, maxEntries: DefaultNearCacheMaxEntries}
+	for _, opt := range opts {
+		opt(o)
+	}
+	near := &nearCache{
+		serverUrl: serverUrl,
+		opts:      o,
+		local:     runtime.NewRuntimeCache(runtime.WithMaxEntries(o.maxEntries)),
+		done:      make(chan struct{}),
+	}
+	conn, err := near.track()
+	if err != nil {
+		near.local.Close()
+		return nil, err
+	}
+	go near.run(conn)
+	client := internal.RetainRedisClient(serverUrl, maxIdle, maxActive)
+	return newRedisCache(redisCache{serverUrl: serverUrl, client: client, maxIdle: maxIdle, maxActive: maxActive, near: near}), nil
+}
+
+// track dials the tracking connection with RESP3 and enables CLIENT TRACKING in broadcasting mode
+func (n *nearCache) track() (resp3.Conn, error) {
+	conn, err := resp3.DialURL(n.serverUrl, resp3.DialProtocol(3), resp3.DialConnectTimeout(nearDialTimeout))
+	if err != nil {
+		return nil, err
+	}
+	args := []interface{}{"TRACKING", "ON", "BCAST"}
+	for _, prefix := range n.opts.prefixes {
+		args = append(args, "PREFIX", prefix)
+	}
+	if _, err := conn.Do("CLIENT", args...); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		conn.Close()
+		return nil, errNearCacheClosed
+	}
+	n.conn = conn
+	n.ready = true
+	n.gen++
+	return conn, nil
+}
+
+// run receives invalidation messages, and dials again when the tracking connection fails, until close
+func (n *nearCache) run(conn resp3.Conn) {
+	for {
+		n.receive(conn)
+		n.mu.Lock()
+		n.ready = false
+		n.mu.Unlock()
+		// messages may be lost until tracking is enabled again
+		n.evictAll()
+		for {
+			select {
+			case <-n.done:
+				return
+			case <-time.After(nearRetryInterval):
+			}
+			var err error
+			if conn, err = n.track(); err == nil {
+				break
+			}
+		}
+	}
+}
+
+// receive evicts the keys of invalidation messages until conn fails,
+// a null list of keys means the server flushed its databases
+func (n *nearCache) receive(conn resp3.Conn) {
+	for {
+		reply, err := conn.Receive()
+		if err != nil {
+			return
+		}
+		p, ok := reply.(resp3.Push)
+		if !ok || p.Kind != "invalidate" || len(p.Data) == 0 {
+			continue
+		}
+		if p.Data[0] == nil {
+			n.evictAll()
+			continue
+		}
+		keys, err := resp3.Strings(p.Data[0], nil)
+		if err != nil {
+			n.evictAll()
+			continue
+		}
+		n.evict(keys...)
+	}
+}
+
+// cacheable returns true if key matches the prefixes of the near cache
+func (n *nearCache) cacheable(key string) bool {
+	if len(n.opts.prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range n.opts.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns a copy of the local value of key
+func (n *nearCache) get(key string) ([]byte, bool) {
+	if !n.cacheable(key) {
+		return nil, false
+	}
+	v, _ := n.local.Get(key)
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), b...), true
+}
+
+func (n *nearCache) generation() uint64 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.gen
+}
+
+// fill copies the replies of keys read from the server, unless tracking is down or gen changed
+func (n *nearCache) fill(gen uint64, items map[string]interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.ready || n.gen != gen {
+		return
+	}
+	for key, reply := range items {
+		if b, ok := reply.([]byte); ok && n.cacheable(key) {
+			n.local.Set(key, b, n.opts.ttl)
+		}
+	}
+}
+
+func (n *nearCache) evict(keys ...string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.gen++
+	for _, key := range keys {
+		n.local.Delete(key)
+	}
+}
+
+func (n *nearCache) evictAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.gen++
+	n.local.ClearAll()
+}
+
+func (n *nearCache) close() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	n.closed = true
+	n.ready = false
+	close(n.done)
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	n.local.Close()
+}
+
+// nearGet returns the reply of GET key from the near cache, or from the default server and copies it
+func (ca *redisCache) nearGet(key string) (interface{}, error) {
+	if b, ok := ca.near.get(key); ok {
+		return b, nil
+	}
+	gen := ca.near.generation()
+	reply, err := ca.getDefaultRedis().GetObj(key)
+	if err == nil && reply != nil {
+		ca.near.fill(gen, map[string]interface{}{key: reply})
+	}
+	return reply, err
+}
+
+// nearMGet returns the replies of keys from the near cache, keys missed are read from the default server by MGET
+func (ca *redisCache) nearMGet(keys []string) ([]interface{}, error) {
+	replies := make([]interface{}, len(keys))
+	var missed []interface{}
+	for i, key := range keys {
+		if b, ok := ca.near.get(key); ok {
+			replies[i] = b
+		} else {
+			missed = append(missed, key)
+		}
+	}
+	if len(missed) == 0 {
+		return replies, nil
+	}
+	gen := ca.near.generation()
+	reply, err := ca.getDefaultRedis().MGet(missed...)
+	if err != nil {
+		return nil, err
+	}
+	loaded := make(map[string]interface{}, len(missed))
+	for i, key := range missed {
+		if i < len(reply) && reply[i] != nil {
+			loaded[key.(string)] = reply[i]
+		}
+	}
+	ca.near.fill(gen, loaded)
+	for i, key := range keys {
+		if replies[i] == nil {
+			replies[i] = loaded[key]
+		}
+	}
+	return replies, nil
+}
+
+// nearEvict evicts the local copies of keys changed by the cache, so it reads its own writes
+// without waiting for the invalidation messages
+func (ca *redisCache) nearEvict(keys ...string) {
+	if ca.near != nil {
+		ca.near.evict(keys...)
+	}
+}
@@ -0,0 +1,77 @@
+package redis
+
+import (
+	"errors"
+	"testing"
+
+	resp3 "github.com/devfeel/cache/internal/redigo/redis"
+	"github.com/devfeel/cache/runtime"
+)
+
+func newTestNearCache(prefixes ...string) *nearCache {
+	o := &nearCacheOptions{ttl: DefaultNearCacheTTL, maxEntries: DefaultNearCacheMaxEntries, prefixes: prefixes}
+	return &nearCache{opts: o, local: runtime.NewRuntimeCache(), done: make(chan struct{}), ready: true}
+}
+
+// pushConn is a resp3.Conn receiving replies, then an error
+type pushConn struct {
+	resp3.Conn
+	replies []interface{}
+}
+
+func (c *pushConn) Receive() (interface{}, error) {
+	if len(c.replies) == 0 {
+		return nil, errors.New("closed")
+	}
+	reply := c.replies[0]
+	c.replies = c.replies[1:]
+	return reply, nil
+}
+
+func TestNearCache_Fill(t *testing.T) {
+	n := newTestNearCache("user:")
+	gen := n.generation()
+	n.fill(gen, map[string]interface{}{"user:1": []byte("a"), "order:1": []byte("b")})
+	if v, ok := n.get("user:1"); !ok || string(v) != "a" {
+		t.Error("TestNearCache_Fill expect a, got", string(v), ok)
+	}
+	if _, ok := n.get("order:1"); ok {
+		t.Error("TestNearCache_Fill key out of prefixes should not be copied")
+	}
+
+	// a value read before an invalidation is not copied
+	gen = n.generation()
+	n.evict("user:2")
+	n.fill(gen, map[string]interface{}{"user:2": []byte("stale")})
+	if _, ok := n.get("user:2"); ok {
+		t.Error("TestNearCache_Fill stale value should not be copied")
+	}
+
+	// nothing is copied while tracking is down
+	n.ready = false
+	n.fill(n.generation(), map[string]interface{}{"user:3": []byte("c")})
+	if _, ok := n.get("user:3"); ok {
+		t.Error("TestNearCache_Fill value should not be copied while tracking is down")
+	}
+}
+
+func TestNearCache_Receive(t *testing.T) {
+	n := newTestNearCache()
+	n.fill(n.generation(), map[string]interface{}{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")})
+	n.receive(&pushConn{replies: []interface{}{
+		resp3.Push{Kind: "invalidate", Data: []interface{}{[]interface{}{[]byte("a"), []byte("b")}}},
+		resp3.Push{Kind: "message", Data: []interface{}{[]byte("c")}},
+	}})
+	if _, ok := n.get("a"); ok {
+		t.Error("TestNearCache_Receive a should be evicted")
+	}
+	if _, ok := n.get("c"); !ok {
+		t.Error("TestNearCache_Receive c should be kept")
+	}
+
+	// a null list of keys is sent when the server flushes its databases
+	n.receive(&pushConn{replies: []interface{}{resp3.Push{Kind: "invalidate", Data: []interface{}{nil}}}})
+	if _, ok := n.get("c"); ok {
+		t.Error("TestNearCache_Receive c should be evicted by flush")
+	}
+}
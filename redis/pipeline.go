@@ -0,0 +1,357 @@
+package redis
+
+import (
+	"context"
+	"errors"
+
+	"github.com/devfeel/cache/internal"
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrNotExecuted is returned by a Future whose Pipeline or Tx is not executed yet
+var ErrNotExecuted = errors.New("cache: pipeline not executed")
+
+// Future is the typed result of a command queued in a Pipeline or Tx, it is ready after Exec
+type Future[T any] struct {
+	val T
+	err error
+}
+
+func newFuture[T any]() *Future[T] {
+	return &Future[T]{err: ErrNotExecuted}
+}
+
+// Result returns the value and error of the command
+func (f *Future[T]) Result() (T, error) {
+	return f.val, f.err
+}
+
+// Val returns the value of the command
+func (f *Future[T]) Val() T {
+	return f.val
+}
+
+// Err returns the error of the command, ErrNotExecuted before Exec
+func (f *Future[T]) Err() error {
+	return f.err
+}
+
+// commands queues typed commands, it is shared by Pipeline and Tx
+type commands struct {
+	ca      *redisCache
+	cmds    []internal.Command
+	setters []func(reply interface{}, err error)
+	write   bool
+	err     error
+}
+
+// Pipeline queues commands and sends them to redis in one round-trip on Exec.
+// if all queued commands are read commands, it follows the readonly and backup routing of single commands,
+// otherwise it is sent to the default server.
+// a Pipeline is not safe for concurrent use, it can be reused after Exec.
+type Pipeline struct {
+	commands
+	// sharded is set by ShardedRedisCache.Pipeline, commands are sent to the shard of their keys
+	sharded *ShardedRedisCache
+}
+
+// Pipeline returns a new Pipeline of the cache
+func (ca *redisCache) Pipeline() *Pipeline {
+	return &Pipeline{commands: commands{ca: ca}}
+}
+
+// Len returns the number of queued commands
+func (p *commands) Len() int {
+	return len(p.cmds)
+}
+
+// reset clears queued commands and returns them
+func (p *commands) reset() (cmds []internal.Command, setters []func(reply interface{}, err error), write bool, err error) {
+	cmds, setters, write, err = p.cmds, p.setters, p.write, p.err
+	p.cmds, p.setters, p.write, p.err = nil, nil, false, nil
+	return
+}
+
+// fill calls setters with replies, and returns the first error of commands
+func fill(setters []func(reply interface{}, err error), replies []interface{}) error {
+	var first error
+	for i, set := range setters {
+		if e, ok := replies[i].(redis.Error); ok {
+			set(nil, e)
+			if first == nil {
+				first = e
+			}
+			continue
+		}
+		set(replies[i], nil)
+	}
+	return first
+}
+
+// fail calls setters with err
+func fail(setters []func(reply interface{}, err error), err error) {
+	for _, set := range setters {
+		set(nil, err)
+	}
+}
+
+// Exec sends all queued commands in one round-trip and fills their futures.
+// it returns the connection error, or the first error of commands.
+func (p *Pipeline) Exec() error {
+	if p.sharded != nil {
+		return p.sharded.execPipeline(p, nil)
+	}
+	return p.exec(p.ca)
+}
+
+// ExecCtx is Exec bounded by ctx.
+func (p *Pipeline) ExecCtx(ctx context.Context) error {
+	if p.sharded != nil {
+		return p.sharded.execPipeline(p, ctx)
+	}
+	return p.exec(p.ca.withContext(ctx))
+}
+
+func (p *Pipeline) exec(ca *redisCache) error {
+	cmds, setters, write, err := p.reset()
+	if len(cmds) == 0 {
+		return err
+	}
+	var replies []interface{}
+	if err == nil {
+		if write {
+			replies, err = ca.getDefaultRedis().Pipeline(cmds...)
+		} else {
+			replies, err = ca.getReadRedisClient().Pipeline(cmds...)
+			if ca.checkConnErrorAndNeedRetry(err) {
+				replies, err = ca.getBackupRedis().Pipeline(cmds...)
+			}
+		}
+	}
+	if err != nil {
+		fail(setters, err)
+		return err
+	}
+	return fill(setters, replies)
+}
+
+// queue appends a command, set is called with its reply on Exec
+func (p *commands) queue(write bool, set func(reply interface{}, err error), commandName string, args ...interface{}) {
+	p.cmds = append(p.cmds, internal.Command{Name: commandName, Args: args})
+	p.setters = append(p.setters, set)
+	p.write = p.write || write
+}
+
+// encode encodes and compresses value like single commands, the error is returned by Exec
+func (p *commands) encode(value interface{}) interface{} {
+	value, err := p.ca.encode(value)
+	if err != nil {
+		if p.err == nil {
+			p.err = err
+		}
+		return nil
+	}
+	return p.ca.compress(value)
+}
+
+// encodeValues encodes values like LPush, compress is false for set members
+func (p *commands) encodeValues(values []interface{}, compress bool) []interface{} {
+	values, err := p.ca.encodeValues(values)
+	if err != nil {
+		if p.err == nil {
+			p.err = err
+		}
+		return nil
+	}
+	if compress {
+		values = p.ca.compressValues(values)
+	}
+	return values
+}
+
+func queueString(p *commands, write bool, commandName string, args ...interface{}) *Future[string] {
+	f := newFuture[string]()
+	p.queue(write, func(reply interface{}, err error) {
+		f.val, f.err = redis.String(reply, err)
+		f.val = decompressString(f.val)
+	}, commandName, args...)
+	return f
+}
+
+func queueInt(p *commands, write bool, commandName string, args ...interface{}) *Future[int] {
+	f := newFuture[int]()
+	p.queue(write, func(reply interface{}, err error) {
+		f.val, f.err = redis.Int(reply, err)
+	}, commandName, args...)
+	return f
+}
+
+func queueInt64(p *commands, write bool, commandName string, args ...interface{}) *Future[int64] {
+	f := newFuture[int64]()
+	p.queue(write, func(reply interface{}, err error) {
+		f.val, f.err = redis.Int64(reply, convertCounterError(err))
+	}, commandName, args...)
+	return f
+}
+
+func queueStrings(p *commands, write bool, commandName string, args ...interface{}) *Future[[]string] {
+	f := newFuture[[]string]()
+	p.queue(write, func(reply interface{}, err error) {
+		f.val, f.err = redis.Strings(reply, err)
+		f.val = decompressStrings(f.val)
+	}, commandName, args...)
+	return f
+}
+
+// Get queues GET, the value is nil if non-existed, or ErrNotFound in strict mode
+func (p *commands) Get(key string) *Future[interface{}] {
+	f := newFuture[interface{}]()
+	p.queue(false, func(reply interface{}, err error) {
+		if p.ca.strict && err == nil && reply == nil {
+			err = ErrNotFound
+		}
+		f.val, f.err = decompressReply(reply), err
+	}, "GET", key)
+	return f
+}
+
+// GetString queues GET, the error is redis.ErrNil if non-existed, or ErrNotFound in strict mode
+func (p *commands) GetString(key string) *Future[string] {
+	f := newFuture[string]()
+	p.queue(false, func(reply interface{}, err error) {
+		f.val, f.err = redis.String(reply, err)
+		f.val = decompressString(f.val)
+		f.err = p.ca.convertNotFoundError(f.err)
+	}, "GET", key)
+	return f
+}
+
+// Set queues SET, ttl is second, if ttl is 0, it will be forever
+func (p *commands) Set(key string, value interface{}, ttl int64) *Future[string] {
+	if ttl > 0 {
+		return queueString(p, true, "SET", key, p.encode(value), "EX", ttl)
+	}
+	return queueString(p, true, "SET", key, p.encode(value))
+}
+
+// Delete queues DEL, the value is the number of deleted keys
+func (p *commands) Delete(keys ...string) *Future[int] {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	return queueInt(p, true, "DEL", args...)
+}
+
+// Exists queues EXISTS
+func (p *commands) Exists(key string) *Future[bool] {
+	f := newFuture[bool]()
+	p.queue(false, func(reply interface{}, err error) {
+		f.val, f.err = redis.Bool(reply, err)
+	}, "EXISTS", key)
+	return f
+}
+
+// Expire queues EXPIRE, timeout time duration is second
+func (p *commands) Expire(key string, timeOutSeconds int) *Future[int] {
+	return queueInt(p, true, "EXPIRE", key, timeOutSeconds)
+}
+
+// Incr queues INCR
+func (p *commands) Incr(key string) *Future[int64] {
+	return queueInt64(p, true, "INCR", key)
+}
+
+// IncrBy queues INCRBY
+func (p *commands) IncrBy(key string, delta int64) *Future[int64] {
+	return queueInt64(p, true, "INCRBY", key, delta)
+}
+
+// DecrBy queues DECRBY
+func (p *commands) DecrBy(key string, delta int64) *Future[int64] {
+	return queueInt64(p, true, "DECRBY", key, delta)
+}
+
+// HGet queues HGET
+func (p *commands) HGet(hashID string, field string) *Future[string] {
+	return queueString(p, false, "HGET", hashID, field)
+}
+
+// HSet queues HSET, the value is 1 if field is new, 0 if it is overwritten
+func (p *commands) HSet(hashID string, field string, val interface{}) *Future[int] {
+	return queueInt(p, true, "HSET", hashID, field, p.encode(val))
+}
+
+// HGetAll queues HGETALL
+func (p *commands) HGetAll(hashID string) *Future[map[string]string] {
+	f := newFuture[map[string]string]()
+	p.queue(false, func(reply interface{}, err error) {
+		f.val, f.err = redis.StringMap(reply, err)
+		f.val = decompressStringMap(f.val)
+	}, "HGETALL", hashID)
+	return f
+}
+
+// HDel queues HDEL
+func (p *commands) HDel(hashID string, fields ...interface{}) *Future[int] {
+	return queueInt(p, true, "HDEL", append([]interface{}{hashID}, fields...)...)
+}
+
+// HIncrBy queues HINCRBY
+func (p *commands) HIncrBy(hashID string, field string, increment int64) *Future[int64] {
+	return queueInt64(p, true, "HINCRBY", hashID, field, increment)
+}
+
+// LPush queues LPUSH
+func (p *commands) LPush(key string, values ...interface{}) *Future[int] {
+	return queueInt(p, true, "LPUSH", append([]interface{}{key}, p.encodeValues(values, true)...)...)
+}
+
+// RPush queues RPUSH
+func (p *commands) RPush(key string, values ...interface{}) *Future[int] {
+	return queueInt(p, true, "RPUSH", append([]interface{}{key}, p.encodeValues(values, true)...)...)
+}
+
+// LRange queues LRANGE
+func (p *commands) LRange(key string, start int, stop int) *Future[[]string] {
+	return queueStrings(p, true, "LRANGE", key, start, stop)
+}
+
+// SAdd queues SADD, set members are encoded but not compressed
+func (p *commands) SAdd(key string, members ...interface{}) *Future[int] {
+	return queueInt(p, true, "SADD", append([]interface{}{key}, p.encodeValues(members, false)...)...)
+}
+
+// SMembers queues SMEMBERS
+func (p *commands) SMembers(key string) *Future[[]string] {
+	return queueStrings(p, false, "SMEMBERS", key)
+}
+
+// ZAdd queues ZADD
+func (p *commands) ZAdd(key string, score int64, member interface{}) *Future[int] {
+	return queueInt(p, true, "ZADD", key, score, member)
+}
+
+// ZRem queues ZREM
+func (p *commands) ZRem(key string, members ...interface{}) *Future[int] {
+	return queueInt(p, true, "ZREM", append([]interface{}{key}, members...)...)
+}
+
+// ZCard queues ZCARD
+func (p *commands) ZCard(key string) *Future[int] {
+	return queueInt(p, false, "ZCARD", key)
+}
+
+// ZRange queues ZRANGE
+func (p *commands) ZRange(key string, start, stop int64) *Future[[]string] {
+	return queueStrings(p, false, "ZRANGE", key, start, stop)
+}
+
+// Do queues any command, it is always sent to the default server
+func (p *commands) Do(commandName string, args ...interface{}) *Future[interface{}] {
+	f := newFuture[interface{}]()
+	p.queue(true, func(reply interface{}, err error) {
+		f.val, f.err = reply, err
+	}, commandName, args...)
+	return f
+}
@@ -0,0 +1,36 @@
+package redis
+
+import (
+	"testing"
+
+	"github.com/devfeel/cache/codec"
+)
+
+func TestPipeline_Queue(t *testing.T) {
+	ca := &redisCache{codec: codec.JSONCodec{}}
+	p := ca.Pipeline()
+	get := p.GetString("1")
+	if _, err := get.Result(); err != ErrNotExecuted {
+		t.Error("TestPipeline_Queue expect ErrNotExecuted, got", err)
+	}
+	if p.write {
+		t.Error("TestPipeline_Queue read only pipeline should not be write")
+	}
+	p.HSet("h", "f", struct{ Name string }{"devfeel"})
+	if !p.write || p.Len() != 2 {
+		t.Error("TestPipeline_Queue expect write pipeline with 2 commands, got", p.write, p.Len())
+	}
+	if v := p.cmds[1].Args[2]; v != `{"Name":"devfeel"}` && string(v.([]byte)) != `{"Name":"devfeel"}` {
+		t.Error("TestPipeline_Queue HSet value should be encoded, got", v)
+	}
+	p.SAdd("s", make(chan int))
+	if err := p.Exec(); err == nil || err == ErrNotExecuted {
+		t.Error("TestPipeline_Queue expect encode error, got", err)
+	}
+	if _, err := get.Result(); err == nil || err == ErrNotExecuted {
+		t.Error("TestPipeline_Queue future expect encode error, got", err)
+	}
+	if p.Len() != 0 {
+		t.Error("TestPipeline_Queue pipeline should be reset after Exec")
+	}
+}
@@ -0,0 +1,137 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// RedlockClockDriftFactor is the part of ttl reserved for clock drift between nodes
+	RedlockClockDriftFactor = 0.01
+	// redlockMinDrift is added to the clock drift, for the precision of expire on redis
+	redlockMinDrift = 2 * time.Millisecond
+	// redlockNodeTimeoutFactor is the part of ttl a single node may take to reply,
+	// so a node which is down does not use the validity of the lock
+	redlockNodeTimeoutFactor = 10
+)
+
+// Redlock is a distributed lock on several independent redis servers, using the Redlock algorithm,
+// so it survives the failure of a minority of nodes.
+// a lock is obtained when a quorum of nodes (N/2+1) is locked within the validity of the lock,
+// the validity is ttl minus the time used to lock the nodes and the clock drift.
+// Redlock has the same API as Locker, and returns the same *Lock.
+type Redlock struct {
+	lockers []*Locker
+	quorum  int
+	opts    *lockOptions
+}
+
+// NewRedlock returns a new *Redlock on the default server of every locker,
+// lockers should be on independent servers, usually 3 or 5.
+func NewRedlock(lockers []*Locker, opts ...LockOption) *Redlock {
+	return &Redlock{lockers: lockers, quorum: len(lockers)/2 + 1, opts: newLockOptions(opts)}
+}
+
+// TryLock tries to obtain the lock once, return ErrLockNotObtained if a quorum of nodes can not be locked.
+// ttl is the lease of the lock, it is extended automatically while held unless WithAutoExtend(false).
+func (r *Redlock) TryLock(key string, ttl time.Duration) (*Lock, error) {
+	return tryLock(context.Background(), r, key, ttl)
+}
+
+// Lock waits until the lock is obtained.
+func (r *Redlock) Lock(key string, ttl time.Duration) (*Lock, error) {
+	return obtainLock(context.Background(), r, key, ttl)
+}
+
+// LockCtx waits until the lock is obtained or ctx is done.
+func (r *Redlock) LockCtx(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	return obtainLock(ctx, r, key, ttl)
+}
+
+func (r *Redlock) acquire(ctx context.Context, key string, token string, ttl time.Duration) (time.Duration, error) {
+	validity, err := r.quorumValidity(ctx, ttl, func(ctx context.Context, l *Locker) (bool, error) {
+		v, err := l.acquire(ctx, key, token, ttl)
+		return v > 0, err
+	})
+	if validity <= 0 {
+		// unlock nodes which are locked, and nodes which are locked but whose reply is lost
+		r.release(context.Background(), key, token)
+	}
+	return validity, err
+}
+
+func (r *Redlock) extend(ctx context.Context, key string, token string, ttl time.Duration) (time.Duration, error) {
+	return r.quorumValidity(ctx, ttl, func(ctx context.Context, l *Locker) (bool, error) {
+		v, err := l.extend(ctx, key, token, ttl)
+		return v > 0, err
+	})
+}
+
+// release unlocks all nodes, it returns true if a quorum of nodes was still locked by token
+func (r *Redlock) release(ctx context.Context, key string, token string) (bool, error) {
+	count, _, err := r.each(ctx, 0, func(ctx context.Context, l *Locker) (bool, error) {
+		return l.release(ctx, key, token)
+	})
+	if count >= r.quorum {
+		return true, nil
+	}
+	return false, err
+}
+
+func (r *Redlock) options() *lockOptions {
+	return r.opts
+}
+
+// quorumValidity calls f on all nodes, and returns the remaining validity if a quorum of them succeeded, otherwise 0.
+// the last error of nodes is returned only if too many nodes failed to reach a quorum,
+// so Lock keeps waiting when a minority of nodes is down.
+func (r *Redlock) quorumValidity(ctx context.Context, ttl time.Duration, f func(ctx context.Context, l *Locker) (bool, error)) (time.Duration, error) {
+	start := time.Now()
+	count, failed, err := r.each(ctx, ttl/redlockNodeTimeoutFactor, f)
+	drift := time.Duration(float64(ttl)*RedlockClockDriftFactor) + redlockMinDrift
+	validity := ttl - time.Since(start) - drift
+	if count >= r.quorum && validity > 0 {
+		return validity, nil
+	}
+	if len(r.lockers)-failed < r.quorum {
+		return 0, err
+	}
+	return 0, nil
+}
+
+// each calls f on all nodes concurrently, each call is bounded by timeout if it is not 0,
+// it returns the number of nodes on which f returns true, the number of nodes which failed, and the last error.
+func (r *Redlock) each(ctx context.Context, timeout time.Duration, f func(ctx context.Context, l *Locker) (bool, error)) (int, int, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		count   int
+		failed  int
+		lastErr error
+	)
+	for _, l := range r.lockers {
+		wg.Add(1)
+		go func(l *Locker) {
+			defer wg.Done()
+			nodeCtx := ctx
+			if timeout > 0 {
+				var cancel context.CancelFunc
+				nodeCtx, cancel = context.WithTimeout(ctx, timeout)
+				defer cancel()
+			}
+			ok, err := f(nodeCtx, l)
+			mu.Lock()
+			defer mu.Unlock()
+			if ok {
+				count++
+			}
+			if err != nil {
+				failed++
+				lastErr = err
+			}
+		}(l)
+	}
+	wg.Wait()
+	return count, failed, lastErr
+}
@@ -0,0 +1,129 @@
+package redis
+
+import (
+	"context"
+	"encoding/binary"
+	"time"
+)
+
+const (
+	// softTTLFlag follows compressMagic in values set by SetWithSoftTTL, then the soft deadline
+	// in unix milliseconds, the soft ttl and the ttl in seconds, and the value as stored by Set.
+	// it is not a Compression, so older versions read the value with its header like an uncompressed one.
+	softTTLFlag       byte = 0xFF
+	softTTLHeaderSize      = len(compressMagic) + 1 + 8 + 4 + 4
+
+	// refreshScript sets the refreshed value only if the key still holds the stale one, ARGV[3] is the ttl, 0 is forever
+	refreshScript = `if redis.call("get", KEYS[1]) ~= ARGV[1] then return 0 end
+if ARGV[3] == "0" then redis.call("set", KEYS[1], ARGV[2]) else redis.call("set", KEYS[1], ARGV[2], "EX", ARGV[3]) end
+return 1`
+)
+
+// SetLoader set the loader which refreshes values set by SetWithSoftTTL, default is nil.
+// getters return the stale value of a key after its soft deadline and call loader in the background,
+// at most one refresh of a key runs in the process, with SetLoadLock, in all processes sharing the server.
+func (ca *redisCache) SetLoader(loader func(key string) (interface{}, error)) {
+	ca.loader = loader
+}
+
+// SetWithSoftTTL set cache to redis with a soft ttl, softTTL and ttl are second.
+// the soft deadline is stored with the value, after it, Get, GetString, GetInt, GetInt64, GetObj, GetJsonObj
+// and MGet return the stale value and the loader of SetLoader refreshes it, the key is deleted after ttl.
+// other commands, like Pipeline or Tx, read the value with its header.
+// if softTTL is 0, or not less than a ttl which is not 0, it is the same as Set.
+func (ca *redisCache) SetWithSoftTTL(key string, value interface{}, softTTL int64, ttl int64) error {
+	if softTTL <= 0 || (ttl > 0 && softTTL >= ttl) {
+		return ca.Set(key, value, ttl)
+	}
+	data, err := ca.encodeSoftTTL(value, softTTL, ttl)
+	if err != nil {
+		return err
+	}
+	return ca.setValue(key, data, ttl)
+}
+
+// encodeSoftTTL returns value as stored by Set, after the header of its soft deadline
+func (ca *redisCache) encodeSoftTTL(value interface{}, softTTL int64, ttl int64) ([]byte, error) {
+	value, err := ca.encode(value)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	switch v := ca.compress(value).(type) {
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	}
+	header := make([]byte, softTTLHeaderSize, softTTLHeaderSize+len(data))
+	n := copy(header, compressMagic)
+	header[n] = softTTLFlag
+	deadline := time.Now().Add(time.Duration(softTTL) * time.Second)
+	binary.BigEndian.PutUint64(header[n+1:], uint64(deadline.UnixNano()/int64(time.Millisecond)))
+	binary.BigEndian.PutUint32(header[n+9:], uint32(softTTL))
+	binary.BigEndian.PutUint32(header[n+13:], uint32(ttl))
+	return append(header, data...), nil
+}
+
+// softTTLOf parses the header of a value set by SetWithSoftTTL, ok is false for other replies
+func softTTLOf(reply interface{}) (deadline time.Time, softTTL int64, ttl int64, ok bool) {
+	data, isBytes := reply.([]byte)
+	n := len(compressMagic)
+	if !isBytes || len(data) < softTTLHeaderSize || string(data[:n]) != compressMagic || data[n] != softTTLFlag {
+		return time.Time{}, 0, 0, false
+	}
+	ms := int64(binary.BigEndian.Uint64(data[n+1:]))
+	deadline = time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+	return deadline, int64(binary.BigEndian.Uint32(data[n+9:])), int64(binary.BigEndian.Uint32(data[n+13:])), true
+}
+
+// revalidate removes the header of a value set by SetWithSoftTTL,
+// and starts a refresh of key if it is past its soft deadline, unless a refresh of key is running
+func (ca *redisCache) revalidate(key string, reply interface{}) interface{} {
+	deadline, _, _, ok := softTTLOf(reply)
+	if !ok {
+		return reply
+	}
+	if ca.loader != nil && time.Now().After(deadline) {
+		// the refresh outlives the ctx of the caller
+		base := *ca
+		base.ctx = nil
+		ca.refreshes.Go(key, func() (interface{}, error) {
+			return base.refresh(key)
+		})
+	}
+	return reply.([]byte)[softTTLHeaderSize:]
+}
+
+// refresh calls the loader and replaces the stale value of key with the same soft ttl and ttl,
+// nothing is set if the value was changed, deleted or refreshed by another process meanwhile
+func (ca *redisCache) refresh(key string) (interface{}, error) {
+	if ca.loadLockTTL > 0 {
+		lock, err := tryLock(context.Background(), ca.NewLocker(), key+loadLockSuffix, ca.loadLockTTL)
+		if err != nil {
+			// ErrLockNotObtained, another process refreshes key
+			return nil, err
+		}
+		defer lock.Unlock()
+	}
+	client := ca.getDefaultRedis()
+	stale, err := client.GetObj(key)
+	if err != nil {
+		return nil, err
+	}
+	deadline, softTTL, ttl, ok := softTTLOf(stale)
+	if !ok || time.Now().Before(deadline) {
+		return nil, nil
+	}
+	v, err := ca.loader(key)
+	if err != nil || v == nil {
+		return v, err
+	}
+	data, err := ca.encodeSoftTTL(v, softTTL, ttl)
+	if err != nil {
+		return nil, err
+	}
+	_, err = client.EVAL(refreshScript, 1, key, stale, data, ttl)
+	ca.nearEvict(key)
+	return v, err
+}
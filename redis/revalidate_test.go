@@ -0,0 +1,32 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devfeel/cache/internal/singleflight"
+)
+
+func TestRedisCache_SoftTTLHeader(t *testing.T) {
+	page := strings.Repeat("<div>devfeel cache</div>", 100)
+	ca := &redisCache{refreshes: new(singleflight.Group)}
+	ca.SetCompression(CompressionSnappy, 0)
+	data, err := ca.encodeSoftTTL(page, 10, 60)
+	if err != nil {
+		t.Fatal("TestRedisCache_SoftTTLHeader encode error", err)
+	}
+	deadline, softTTL, ttl, ok := softTTLOf(data)
+	if !ok || softTTL != 10 || ttl != 60 || deadline.Sub(time.Now()) > 10*time.Second || deadline.Sub(time.Now()) < 9*time.Second {
+		t.Error("TestRedisCache_SoftTTLHeader expect header of 10s and 60s, got", deadline, softTTL, ttl, ok)
+	}
+	if v := decompressReply(ca.revalidate("key", data)); string(v.([]byte)) != page {
+		t.Error("TestRedisCache_SoftTTLHeader expect original value after revalidate")
+	}
+	// values set by Set, and compressed values, are not read as soft ttl values
+	for _, v := range []interface{}{[]byte(page), ca.compress(page), append([]byte(compressMagic), softTTLFlag), nil} {
+		if _, _, _, ok := softTTLOf(v); ok {
+			t.Error("TestRedisCache_SoftTTLHeader expect no header in", v)
+		}
+	}
+}
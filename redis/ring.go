@@ -0,0 +1,67 @@
+package redis
+
+import (
+	"hash/crc32"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/devfeel/cache/internal"
+)
+
+// DefaultVirtualNodes is the number of points of each shard on the consistent hash ring of ShardedRedisCache
+const DefaultVirtualNodes = 160
+
+// hashRing is a consistent hash ring, each node owns vnodes points,
+// a key belongs to the node of the first point clockwise from the hash of the key,
+// so adding a node only moves the keys between its points and their predecessors, about 1/N of keys.
+type hashRing struct {
+	hashes []uint32
+	nodes  []int
+}
+
+func newHashRing(names []string, vnodes int) *hashRing {
+	type point struct {
+		hash uint32
+		node int
+	}
+	points := make([]point, 0, len(names)*vnodes)
+	for node, name := range names {
+		for i := 0; i < vnodes; i++ {
+			points = append(points, point{crc32.ChecksumIEEE([]byte(name + "#" + strconv.Itoa(i))), node})
+		}
+	}
+	// order of nodes with the same hash does not depend on the order of names
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash != points[j].hash {
+			return points[i].hash < points[j].hash
+		}
+		return names[points[i].node] < names[points[j].node]
+	})
+	r := &hashRing{hashes: make([]uint32, len(points)), nodes: make([]int, len(points))}
+	for i, p := range points {
+		r.hashes[i], r.nodes[i] = p.hash, p.node
+	}
+	return r
+}
+
+// get returns the node of key, only the {hashtag} of key is hashed if it has a non-empty one
+func (r *hashRing) get(key string) int {
+	h := crc32.ChecksumIEEE([]byte(internal.HashTag(key)))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[i]
+}
+
+// shardName returns the name of a server on the ring, without password,
+// so changing the password does not move keys
+func shardName(serverUrl string) string {
+	u, err := url.Parse(serverUrl)
+	if err != nil {
+		return serverUrl
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,91 @@
+package redis
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestHashRing_Remap(t *testing.T) {
+	names := []string{"redis://10.0.1.11:6379/0", "redis://10.0.1.12:6379/0", "redis://10.0.1.13:6379/0", "redis://10.0.1.14:6379/0"}
+	r4 := newHashRing(names, DefaultVirtualNodes)
+	r5 := newHashRing(append(names, "redis://10.0.1.15:6379/0"), DefaultVirtualNodes)
+	// the order of names does not change routing
+	reversed := newHashRing([]string{names[3], names[2], names[1], names[0]}, DefaultVirtualNodes)
+
+	const keys = 100000
+	counts := make([]int, len(names))
+	moved := 0
+	for i := 0; i < keys; i++ {
+		key := "key:" + strconv.Itoa(i)
+		node := r4.get(key)
+		counts[node]++
+		if names[node] != names[3-reversed.get(key)] {
+			t.Fatal("TestHashRing_Remap order error", key)
+		}
+		if n := r5.get(key); n != node {
+			if n != 4 {
+				t.Fatal("TestHashRing_Remap key moved between old nodes", key)
+			}
+			moved++
+		}
+	}
+	// about 1/5 of keys move to the new node
+	if moved < keys/10 || moved > keys*3/10 {
+		t.Error("TestHashRing_Remap moved error", moved)
+	}
+	for i, count := range counts {
+		if count < keys/4*7/10 || count > keys/4*13/10 {
+			t.Error("TestHashRing_Remap balance error", names[i], count)
+		}
+	}
+}
+
+func TestHashRing_HashTag(t *testing.T) {
+	r := newHashRing([]string{"a", "b", "c"}, DefaultVirtualNodes)
+	for i := 0; i < 100; i++ {
+		id := strconv.Itoa(i)
+		if r.get("{user"+id+"}.name") != r.get("{user"+id+"}.friends") {
+			t.Error("TestHashRing_HashTag error", id)
+		}
+	}
+}
+
+func TestShardName(t *testing.T) {
+	if name := shardName("redis://:password@10.0.1.11:6379/0"); name != "redis://10.0.1.11:6379/0" {
+		t.Error("TestShardName error", name)
+	}
+}
+
+func TestNewShardedRedisCache_Invalid(t *testing.T) {
+	if _, err := NewShardedRedisCache(nil, 10, 10); err == nil {
+		t.Error("TestNewShardedRedisCache_Invalid expect error without server")
+	}
+	urls := []string{"redis://:a@10.0.1.11:6379/0", "redis://10.0.1.12:6379/0", "redis://:b@10.0.1.11:6379/0"}
+	if _, err := NewShardedRedisCache(urls, 10, 10); err == nil {
+		t.Error("TestNewShardedRedisCache_Invalid expect error with duplicate server")
+	}
+	urls = []string{"redis://10.0.1.11:6379/0", "redis://10.0.1.12:6379/0"}
+	if _, err := NewShardedRedisCache(urls, 10, 10, WithShardReplica("redis://10.0.1.13:6379/0", "redis://10.0.1.21:6379/0")); err == nil {
+		t.Error("TestNewShardedRedisCache_Invalid expect error with replica of unknown server")
+	}
+	if _, err := NewShardedRedisCache(urls, 10, 10, WithShardBackup(urls[0], "redis://10.0.1.21:6379/0"),
+		WithShardBackup(urls[0], "redis://10.0.1.22:6379/0")); err == nil {
+		t.Error("TestNewShardedRedisCache_Invalid expect error with two backups of a server")
+	}
+}
+
+func TestNewShardedRedisCache_ShardReplica(t *testing.T) {
+	urls := []string{"redis://10.0.1.11:6379/0", "redis://10.0.1.12:6379/0"}
+	sc, err := NewShardedRedisCache(urls, 10, 10,
+		WithShardReplica(urls[0], "redis://10.0.1.21:6379/0"), WithShardBackup(urls[1], "redis://10.0.1.22:6379/0"))
+	if err != nil {
+		t.Fatal("TestNewShardedRedisCache_ShardReplica error", err)
+	}
+	defer sc.Close()
+	if s := sc.Shard(urls[0]); s.readOnlyServerUrl != "redis://10.0.1.21:6379/0" || s.backupServerUrl != "" {
+		t.Error("TestNewShardedRedisCache_ShardReplica shard 0 error", s.readOnlyServerUrl, s.backupServerUrl)
+	}
+	if s := sc.Shard(urls[1]); s.readOnlyServerUrl != "" || s.backupServerUrl != "redis://10.0.1.22:6379/0" {
+		t.Error("TestNewShardedRedisCache_ShardReplica shard 1 error", s.readOnlyServerUrl, s.backupServerUrl)
+	}
+}
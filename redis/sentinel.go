@@ -0,0 +1,355 @@
+package redis
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devfeel/cache/internal"
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrMasterNotFound is returned when no sentinel knows the master name
+var ErrMasterNotFound = errors.New("cache: sentinel master not found")
+
+const (
+	// sentinelTimeout bounds dial, read and write of commands sent to sentinels
+	sentinelTimeout = 3 * time.Second
+	// sentinelRetryInterval is the wait before subscribing again when the sentinel connection is lost
+	sentinelRetryInterval = time.Second
+)
+
+type (
+	// SentinelOption configures a RedisCache created by NewSentinelRedisCache
+	SentinelOption func(*sentinelOptions)
+
+	sentinelOptions struct {
+		sentinelPassword string
+		password         string
+		db               int
+		replicaReadOnly  bool
+	}
+
+	// sentinel resolves the master and a replica of masterName, and follows failovers
+	sentinel struct {
+		addrs      []string
+		masterName string
+		opts       *sentinelOptions
+		maxIdle    int
+		maxActive  int
+
+		// the clients are retained for the urls, and released when the urls change or by close
+		mu         sync.RWMutex
+		masterUrl  string
+		master     *internal.RedisClient
+		replicaUrl string
+		replica    *internal.RedisClient
+
+		done      chan struct{}
+		closeOnce sync.Once
+	}
+)
+
+// WithSentinelPassword set the password of sentinels
+func WithSentinelPassword(password string) SentinelOption {
+	return func(o *sentinelOptions) {
+		o.sentinelPassword = password
+	}
+}
+
+// WithMasterPassword set the password of master and replicas
+func WithMasterPassword(password string) SentinelOption {
+	return func(o *sentinelOptions) {
+		o.password = password
+	}
+}
+
+// WithDB set the db of master and replicas, default is 0
+func WithDB(db int) SentinelOption {
+	return func(o *sentinelOptions) {
+		o.db = db
+	}
+}
+
+// WithReplicaReadOnly use a healthy replica as the readonly server, it is changed when replicas go down or up
+func WithReplicaReadOnly() SentinelOption {
+	return func(o *sentinelOptions) {
+		o.replicaReadOnly = true
+	}
+}
+
+// NewSentinelRedisCache returns a new *RedisCache whose default server is the master of masterName,
+// resolved by SENTINEL get-master-addr-by-name on the first reachable sentinel of sentinelAddrs, like "10.0.1.11:26379".
+// it subscribes to +switch-master and switches to the new master after a failover, without restart.
+// return ErrMasterNotFound if no sentinel knows masterName.
+func NewSentinelRedisCache(sentinelAddrs []string, masterName string, maxIdle int, maxActive int, opts ...SentinelOption) (*redisCache, error) {
+	o := &sentinelOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	s := &sentinel{
+		addrs:      append([]string(nil), sentinelAddrs...),
+		masterName: masterName,
+		opts:       o,
+		maxIdle:    maxIdle,
+		maxActive:  maxActive,
+		done:       make(chan struct{}),
+	}
+	if err := s.refresh(); err != nil {
+		s.close()
+		return nil, err
+	}
+	go s.watch()
+	return newRedisCache(redisCache{sentinel: s, maxIdle: maxIdle, maxActive: maxActive}), nil
+}
+
+// masterClient returns the client of the current master, it is retained until the master changes,
+// so a client returned before a failover is not created again for the old master
+func (s *sentinel) masterClient() *internal.RedisClient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.master
+}
+
+// replicaClient returns the client of the replica used as readonly server, nil if none
+func (s *sentinel) replicaClient() *internal.RedisClient {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.replica
+}
+
+// refresh resolves the master, and a replica if WithReplicaReadOnly
+func (s *sentinel) refresh() error {
+	var addr []string
+	err := s.query(func(conn redis.Conn) error {
+		reply, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", s.masterName))
+		if err == redis.ErrNil || (err == nil && len(reply) != 2) {
+			return ErrMasterNotFound
+		}
+		addr = reply
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	s.setMaster(s.url(addr[0], addr[1]))
+	if s.opts.replicaReadOnly {
+		s.refreshReplica()
+	}
+	return nil
+}
+
+// refreshReplica chooses the first healthy replica, a failure keeps the current one
+func (s *sentinel) refreshReplica() {
+	var replica string
+	err := s.query(func(conn redis.Conn) error {
+		reply, err := redis.Values(conn.Do("SENTINEL", "replicas", s.masterName))
+		if err != nil {
+			// before redis 5
+			reply, err = redis.Values(conn.Do("SENTINEL", "slaves", s.masterName))
+		}
+		if err != nil {
+			return err
+		}
+		for _, v := range reply {
+			info, err := redis.StringMap(v, nil)
+			if err != nil {
+				continue
+			}
+			flags := info["flags"]
+			if strings.Contains(flags, "s_down") || strings.Contains(flags, "o_down") || strings.Contains(flags, "disconnected") {
+				continue
+			}
+			if status, ok := info["master-link-status"]; ok && status != "ok" {
+				continue
+			}
+			replica = s.url(info["ip"], info["port"])
+			break
+		}
+		return nil
+	})
+	if err == nil {
+		s.setReplica(replica)
+	}
+}
+
+func (s *sentinel) setMaster(masterUrl string) {
+	s.setUrl(&s.masterUrl, &s.master, masterUrl)
+}
+
+func (s *sentinel) setReplica(replicaUrl string) {
+	s.setUrl(&s.replicaUrl, &s.replica, replicaUrl)
+}
+
+// setUrl retains the client of serverUrl and releases the pool of the old one, "" means none
+func (s *sentinel) setUrl(current *string, client **internal.RedisClient, serverUrl string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if serverUrl == *current {
+		return
+	}
+	select {
+	case <-s.done:
+		// closed while refreshing
+		return
+	default:
+	}
+	var retained *internal.RedisClient
+	if serverUrl != "" {
+		retained = internal.RetainRedisClient(serverUrl, s.maxIdle, s.maxActive)
+	}
+	if *current != "" {
+		internal.ReleaseRedisClient(*current)
+	}
+	*current = serverUrl
+	*client = retained
+}
+
+// url returns the connection string of a master or replica
+func (s *sentinel) url(host string, port string) string {
+	u := url.URL{Scheme: "redis", Host: net.JoinHostPort(host, port), Path: "/" + strconv.Itoa(s.opts.db)}
+	if s.opts.password != "" {
+		u.User = url.UserPassword("", s.opts.password)
+	}
+	return u.String()
+}
+
+// dial connects to a sentinel
+func (s *sentinel) dial(addr string, timeout time.Duration) (redis.Conn, error) {
+	conn, err := redis.Dial("tcp", addr,
+		redis.DialConnectTimeout(sentinelTimeout), redis.DialReadTimeout(timeout), redis.DialWriteTimeout(sentinelTimeout))
+	if err != nil {
+		return nil, err
+	}
+	if s.opts.sentinelPassword != "" {
+		if _, err := conn.Do("AUTH", s.opts.sentinelPassword); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// query calls f on the first reachable sentinel, which is moved to the front for next queries
+func (s *sentinel) query(f func(conn redis.Conn) error) error {
+	s.mu.RLock()
+	addrs := append([]string(nil), s.addrs...)
+	s.mu.RUnlock()
+	var err error
+	for i, addr := range addrs {
+		var conn redis.Conn
+		if conn, err = s.dial(addr, sentinelTimeout); err != nil {
+			continue
+		}
+		err = f(conn)
+		conn.Close()
+		if err == ErrMasterNotFound {
+			continue
+		}
+		if err == nil {
+			if i > 0 {
+				s.mu.Lock()
+				s.addrs = append(append([]string{addr}, addrs[:i]...), addrs[i+1:]...)
+				s.mu.Unlock()
+			}
+			return nil
+		}
+	}
+	return err
+}
+
+// watch subscribes to sentinel events until close, and refreshes after a lost connection,
+// in case a failover happened meanwhile
+func (s *sentinel) watch() {
+	for {
+		s.subscribe()
+		select {
+		case <-s.done:
+			return
+		case <-time.After(sentinelRetryInterval):
+		}
+		s.refresh()
+	}
+}
+
+// subscribe receives +switch-master, and replica events if WithReplicaReadOnly, until error or close
+func (s *sentinel) subscribe() error {
+	s.mu.RLock()
+	addrs := append([]string(nil), s.addrs...)
+	s.mu.RUnlock()
+	var conn redis.Conn
+	var err error
+	for _, addr := range addrs {
+		if conn, err = s.dial(addr, 0); err == nil {
+			break
+		}
+	}
+	if conn == nil {
+		return err
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-s.done:
+			// unblock Receive
+			conn.Close()
+		case <-stop:
+		}
+	}()
+	defer conn.Close()
+
+	psc := redis.PubSubConn{Conn: conn}
+	channels := []interface{}{"+switch-master"}
+	if s.opts.replicaReadOnly {
+		channels = append(channels, "+slave", "+sdown", "-sdown")
+	}
+	if err := psc.Subscribe(channels...); err != nil {
+		return err
+	}
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			s.handle(v.Channel, string(v.Data))
+		case error:
+			return v
+		}
+	}
+}
+
+// handle switches master on +switch-master, "<master name> <old ip> <old port> <new ip> <new port>",
+// and refreshes the replica on events of replicas of the master, "slave <name> <ip> <port> @ <master name> <ip> <port>"
+func (s *sentinel) handle(channel string, data string) {
+	fields := strings.Fields(data)
+	if channel == "+switch-master" {
+		if len(fields) == 5 && fields[0] == s.masterName {
+			s.setMaster(s.url(fields[3], fields[4]))
+			if s.opts.replicaReadOnly {
+				s.refreshReplica()
+			}
+		}
+		return
+	}
+	if len(fields) >= 6 && fields[4] == "@" && fields[5] == s.masterName {
+		s.refreshReplica()
+	}
+}
+
+// close stops watching and releases pools of master and replica,
+// the clients are kept, their commands get the error of the closed pool if no other cache uses it
+func (s *sentinel) close() {
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		close(s.done)
+		for _, serverUrl := range []string{s.masterUrl, s.replicaUrl} {
+			if serverUrl != "" {
+				internal.ReleaseRedisClient(serverUrl)
+			}
+		}
+	})
+}
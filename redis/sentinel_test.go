@@ -0,0 +1,53 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+)
+
+func newTestSentinel(opts ...SentinelOption) *sentinel {
+	o := &sentinelOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &sentinel{masterName: "mymaster", opts: o, maxIdle: 1, maxActive: 1, done: make(chan struct{})}
+}
+
+func TestSentinel_Url(t *testing.T) {
+	s := newTestSentinel(WithMasterPassword("pwd"), WithDB(2))
+	if u := s.url("10.0.1.11", "6379"); u != "redis://:pwd@10.0.1.11:6379/2" {
+		t.Error("TestSentinel_Url error", u)
+	}
+	s = newTestSentinel()
+	if u := s.url("::1", "6379"); u != "redis://[::1]:6379/0" {
+		t.Error("TestSentinel_Url ipv6 error", u)
+	}
+}
+
+func TestSentinel_SwitchMaster(t *testing.T) {
+	s := newTestSentinel()
+	s.setMaster(s.url("127.0.0.1", "6379"))
+
+	s.handle("+switch-master", "othermaster 127.0.0.1 6379 127.0.0.1 6381")
+	if m := s.masterClient(); m.Address != "redis://127.0.0.1:6379/0" {
+		t.Error("TestSentinel_SwitchMaster other master error", m.Address)
+	}
+	old := s.masterClient()
+	s.handle("+switch-master", "mymaster 127.0.0.1 6379 127.0.0.1 6380")
+	if m := s.masterClient(); m.Address != "redis://127.0.0.1:6380/0" {
+		t.Error("TestSentinel_SwitchMaster error", m.Address)
+	}
+	// the pool of the old master is released, a client held by a caller is not created again
+	if _, err := old.Get("key"); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Error("TestSentinel_SwitchMaster old master expect error of closed pool, got", err)
+	}
+
+	s.close()
+	s.handle("+switch-master", "mymaster 127.0.0.1 6380 127.0.0.1 6379")
+	if m := s.masterClient(); m.Address != "redis://127.0.0.1:6380/0" {
+		t.Error("TestSentinel_SwitchMaster after close error", m.Address)
+	}
+	if _, err := s.masterClient().Get("key"); err == nil || !strings.Contains(err.Error(), "closed") {
+		t.Error("TestSentinel_SwitchMaster after close expect error of closed pool, got", err)
+	}
+}
@@ -0,0 +1,151 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+// ErrTxConflict is returned by Tx when a watched key is modified before EXEC
+var ErrTxConflict = errors.New("cache: transaction aborted, watched key modified")
+
+// DefaultWatchRetries is the max number of times Watch runs fn when watched keys are modified
+const DefaultWatchRetries = 10
+
+// Tx is a MULTI/EXEC transaction on a single connection of the default server.
+// commands queued by fn, like Set, HIncrBy or ZAdd, are sent between MULTI and EXEC after fn returns nil,
+// their futures are ready after the transaction. Read, ReadString and ReadInt64 are sent immediately,
+// they are used to read watched keys.
+type Tx struct {
+	commands
+	conn redis.Conn
+	ctx  context.Context
+}
+
+// Tx runs fn and executes the commands queued by it atomically with MULTI/EXEC,
+// it is always sent to the default server. if fn returns an error, nothing is executed.
+// in cluster mode, use Watch so the transaction is sent to the node of the watched keys,
+// which must hash to the same slot.
+func (ca *redisCache) Tx(fn func(tx *Tx) error) error {
+	return ca.tx(nil, fn)
+}
+
+// Watch is Tx with optimistic locking, keys are watched before fn is called,
+// if any of them is modified before EXEC, the transaction is aborted and fn is called again,
+// at most DefaultWatchRetries times, then ErrTxConflict is returned.
+func (ca *redisCache) Watch(fn func(tx *Tx) error, keys ...string) error {
+	for i := 0; i < DefaultWatchRetries; i++ {
+		if err := ca.tx(keys, fn); err != ErrTxConflict {
+			return err
+		}
+	}
+	return ErrTxConflict
+}
+
+// TxCtx is Tx bounded by ctx.
+func (ca *redisCache) TxCtx(ctx context.Context, fn func(tx *Tx) error) error {
+	return ca.withContext(ctx).Tx(fn)
+}
+
+// WatchCtx is Watch bounded by ctx.
+func (ca *redisCache) WatchCtx(ctx context.Context, fn func(tx *Tx) error, keys ...string) error {
+	return ca.withContext(ctx).Watch(fn, keys...)
+}
+
+func (ca *redisCache) tx(keys []string, fn func(tx *Tx) error) error {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	// in cluster mode, the transaction is sent to the node of watched keys
+	client, err := ca.getDefaultRedis().Node(args...)
+	if err != nil {
+		return err
+	}
+	var conn redis.Conn
+	if ca.ctx != nil {
+		if conn, err = client.GetConnContext(ca.ctx); err != nil {
+			return err
+		}
+	} else {
+		conn = client.GetConn()
+	}
+	// a connection closed while watching is reset by the pool, so UNWATCH is not needed
+	defer conn.Close()
+
+	tx := &Tx{commands: commands{ca: ca}, conn: conn, ctx: ca.ctx}
+	if len(keys) > 0 {
+		if _, err := tx.do("WATCH", args...); err != nil {
+			return err
+		}
+	}
+	if err := fn(tx); err != nil {
+		fail(tx.setters, err)
+		return err
+	}
+	cmds, setters, _, err := tx.reset()
+	if err != nil {
+		fail(setters, err)
+		return err
+	}
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	if err := conn.Send("MULTI"); err != nil {
+		return err
+	}
+	for _, cmd := range cmds {
+		if err := conn.Send(cmd.Name, cmd.Args...); err != nil {
+			return err
+		}
+	}
+	if err := conn.Send("EXEC"); err != nil {
+		return err
+	}
+	reply, err := redis.Values(tx.do(""))
+	if err == nil && len(reply) > 0 {
+		reply, err = redis.Values(reply[len(reply)-1], nil)
+	}
+	if err == redis.ErrNil {
+		err = ErrTxConflict
+	}
+	if err != nil {
+		// EXECABORT or connection error
+		fail(setters, err)
+		return err
+	}
+	return fill(setters, reply)
+}
+
+// do sends a command on the transaction connection, bounded by the deadline of ctx
+func (tx *Tx) do(commandName string, args ...interface{}) (interface{}, error) {
+	if tx.ctx != nil {
+		if err := tx.ctx.Err(); err != nil {
+			return nil, err
+		}
+		if deadline, ok := tx.ctx.Deadline(); ok {
+			return redis.DoWithTimeout(tx.conn, time.Until(deadline), commandName, args...)
+		}
+	}
+	return tx.conn.Do(commandName, args...)
+}
+
+// Read sends a command on the transaction connection immediately, like Read("HGET", hashID, field)
+func (tx *Tx) Read(commandName string, args ...interface{}) (interface{}, error) {
+	reply, err := tx.do(commandName, args...)
+	return decompressReply(reply), err
+}
+
+// ReadString is Read with the reply converted to string, it returns redis.ErrNil if the reply is nil
+func (tx *Tx) ReadString(commandName string, args ...interface{}) (string, error) {
+	reply, err := redis.String(tx.do(commandName, args...))
+	return decompressString(reply), err
+}
+
+// ReadInt64 is Read with the reply converted to int64, it returns redis.ErrNil if the reply is nil
+func (tx *Tx) ReadInt64(commandName string, args ...interface{}) (int64, error) {
+	return redis.Int64(tx.do(commandName, args...))
+}
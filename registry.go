@@ -0,0 +1,34 @@
+package cache
+
+// registeredRuntimeCache is the cache returned by GetRuntimeCache,
+// Close also removes it, so the next GetRuntimeCache creates a new one.
+type registeredRuntimeCache struct {
+	CacheCtx
+}
+
+// Close close runtime cache and remove it from registry
+func (c *registeredRuntimeCache) Close() error {
+	runtimeCacheLock.Lock()
+	if runtime_cache == Cache(c) {
+		runtime_cache = nil
+	}
+	runtimeCacheLock.Unlock()
+	return c.CacheCtx.Close()
+}
+
+// registeredRedisCache is the cache returned by GetRedisCache,
+// Close also removes it, so the next GetRedisCache creates a new one.
+type registeredRedisCache struct {
+	RedisCacheCtx
+	serverUrl string
+}
+
+// Close close redis cache and remove it from registry
+func (c *registeredRedisCache) Close() error {
+	redisCacheLock.Lock()
+	if redisCacheMap[c.serverUrl] == RedisCache(c) {
+		delete(redisCacheMap, c.serverUrl)
+	}
+	redisCacheLock.Unlock()
+	return c.RedisCacheCtx.Close()
+}
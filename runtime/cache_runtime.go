@@ -3,9 +3,13 @@ package runtime
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"sync"
 	"time"
+
+	"github.com/devfeel/cache/internal/cacheerr"
+	"github.com/devfeel/cache/internal/singleflight"
 )
 
 var (
@@ -14,11 +18,29 @@ var (
 	ZeroInt64         int64 = 0
 )
 
+var (
+	// ErrNotFound is returned by getters in strict mode when the key does not exist or is expired.
+	ErrNotFound = cacheerr.ErrNotFound
+	// ErrCostTooLarge is returned by Set when an item costs more than the max cost of the cache.
+	ErrCostTooLarge = errors.New("item cost is larger than cache max cost")
+	// ErrOverflow is returned by counters when the result does not fit the stored type.
+	ErrOverflow = cacheerr.ErrOverflow
+	// ErrTypeMismatch is returned by counters when the stored value is not a number,
+	// and by GetInt, GetInt64 in strict mode when the value is not an integer.
+	ErrTypeMismatch = cacheerr.ErrTypeMismatch
+)
+
 // RuntimeItem store runtime cache item.
 type RuntimeItem struct {
+	key        string
 	value      interface{}
 	createTime time.Time
 	ttl        time.Duration
+	// softTTL is the age after which the item is refreshed by the loader, 0 means never
+	softTTL time.Duration
+	cost    int64
+	// index in the expire heap, -1 if the item has no ttl
+	index int
 }
 
 //check item is expire
@@ -30,56 +52,118 @@ func (mi *RuntimeItem) isExpire() bool {
 	return time.Now().Sub(mi.createTime) > mi.ttl
 }
 
+// check item is older than its soft ttl
+func (mi *RuntimeItem) isStale() bool {
+	// 0 means never
+	if mi.softTTL == 0 {
+		return false
+	}
+	return time.Now().Sub(mi.createTime) > mi.softTTL
+}
+
 // RuntimeCache is runtime cache adapter.
 // it contains a RW locker for safe map storage.
 type RuntimeCache struct {
 	sync.RWMutex
 	gcInterval time.Duration
 	items      map[string]*RuntimeItem
+	// expires holds items with a ttl, the earliest deadline first
+	expires expireHeap
+	wakeup  chan struct{}
+	// done is closed by Close to stop the gc goroutine
+	done      chan struct{}
+	closeOnce sync.Once
+	// policy is only set when the cache is bounded by WithMaxEntries or WithMaxCost
+	policy EvictionPolicy
+	stats  *cacheStats
+	// cost is the total cost of items, only tracked when maxCost is set
+	cost    int64
+	maxCost int64
+	sizer   Sizer
+	// strict makes getters return ErrNotFound and ErrTypeMismatch
+	strict bool
+	// loads collapses concurrent loads of GetOrLoad
+	loads singleflight.Group
+	// refreshes runs one refresh of a stale item at a time, apart from loads,
+	// so a load of GetOrLoad never shares the value of a refresh which is not set
+	refreshes singleflight.Group
+	// loader refreshes items set by SetWithSoftTTL
+	loader func(key string) (interface{}, error)
 }
 
 // NewRuntimeCache returns a new *RuntimeCache.
-func NewRuntimeCache() *RuntimeCache {
-	cache := &RuntimeCache{items: make(map[string]*RuntimeItem), gcInterval: DefaultGCInterval}
+// with no option, the cache is unbounded.
+func NewRuntimeCache(opts ...Option) *RuntimeCache {
+	return newRuntimeCache(newOptions(opts...))
+}
+
+func newRuntimeCache(o *options) *RuntimeCache {
+	cache := &RuntimeCache{
+		items:      make(map[string]*RuntimeItem),
+		gcInterval: o.gcInterval,
+		wakeup:     make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		stats:      new(cacheStats),
+		maxCost:    o.maxCost,
+		sizer:      o.sizer,
+		strict:     o.strict,
+		loader:     o.loader,
+	}
+	if o.maxEntries > 0 || o.maxCost > 0 {
+		cache.policy = o.policy(o.maxEntries)
+	}
 	go cache.gc()
 	return cache
 }
 
 // Get cache from runtime cache.
-// if non-existed or expired, return nil.
+// if non-existed or expired, return nil, or ErrNotFound in strict mode.
 func (ca *RuntimeCache) Get(key string) (interface{}, error) {
-	ca.RLock()
-	defer ca.RUnlock()
-	if item, ok := ca.items[key]; ok {
-		if item.isExpire() {
-			return nil, nil
+	if ca.policy != nil {
+		// the policy is updated on read, so a bounded cache needs the write lock
+		ca.Lock()
+		defer ca.Unlock()
+	} else {
+		ca.RLock()
+		defer ca.RUnlock()
+	}
+	if item, ok := ca.items[key]; ok && !item.isExpire() {
+		if ca.policy != nil {
+			ca.policy.Access(key)
 		}
+		ca.stats.hit()
+		ca.revalidate(item)
 		return item.value, nil
 	}
+	ca.stats.miss()
+	if ca.strict {
+		return nil, ErrNotFound
+	}
 	return nil, nil
 }
 
 // returns value string format by given key
-// if non-existed or expired, return "".
+// if non-existed or expired, return "", or ErrNotFound in strict mode.
 func (ca *RuntimeCache) GetString(key string) (string, error) {
 	v, err := ca.Get(key)
 	if err != nil || v == nil {
-		return "", nil
+		return "", err
 	} else {
 		return fmt.Sprint(v), nil
 	}
 }
 
 // returns value int format by given key
-// if non-existed or expired, return 0.
+// if non-existed or expired, return 0, or ErrNotFound in strict mode.
+// if not an integer, return 0, or ErrTypeMismatch in strict mode.
 func (ca *RuntimeCache) GetInt(key string) (int, error) {
 	v, err := ca.GetString(key)
-	if err != nil || v == "" {
-		return 0, nil
+	if err != nil || (v == "" && !ca.strict) {
+		return 0, err
 	} else {
 		i, e := strconv.Atoi(v)
 		if e != nil {
-			return 0, nil
+			return 0, ca.typeMismatch()
 		} else {
 			return i, nil
 		}
@@ -87,112 +171,243 @@ func (ca *RuntimeCache) GetInt(key string) (int, error) {
 }
 
 // returns value int64 format by given key
-// if non-existed or expired, return 0.
+// if non-existed or expired, return 0, or ErrNotFound in strict mode.
+// if not an integer, return 0, or ErrTypeMismatch in strict mode.
 func (ca *RuntimeCache) GetInt64(key string) (int64, error) {
 	v, err := ca.GetString(key)
-	if err != nil || v == "" {
-		return ZeroInt64, nil
+	if err != nil || (v == "" && !ca.strict) {
+		return ZeroInt64, err
 	} else {
 		i, e := strconv.ParseInt(v, 10, 64)
 		if e != nil {
-			return ZeroInt64, nil
+			return ZeroInt64, ca.typeMismatch()
 		} else {
 			return i, nil
 		}
 	}
 }
 
+// typeMismatch returns ErrTypeMismatch in strict mode, nil otherwise.
+func (ca *RuntimeCache) typeMismatch() error {
+	if ca.strict {
+		return ErrTypeMismatch
+	}
+	return nil
+}
+
 // Set cache to runtime.
 // ttl is second, if ttl is 0, it will be forever till restart.
+// if the cache is bounded by WithMaxCost, the cost is computed by its Sizer.
 func (ca *RuntimeCache) Set(key string, value interface{}, ttl int64) error {
+	var cost int64
+	if ca.maxCost > 0 {
+		cost = ca.sizer(value)
+	}
+	return ca.SetWithCost(key, value, ttl, cost)
+}
+
+// SetWithCost set cache to runtime with an explicit cost, usually in bytes.
+// ttl is second, if ttl is 0, it will be forever till restart.
+// cost is ignored if the cache is not bounded by WithMaxCost,
+// if cost is larger than max cost, return ErrCostTooLarge.
+func (ca *RuntimeCache) SetWithCost(key string, value interface{}, ttl int64, cost int64) error {
+	if ca.maxCost > 0 && cost > ca.maxCost {
+		return ErrCostTooLarge
+	}
 	ca.Lock()
 	defer ca.Unlock()
-	ca.items[key] = &RuntimeItem{
+	ca.setItem(key, value, ttl, cost)
+	return nil
+}
+
+// SetWithSoftTTL set cache to runtime with a soft ttl, softTTL and ttl are second.
+// after softTTL, Get returns the stale value and the loader of WithLoader refreshes it in the background,
+// the item is deleted after ttl, if ttl is 0, it will be forever till restart.
+// if softTTL is 0, or not less than a ttl which is not 0, it is the same as Set.
+func (ca *RuntimeCache) SetWithSoftTTL(key string, value interface{}, softTTL int64, ttl int64) error {
+	var cost int64
+	if ca.maxCost > 0 {
+		cost = ca.sizer(value)
+		if cost > ca.maxCost {
+			return ErrCostTooLarge
+		}
+	}
+	ca.Lock()
+	defer ca.Unlock()
+	ca.setItem(key, value, ttl, cost)
+	if item, ok := ca.items[key]; ok && softTTL > 0 && (ttl == 0 || softTTL < ttl) {
+		item.softTTL = time.Duration(softTTL) * time.Second
+	}
+	return nil
+}
+
+// revalidate starts a refresh of item if it is stale, unless a refresh of its key is running.
+// the caller must hold the lock.
+func (ca *RuntimeCache) revalidate(item *RuntimeItem) {
+	if ca.loader == nil || !item.isStale() {
+		return
+	}
+	ca.refreshes.Go(item.key, func() (interface{}, error) {
+		return ca.refresh(item)
+	})
+}
+
+// refresh calls the loader and replaces item with its value, with the same soft ttl and ttl.
+// nothing is set if loader fails, or if item was changed, deleted or refreshed while loader runs.
+func (ca *RuntimeCache) refresh(item *RuntimeItem) (interface{}, error) {
+	v, err := ca.loader(item.key)
+	if err != nil || v == nil {
+		return v, err
+	}
+	var cost int64
+	if ca.maxCost > 0 {
+		if cost = ca.sizer(v); cost > ca.maxCost {
+			return nil, ErrCostTooLarge
+		}
+	}
+	ca.Lock()
+	defer ca.Unlock()
+	if ca.items[item.key] != item {
+		return v, nil
+	}
+	ca.setItem(item.key, v, int64(item.ttl/time.Second), cost)
+	if refreshed, ok := ca.items[item.key]; ok {
+		refreshed.softTTL = item.softTTL
+	}
+	return v, nil
+}
+
+// setItem stores the item and evicts others if needed, the caller must hold the write lock.
+func (ca *RuntimeCache) setItem(key string, value interface{}, ttl int64, cost int64) {
+	if old, ok := ca.items[key]; ok {
+		ca.cost -= old.cost
+		ca.untrackExpire(old)
+	}
+	item := &RuntimeItem{
+		key:        key,
 		value:      value,
 		createTime: time.Now(),
 		ttl:        time.Duration(ttl) * time.Second,
+		cost:       cost,
+		index:      -1,
+	}
+	ca.items[key] = item
+	ca.trackExpire(item)
+	ca.cost += cost
+	if ca.policy != nil {
+		for _, victim := range ca.policy.Add(key) {
+			ca.evictItem(victim)
+		}
+		ca.evictOverCost()
 	}
-	return nil
 }
 
-// Incr increase int64 counter in runtime cache.
-func (ca *RuntimeCache) Incr(key string) (int64, error) {
-	ca.RLock()
-	item, ok := ca.items[key]
-	ca.RUnlock()
-	if !ok {
-		//if not exists, auto set new with 0
-		ca.Set(key, ZeroInt64, 0)
-		//reload
-		ca.RLock()
-		item, _ = ca.items[key]
-		ca.RUnlock()
+// evictOverCost evicts items chosen by the policy until the total cost fits max cost,
+// the caller must hold the write lock.
+func (ca *RuntimeCache) evictOverCost() {
+	for ca.maxCost > 0 && ca.cost > ca.maxCost {
+		victim, ok := ca.policy.Evict()
+		if !ok {
+			break
+		}
+		ca.evictItem(victim)
 	}
+}
 
-	switch item.value.(type) {
-	case int:
-		item.value = item.value.(int) + 1
-	case int32:
-		item.value = item.value.(int32) + 1
-	case int64:
-		item.value = item.value.(int64) + 1
-	case uint:
-		item.value = item.value.(uint) + 1
-	case uint32:
-		item.value = item.value.(uint32) + 1
-	case uint64:
-		item.value = item.value.(uint64) + 1
-	default:
-		return 0, errors.New("item val is not (u)int (u)int32 (u)int64")
+// recost computes the cost of item again after its value changed, and evicts items if needed.
+// it does nothing if the cache is not bounded by WithMaxCost, the caller must hold the write lock.
+func (ca *RuntimeCache) recost(item *RuntimeItem) {
+	if ca.maxCost == 0 || ca.items[item.key] != item {
+		return
 	}
+	cost := ca.sizer(item.value)
+	ca.cost += cost - item.cost
+	item.cost = cost
+	ca.evictOverCost()
+}
 
-	val, _ := strconv.ParseInt(fmt.Sprint(item.value), 10, 64)
-	return val, nil
+// Cost returns the total cost of items in cache,
+// it is always 0 if the cache is not bounded by WithMaxCost.
+func (ca *RuntimeCache) Cost() int64 {
+	ca.RLock()
+	defer ca.RUnlock()
+	return ca.cost
+}
+
+// Incr increase int64 counter in runtime cache.
+// if not exists, auto set new with 0 before increase.
+func (ca *RuntimeCache) Incr(key string) (int64, error) {
+	return ca.IncrBy(key, 1)
 }
 
 // Decr decrease counter in runtime cache.
+// if not exists, auto set new with 0 before decrease.
 func (ca *RuntimeCache) Decr(key string) (int64, error) {
-	ca.RLock()
-	item, ok := ca.items[key]
-	ca.RUnlock()
-	if !ok {
-		//if not exists, auto set new with 0
-		ca.Set(key, ZeroInt64, 0)
-		//reload
-		ca.RLock()
-		item, _ = ca.items[key]
-		ca.RUnlock()
-	}
-	switch item.value.(type) {
-	case int:
-		item.value = item.value.(int) - 1
-	case int64:
-		item.value = item.value.(int64) - 1
-	case int32:
-		item.value = item.value.(int32) - 1
-	case uint:
-		if item.value.(uint) > 0 {
-			item.value = item.value.(uint) - 1
-		} else {
-			return 0, errors.New("item val is less than 0")
-		}
-	case uint32:
-		if item.value.(uint32) > 0 {
-			item.value = item.value.(uint32) - 1
-		} else {
-			return 0, errors.New("item val is less than 0")
-		}
-	case uint64:
-		if item.value.(uint64) > 0 {
-			item.value = item.value.(uint64) - 1
-		} else {
-			return 0, errors.New("item val is less than 0")
+	return ca.DecrBy(key, 1)
+}
+
+// IncrBy increase counter in runtime cache by delta, atomically.
+// if not exists, auto set new with 0 before increase.
+// the stored (u)int, (u)int32, int64, uint64 or numeric string type is kept,
+// return ErrOverflow if the result does not fit it, ErrTypeMismatch for other types.
+func (ca *RuntimeCache) IncrBy(key string, delta int64) (int64, error) {
+	ca.Lock()
+	defer ca.Unlock()
+	item := ca.counterItem(key)
+	value, result, err := incrValue(item.value, delta)
+	if err != nil {
+		return 0, err
+	}
+	item.value = value
+	ca.recost(item)
+	return result, nil
+}
+
+// DecrBy decrease counter in runtime cache by delta, atomically.
+// if not exists, auto set new with 0 before decrease.
+func (ca *RuntimeCache) DecrBy(key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrOverflow
+	}
+	return ca.IncrBy(key, -delta)
+}
+
+// IncrByFloat increase float counter in runtime cache by delta, atomically.
+// if not exists, auto set new with 0 before increase.
+// float32 and numeric string types are kept, integer values are stored as float64 after increase.
+// return ErrOverflow if the result is NaN or Infinity, ErrTypeMismatch for other types.
+func (ca *RuntimeCache) IncrByFloat(key string, delta float64) (float64, error) {
+	ca.Lock()
+	defer ca.Unlock()
+	item := ca.counterItem(key)
+	value, result, err := incrFloatValue(item.value, delta)
+	if err != nil {
+		return 0, err
+	}
+	item.value = value
+	ca.recost(item)
+	return result, nil
+}
+
+// counterItem returns the item of key, set with 0 if not exists or expired.
+// the caller must hold the write lock.
+func (ca *RuntimeCache) counterItem(key string) *RuntimeItem {
+	if item, ok := ca.items[key]; ok && !item.isExpire() {
+		if ca.policy != nil {
+			ca.policy.Access(key)
 		}
-	default:
-		return 0, errors.New("item val is not int int64 int32")
+		return item
 	}
-	val, _ := strconv.ParseInt(fmt.Sprint(item.value), 10, 64)
-	return val, nil
+	var cost int64
+	if ca.maxCost > 0 {
+		cost = ca.sizer(ZeroInt64)
+	}
+	ca.setItem(key, ZeroInt64, 0, cost)
+	if item, ok := ca.items[key]; ok {
+		return item
+	}
+	// refused by the eviction policy, the result is computed but not kept
+	return &RuntimeItem{key: key, value: ZeroInt64, index: -1}
 }
 
 // Exist check item exist in runtime cache.
@@ -214,27 +429,116 @@ func (ca *RuntimeCache) Delete(key string) error {
 		//if not exists, we think it's success
 		return nil
 	}
-	delete(ca.items, key)
+	ca.removeItem(key)
 	if _, ok := ca.items[key]; ok {
 		return errors.New("delete key error")
 	}
 	return nil
 }
 
+// MGet returns values of keys with a single lock acquisition,
+// keys which non-existed or expired are not in the returned map.
+func (ca *RuntimeCache) MGet(keys ...string) (map[string]interface{}, error) {
+	if ca.policy != nil {
+		ca.Lock()
+		defer ca.Unlock()
+	} else {
+		ca.RLock()
+		defer ca.RUnlock()
+	}
+	items := make(map[string]interface{}, len(keys))
+	for _, key := range keys {
+		if item, ok := ca.items[key]; ok && !item.isExpire() {
+			if ca.policy != nil {
+				ca.policy.Access(key)
+			}
+			ca.stats.hit()
+			ca.revalidate(item)
+			items[key] = item.value
+			continue
+		}
+		ca.stats.miss()
+	}
+	return items, nil
+}
+
+// MSet set all items with a single lock acquisition.
+// ttl is second, if ttl is 0, it will be forever till restart.
+// if the cost of any item is larger than max cost, return ErrCostTooLarge and set nothing.
+func (ca *RuntimeCache) MSet(items map[string]interface{}, ttl int64) error {
+	var costs map[string]int64
+	if ca.maxCost > 0 {
+		costs = make(map[string]int64, len(items))
+		for key, value := range items {
+			cost := ca.sizer(value)
+			if cost > ca.maxCost {
+				return ErrCostTooLarge
+			}
+			costs[key] = cost
+		}
+	}
+	ca.Lock()
+	defer ca.Unlock()
+	for key, value := range items {
+		ca.setItem(key, value, ttl, costs[key])
+	}
+	return nil
+}
+
+// MDelete delete items by given keys with a single lock acquisition.
+// if not exists, we think it's success
+func (ca *RuntimeCache) MDelete(keys ...string) error {
+	ca.Lock()
+	defer ca.Unlock()
+	for _, key := range keys {
+		ca.removeItem(key)
+	}
+	return nil
+}
+
+// GetOrLoad returns value by given key, on a miss it calls loader and sets its value with ttl.
+// concurrent misses of the same key wait for one loader call and share its result.
+// if loader returns an error or a nil value, nothing is set.
+func (ca *RuntimeCache) GetOrLoad(key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	if v, err := ca.Get(key); v != nil || (err != nil && err != ErrNotFound) {
+		return v, err
+	}
+	return ca.loads.Do(key, func() (interface{}, error) {
+		// the value may be set by the load which just finished
+		if v := ca.peek(key); v != nil {
+			return v, nil
+		}
+		v, err := loader()
+		if err != nil || v == nil {
+			return v, err
+		}
+		return v, ca.Set(key, v, ttl)
+	})
+}
+
+// peek returns the value of key, without updating stats and the eviction policy
+func (ca *RuntimeCache) peek(key string) interface{} {
+	ca.RLock()
+	defer ca.RUnlock()
+	if item, ok := ca.items[key]; ok && !item.isExpire() {
+		return item.value
+	}
+	return nil
+}
+
 // Expire Set a timeout on key. After the timeout has expired, the key will automatically be deleted.
 // timeout time duration is second
 // if not exists key, return 0, nil
-func (ca *RuntimeCache) Expire(key string, timeOutSeconds int) (int, error){
-	item, ok := ca.getRuntimeItem(key)
+func (ca *RuntimeCache) Expire(key string, timeOutSeconds int) (int, error) {
+	ca.Lock()
+	defer ca.Unlock()
+	item, ok := ca.items[key]
 	if !ok {
 		return 0, nil
-	}else{
-		item.ttl = time.Duration(timeOutSeconds) * time.Second
-		ca.Lock()
-		ca.items[key] = item
-		ca.Unlock()
-		return timeOutSeconds, nil
 	}
+	item.ttl = time.Duration(timeOutSeconds) * time.Second
+	ca.trackExpire(item)
+	return timeOutSeconds, nil
 }
 
 // ClearAll will delete all item in runtime cache.
@@ -242,40 +546,52 @@ func (ca *RuntimeCache) ClearAll() error {
 	ca.Lock()
 	defer ca.Unlock()
 	ca.items = make(map[string]*RuntimeItem)
+	ca.expires = nil
+	ca.cost = 0
+	if ca.policy != nil {
+		ca.policy.Clear()
+	}
 	return nil
 }
 
-func (ca *RuntimeCache) gc() {
-	for {
-		<-time.After(ca.gcInterval)
-		if ca.items == nil {
-			return
-		}
-		for name := range ca.items {
-			ca.itemExpired(name)
-		}
-	}
+// Close stops the gc goroutine and deletes all items.
+// the cache must not be used after Close.
+func (ca *RuntimeCache) Close() error {
+	ca.closeOnce.Do(func() {
+		close(ca.done)
+		ca.ClearAll()
+	})
+	return nil
 }
 
-// getRuntimeItem get RuntimeItem by key
-func (ca *RuntimeCache) getRuntimeItem(key string) (*RuntimeItem, bool){
-	ca.RLock()
-	defer ca.RUnlock()
-	item, ok := ca.items[key]
-	return item, ok
+// Stats returns a snapshot of hit, miss and eviction counters.
+func (ca *RuntimeCache) Stats() Stats {
+	return ca.stats.snapshot()
 }
 
-// itemExpired returns true if an item is expired.
-func (ca *RuntimeCache) itemExpired(key string) bool {
-	itm, ok := ca.getRuntimeItem(key)
-	if !ok {
-		return true
+// ResetStats sets all counters to zero.
+func (ca *RuntimeCache) ResetStats() {
+	ca.stats.reset()
+}
+
+// removeItem deletes key from items and policy, the caller must hold the write lock.
+func (ca *RuntimeCache) removeItem(key string) {
+	if item, ok := ca.items[key]; ok {
+		ca.cost -= item.cost
+		ca.untrackExpire(item)
+		delete(ca.items, key)
 	}
-	if itm.isExpire() {
-		ca.Lock()
+	if ca.policy != nil {
+		ca.policy.Remove(key)
+	}
+}
+
+// evictItem deletes key chosen by the policy, the caller must hold the write lock.
+func (ca *RuntimeCache) evictItem(key string) {
+	if item, ok := ca.items[key]; ok {
+		ca.cost -= item.cost
+		ca.untrackExpire(item)
 		delete(ca.items, key)
-		ca.Unlock()
-		return true
+		ca.stats.evict(1)
 	}
-	return false
 }
@@ -0,0 +1,149 @@
+package runtime
+
+import "context"
+
+// the runtime cache never waits for I/O, so Ctx methods only check ctx before running the operation.
+
+// ExistsCtx is Exists, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) ExistsCtx(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return ca.Exists(key)
+}
+
+// GetCtx is Get, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ca.Get(key)
+}
+
+// GetStringCtx is GetString, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) GetStringCtx(ctx context.Context, key string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return ca.GetString(key)
+}
+
+// GetIntCtx is GetInt, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) GetIntCtx(ctx context.Context, key string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return ca.GetInt(key)
+}
+
+// GetInt64Ctx is GetInt64, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) GetInt64Ctx(ctx context.Context, key string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return ca.GetInt64(key)
+}
+
+// SetCtx is Set, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) SetCtx(ctx context.Context, key string, v interface{}, ttl int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ca.Set(key, v, ttl)
+}
+
+// IncrCtx is Incr, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) IncrCtx(ctx context.Context, key string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return ca.Incr(key)
+}
+
+// DecrCtx is Decr, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) DecrCtx(ctx context.Context, key string) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return ca.Decr(key)
+}
+
+// IncrByCtx is IncrBy, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) IncrByCtx(ctx context.Context, key string, delta int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return ca.IncrBy(key, delta)
+}
+
+// DecrByCtx is DecrBy, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) DecrByCtx(ctx context.Context, key string, delta int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return ca.DecrBy(key, delta)
+}
+
+// IncrByFloatCtx is IncrByFloat, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) IncrByFloatCtx(ctx context.Context, key string, delta float64) (float64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return ca.IncrByFloat(key, delta)
+}
+
+// DeleteCtx is Delete, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) DeleteCtx(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ca.Delete(key)
+}
+
+// ClearAllCtx is ClearAll, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) ClearAllCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ca.ClearAll()
+}
+
+// ExpireCtx is Expire, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) ExpireCtx(ctx context.Context, key string, timeOutSeconds int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return ca.Expire(key, timeOutSeconds)
+}
+
+// MGetCtx is MGet, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) MGetCtx(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ca.MGet(keys...)
+}
+
+// MSetCtx is MSet, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) MSetCtx(ctx context.Context, items map[string]interface{}, ttl int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ca.MSet(items, ttl)
+}
+
+// MDeleteCtx is MDelete, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) MDeleteCtx(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ca.MDelete(keys...)
+}
+
+// GetOrLoadCtx is GetOrLoad, it returns ctx.Err() if ctx is done.
+func (ca *RuntimeCache) GetOrLoadCtx(ctx context.Context, key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ca.GetOrLoad(key, ttl, loader)
+}
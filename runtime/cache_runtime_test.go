@@ -1 +1,446 @@
 package runtime
+
+import (
+	"context"
+	"math"
+	goruntime "runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRuntimeCache_MaxEntries(t *testing.T) {
+	rc := NewRuntimeCache(WithMaxEntries(2))
+	rc.Set("1", 1, 0)
+	rc.Set("2", 2, 0)
+	// touch 1, so 2 becomes the least recently used one
+	rc.Get("1")
+	rc.Set("3", 3, 0)
+
+	if exists, _ := rc.Exists("2"); exists {
+		t.Error("TestRuntimeCache_MaxEntries key 2 should be evicted")
+	}
+	for _, key := range []string{"1", "3"} {
+		if exists, _ := rc.Exists(key); !exists {
+			t.Error("TestRuntimeCache_MaxEntries key", key, "should exist")
+		}
+	}
+}
+
+func TestRuntimeCache_MaxEntries_Unbounded(t *testing.T) {
+	rc := NewRuntimeCache()
+	for i := 0; i < 100; i++ {
+		rc.Set(strconv.Itoa(i), i, 0)
+	}
+	if len(rc.items) != 100 {
+		t.Error("TestRuntimeCache_MaxEntries_Unbounded expect 100 items, got", len(rc.items))
+	}
+}
+
+func TestRuntimeCache_MaxCost(t *testing.T) {
+	rc := NewRuntimeCache(WithMaxCost(10))
+	rc.Set("1", "12345", 0)
+	rc.Set("2", "12345", 0)
+	if rc.Cost() != 10 {
+		t.Error("TestRuntimeCache_MaxCost expect cost 10, got", rc.Cost())
+	}
+	rc.Set("3", "123", 0)
+	if exists, _ := rc.Exists("1"); exists {
+		t.Error("TestRuntimeCache_MaxCost key 1 should be evicted")
+	}
+	if rc.Cost() != 8 {
+		t.Error("TestRuntimeCache_MaxCost expect cost 8, got", rc.Cost())
+	}
+	if err := rc.Set("4", "12345678901", 0); err != ErrCostTooLarge {
+		t.Error("TestRuntimeCache_MaxCost expect ErrCostTooLarge, got", err)
+	}
+	rc.Delete("2")
+	if rc.Cost() != 3 {
+		t.Error("TestRuntimeCache_MaxCost expect cost 3 after delete, got", rc.Cost())
+	}
+}
+
+func TestRuntimeCache_CounterCost(t *testing.T) {
+	rc := NewRuntimeCache(WithMaxCost(10))
+	rc.Set("counter", "9", 0)
+	rc.Set("other", "12345", 0)
+	rc.IncrBy("counter", 99990)
+	if rc.Cost() != 10 {
+		t.Error("TestRuntimeCache_CounterCost expect cost 10 after IncrBy, got", rc.Cost())
+	}
+	rc.IncrBy("counter", 1)
+	if exists, _ := rc.Exists("other"); exists {
+		t.Error("TestRuntimeCache_CounterCost key other should be evicted")
+	}
+	if rc.Cost() != 6 {
+		t.Error("TestRuntimeCache_CounterCost expect cost 6, got", rc.Cost())
+	}
+	rc.Set("float", "1", 0)
+	rc.IncrByFloat("float", 0.25)
+	if rc.Cost() != 10 {
+		t.Error("TestRuntimeCache_CounterCost expect cost 10 after IncrByFloat, got", rc.Cost())
+	}
+}
+
+func TestRuntimeCache_SetWithCost(t *testing.T) {
+	rc := NewRuntimeCache(WithMaxCost(100))
+	rc.SetWithCost("1", 1, 0, 60)
+	rc.SetWithCost("1", 1, 0, 30)
+	if rc.Cost() != 30 {
+		t.Error("TestRuntimeCache_SetWithCost overwrite expect cost 30, got", rc.Cost())
+	}
+	rc.SetWithCost("2", 2, 0, 80)
+	if exists, _ := rc.Exists("1"); exists {
+		t.Error("TestRuntimeCache_SetWithCost key 1 should be evicted")
+	}
+	rc.ClearAll()
+	if rc.Cost() != 0 {
+		t.Error("TestRuntimeCache_SetWithCost expect cost 0 after ClearAll, got", rc.Cost())
+	}
+}
+
+func TestRuntimeCache_IncrConcurrent(t *testing.T) {
+	rc := NewRuntimeCache()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				rc.Incr("counter")
+				rc.IncrBy("counter", 2)
+				rc.Decr("counter")
+			}
+		}()
+	}
+	wg.Wait()
+	if v, _ := rc.GetInt64("counter"); v != 10000 {
+		t.Error("TestRuntimeCache_IncrConcurrent expect 10000, got", v)
+	}
+}
+
+func TestRuntimeCache_IncrBy(t *testing.T) {
+	rc := NewRuntimeCache()
+	rc.Set("int32", int32(math.MaxInt32-1), 0)
+	if v, err := rc.IncrBy("int32", 1); err != nil || v != math.MaxInt32 {
+		t.Error("TestRuntimeCache_IncrBy int32 expect", math.MaxInt32, "got", v, err)
+	}
+	if _, err := rc.IncrBy("int32", 1); err != ErrOverflow {
+		t.Error("TestRuntimeCache_IncrBy int32 expect ErrOverflow, got", err)
+	}
+	rc.Set("uint", uint(1), 0)
+	if _, err := rc.DecrBy("uint", 2); err != ErrOverflow {
+		t.Error("TestRuntimeCache_IncrBy uint expect ErrOverflow, got", err)
+	}
+	if _, err := rc.DecrBy("new", math.MinInt64); err != ErrOverflow {
+		t.Error("TestRuntimeCache_IncrBy MinInt64 expect ErrOverflow, got", err)
+	}
+	rc.Set("string", "10", 0)
+	if v, err := rc.IncrBy("string", 5); err != nil || v != 15 {
+		t.Error("TestRuntimeCache_IncrBy string expect 15, got", v, err)
+	}
+	rc.Set("text", "abc", 0)
+	if _, err := rc.IncrBy("text", 1); err != ErrTypeMismatch {
+		t.Error("TestRuntimeCache_IncrBy text expect ErrTypeMismatch, got", err)
+	}
+}
+
+func TestRuntimeCache_IncrByFloat(t *testing.T) {
+	rc := NewRuntimeCache()
+	if v, err := rc.IncrByFloat("float", 1.5); err != nil || v != 1.5 {
+		t.Error("TestRuntimeCache_IncrByFloat expect 1.5, got", v, err)
+	}
+	if v, err := rc.IncrByFloat("float", 0.25); err != nil || v != 1.75 {
+		t.Error("TestRuntimeCache_IncrByFloat expect 1.75, got", v, err)
+	}
+	rc.Set("max", math.MaxFloat64, 0)
+	if _, err := rc.IncrByFloat("max", math.MaxFloat64); err != ErrOverflow {
+		t.Error("TestRuntimeCache_IncrByFloat expect ErrOverflow, got", err)
+	}
+	rc.Set("struct", struct{}{}, 0)
+	if _, err := rc.IncrByFloat("struct", 1); err != ErrTypeMismatch {
+		t.Error("TestRuntimeCache_IncrByFloat expect ErrTypeMismatch, got", err)
+	}
+}
+
+func TestRuntimeCache_ExpireGC(t *testing.T) {
+	rc := NewRuntimeCache(WithGCInterval(time.Hour))
+	rc.Set("forever", 1, 0)
+	rc.Set("short", 1, 1)
+	rc.Set("long", 1, 1)
+	rc.Expire("long", 3600)
+	time.Sleep(1500 * time.Millisecond)
+
+	rc.RLock()
+	_, short := rc.items["short"]
+	_, long := rc.items["long"]
+	count := len(rc.expires)
+	rc.RUnlock()
+	if short {
+		t.Error("TestRuntimeCache_ExpireGC key short should be deleted by gc")
+	}
+	if !long {
+		t.Error("TestRuntimeCache_ExpireGC key long should exist")
+	}
+	if count != 1 {
+		t.Error("TestRuntimeCache_ExpireGC expect 1 tracked item, got", count)
+	}
+	rc.Expire("long", 0)
+	rc.Delete("forever")
+	rc.RLock()
+	count = len(rc.expires)
+	rc.RUnlock()
+	if count != 0 {
+		t.Error("TestRuntimeCache_ExpireGC expect 0 tracked item, got", count)
+	}
+}
+
+func TestRuntimeCache_Close(t *testing.T) {
+	before := goruntime.NumGoroutine()
+	caches := make([]*RuntimeCache, 10)
+	for i := range caches {
+		caches[i] = NewRuntimeCache()
+		caches[i].Set("1", 1, 0)
+	}
+	for _, rc := range caches {
+		if err := rc.Close(); err != nil {
+			t.Error("TestRuntimeCache_Close expect nil error, got", err)
+		}
+		// Close twice is safe
+		rc.Close()
+	}
+	after := goruntime.NumGoroutine()
+	for i := 0; i < 100 && after > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+		after = goruntime.NumGoroutine()
+	}
+	if after > before {
+		t.Error("TestRuntimeCache_Close gc goroutines leaked, before", before, "after", after)
+	}
+	if exists, _ := caches[0].Exists("1"); exists {
+		t.Error("TestRuntimeCache_Close key 1 should be deleted")
+	}
+}
+
+func TestRuntimeCache_StrictMode(t *testing.T) {
+	rc := NewRuntimeCache()
+	if v, err := rc.GetInt("none"); v != 0 || err != nil {
+		t.Error("TestRuntimeCache_StrictMode default mode expect 0, nil, got", v, err)
+	}
+
+	rc = NewRuntimeCache(WithStrictMode())
+	if _, err := rc.Get("none"); err != ErrNotFound {
+		t.Error("TestRuntimeCache_StrictMode Get expect ErrNotFound, got", err)
+	}
+	if _, err := rc.GetString("none"); err != ErrNotFound {
+		t.Error("TestRuntimeCache_StrictMode GetString expect ErrNotFound, got", err)
+	}
+	if _, err := rc.GetInt64("none"); err != ErrNotFound {
+		t.Error("TestRuntimeCache_StrictMode GetInt64 expect ErrNotFound, got", err)
+	}
+	rc.Set("zero", 0, 0)
+	if v, err := rc.GetInt("zero"); v != 0 || err != nil {
+		t.Error("TestRuntimeCache_StrictMode GetInt expect 0, nil, got", v, err)
+	}
+	rc.Set("text", "abc", 0)
+	if _, err := rc.GetInt("text"); err != ErrTypeMismatch {
+		t.Error("TestRuntimeCache_StrictMode GetInt expect ErrTypeMismatch, got", err)
+	}
+	rc.Set("empty", "", 0)
+	if _, err := rc.GetInt64("empty"); err != ErrTypeMismatch {
+		t.Error("TestRuntimeCache_StrictMode GetInt64 expect ErrTypeMismatch, got", err)
+	}
+}
+
+func TestRuntimeCache_Ctx(t *testing.T) {
+	rc := NewRuntimeCache()
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := rc.SetCtx(ctx, "1", 1, 0); err != nil {
+		t.Error("TestRuntimeCache_Ctx SetCtx expect nil error, got", err)
+	}
+	if v, err := rc.GetIntCtx(ctx, "1"); v != 1 || err != nil {
+		t.Error("TestRuntimeCache_Ctx GetIntCtx expect 1, got", v, err)
+	}
+	cancel()
+	if _, err := rc.GetCtx(ctx, "1"); err != context.Canceled {
+		t.Error("TestRuntimeCache_Ctx GetCtx expect context.Canceled, got", err)
+	}
+}
+
+func TestRuntimeCache_MGetMSet(t *testing.T) {
+	rc := NewRuntimeCache()
+	if err := rc.MSet(map[string]interface{}{"1": 1, "2": "2", "3": 3}, 0); err != nil {
+		t.Error("TestRuntimeCache_MGetMSet MSet expect nil error, got", err)
+	}
+	items, err := rc.MGet("1", "2", "none")
+	if err != nil || len(items) != 2 || items["1"] != 1 || items["2"] != "2" {
+		t.Error("TestRuntimeCache_MGetMSet MGet expect 1 and 2, got", items, err)
+	}
+	if _, ok := items["none"]; ok {
+		t.Error("TestRuntimeCache_MGetMSet key none should be missing")
+	}
+	if stats := rc.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Error("TestRuntimeCache_MGetMSet expect 2 hits 1 miss, got", stats)
+	}
+	rc.MDelete("1", "3", "none")
+	if items, _ := rc.MGet("1", "2", "3"); len(items) != 1 {
+		t.Error("TestRuntimeCache_MGetMSet expect only key 2 after MDelete, got", items)
+	}
+
+	rc = NewRuntimeCache(WithMaxCost(5))
+	if err := rc.MSet(map[string]interface{}{"1": "1", "2": "123456"}, 0); err != ErrCostTooLarge {
+		t.Error("TestRuntimeCache_MGetMSet expect ErrCostTooLarge, got", err)
+	}
+	if exists, _ := rc.Exists("1"); exists {
+		t.Error("TestRuntimeCache_MGetMSet key 1 should not be set")
+	}
+}
+
+func TestShardedRuntimeCache_MGetMSet(t *testing.T) {
+	rc := NewShardedRuntimeCache(4)
+	items := make(map[string]interface{})
+	keys := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		items[strconv.Itoa(i)] = i
+		keys = append(keys, strconv.Itoa(i))
+	}
+	rc.MSet(items, 0)
+	if got, err := rc.MGet(append(keys, "none")...); err != nil || len(got) != 100 || got["99"] != 99 {
+		t.Error("TestShardedRuntimeCache_MGetMSet expect 100 items, got", len(got), err)
+	}
+	rc.MDelete(keys[:50]...)
+	if got, _ := rc.MGet(keys...); len(got) != 50 {
+		t.Error("TestShardedRuntimeCache_MGetMSet expect 50 items after MDelete, got", len(got))
+	}
+}
+
+func TestRuntimeCache_GetOrLoad(t *testing.T) {
+	rc := NewRuntimeCache()
+	var calls int32
+	var mu sync.Mutex
+	loader := func() (interface{}, error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		return "value", nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := rc.GetOrLoad("key", 0, loader); err != nil || v != "value" {
+				t.Error("TestRuntimeCache_GetOrLoad expect value, got", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Error("TestRuntimeCache_GetOrLoad expect 1 loader call, got", calls)
+	}
+	if stats := rc.Stats(); stats.Misses > 50 {
+		t.Error("TestRuntimeCache_GetOrLoad load should not count misses, got", stats.Misses)
+	}
+
+	// errors and nil values are not set
+	if _, err := rc.GetOrLoad("error", 0, func() (interface{}, error) { return nil, strconv.ErrSyntax }); err != strconv.ErrSyntax {
+		t.Error("TestRuntimeCache_GetOrLoad expect loader error, got", err)
+	}
+	rc.GetOrLoad("nil", 0, func() (interface{}, error) { return nil, nil })
+	if exists, _ := rc.Exists("nil"); exists {
+		t.Error("TestRuntimeCache_GetOrLoad nil value should not be set")
+	}
+
+	strict := NewShardedRuntimeCache(4, WithStrictMode())
+	if v, err := strict.GetOrLoad("key", 0, loader); err != nil || v != "value" {
+		t.Error("TestRuntimeCache_GetOrLoad strict expect value, got", v, err)
+	}
+}
+
+func TestRuntimeCache_SetWithSoftTTL(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	rc := NewRuntimeCache(WithLoader(func(key string) (interface{}, error) {
+		calls++
+		<-release
+		return key + "-fresh", nil
+	}))
+	rc.SetWithSoftTTL("key", "stale", 10, 60)
+	if v, _ := rc.Get("key"); v != "stale" {
+		t.Error("TestRuntimeCache_SetWithSoftTTL expect stale before soft ttl, got", v)
+	}
+
+	// make the item older than its soft ttl
+	rc.Lock()
+	rc.items["key"].createTime = time.Now().Add(-20 * time.Second)
+	rc.Unlock()
+	for i := 0; i < 10; i++ {
+		if v, _ := rc.Get("key"); v != "stale" {
+			t.Error("TestRuntimeCache_SetWithSoftTTL expect stale value during refresh, got", v)
+		}
+	}
+	close(release)
+	deadline := time.Now().Add(time.Second)
+	for v, _ := rc.Get("key"); v != "key-fresh" && time.Now().Before(deadline); v, _ = rc.Get("key") {
+		time.Sleep(time.Millisecond)
+	}
+	if v, _ := rc.Get("key"); v != "key-fresh" || calls != 1 {
+		t.Error("TestRuntimeCache_SetWithSoftTTL expect 1 refresh, got", v, calls)
+	}
+	rc.RLock()
+	item := rc.items["key"]
+	rc.RUnlock()
+	if item.softTTL != 10*time.Second || item.ttl != 60*time.Second {
+		t.Error("TestRuntimeCache_SetWithSoftTTL refreshed item expect same ttls, got", item.softTTL, item.ttl)
+	}
+
+	// a soft ttl not less than ttl is ignored
+	rc.SetWithSoftTTL("ignored", 1, 60, 60)
+	if rc.items["ignored"].softTTL != 0 {
+		t.Error("TestRuntimeCache_SetWithSoftTTL soft ttl not less than ttl should be ignored")
+	}
+}
+
+func TestRuntimeCache_RefreshPanic(t *testing.T) {
+	panicked := make(chan struct{})
+	rc := NewRuntimeCache(WithLoader(func(key string) (interface{}, error) {
+		defer close(panicked)
+		panic("boom")
+	}))
+	rc.SetWithSoftTTL("key", "stale", 10, 60)
+	rc.Lock()
+	rc.items["key"].createTime = time.Now().Add(-20 * time.Second)
+	rc.Unlock()
+	rc.Get("key")
+	<-panicked
+	time.Sleep(10 * time.Millisecond)
+	if v, _ := rc.Get("key"); v != "stale" {
+		t.Error("TestRuntimeCache_RefreshPanic expect stale value after a panic of loader, got", v)
+	}
+}
+
+func TestRuntimeCache_GetOrLoadDuringRefresh(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	rc := NewRuntimeCache(WithLoader(func(key string) (interface{}, error) {
+		<-release
+		return "refreshed", nil
+	}))
+	rc.SetWithSoftTTL("key", "stale", 10, 60)
+	rc.Lock()
+	rc.items["key"].createTime = time.Now().Add(-20 * time.Second)
+	rc.Unlock()
+	rc.Get("key")
+	rc.Delete("key")
+
+	// the miss is loaded by its own loader, not by the running refresh which does not set its value
+	v, err := rc.GetOrLoad("key", 0, func() (interface{}, error) { return "loaded", nil })
+	if err != nil || v != "loaded" {
+		t.Error("TestRuntimeCache_GetOrLoadDuringRefresh expect loaded, got", v, err)
+	}
+	if v, _ := rc.Get("key"); v != "loaded" {
+		t.Error("TestRuntimeCache_GetOrLoadDuringRefresh expect loaded value set, got", v)
+	}
+}
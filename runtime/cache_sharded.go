@@ -0,0 +1,241 @@
+package runtime
+
+const (
+	// DefaultShardCount is used by NewShardedRuntimeCache when shards <= 0
+	DefaultShardCount = 32
+)
+
+// ShardedRuntimeCache is a runtime cache split into independently locked RuntimeCache shards.
+// keys are spread by hash, so concurrent operations on different keys rarely wait on the same locker.
+type ShardedRuntimeCache struct {
+	shards []*RuntimeCache
+	mask   uint32
+}
+
+// NewShardedRuntimeCache returns a new *ShardedRuntimeCache.
+// shards is rounded up to a power of two, if shards <= 0, use DefaultShardCount.
+// WithMaxEntries and WithMaxCost limits are shared evenly between shards.
+func NewShardedRuntimeCache(shards int, opts ...Option) *ShardedRuntimeCache {
+	if shards <= 0 {
+		shards = DefaultShardCount
+	}
+	shards = nextPowerOfTwo(shards)
+	o := newOptions(opts...)
+	if o.maxEntries > 0 {
+		o.maxEntries = (o.maxEntries + shards - 1) / shards
+	}
+	if o.maxCost > 0 {
+		o.maxCost = (o.maxCost + int64(shards) - 1) / int64(shards)
+	}
+	cache := &ShardedRuntimeCache{shards: make([]*RuntimeCache, shards), mask: uint32(shards - 1)}
+	for i := range cache.shards {
+		cache.shards[i] = newRuntimeCache(o)
+	}
+	return cache
+}
+
+// Get cache from runtime cache.
+// if non-existed or expired, return nil, or ErrNotFound in strict mode.
+func (ca *ShardedRuntimeCache) Get(key string) (interface{}, error) {
+	return ca.shard(key).Get(key)
+}
+
+// GetString returns value string format by given key
+// if non-existed or expired, return "", or ErrNotFound in strict mode.
+func (ca *ShardedRuntimeCache) GetString(key string) (string, error) {
+	return ca.shard(key).GetString(key)
+}
+
+// GetInt returns value int format by given key
+// if non-existed or expired, return 0, or ErrNotFound in strict mode.
+func (ca *ShardedRuntimeCache) GetInt(key string) (int, error) {
+	return ca.shard(key).GetInt(key)
+}
+
+// GetInt64 returns value int64 format by given key
+// if non-existed or expired, return 0, or ErrNotFound in strict mode.
+func (ca *ShardedRuntimeCache) GetInt64(key string) (int64, error) {
+	return ca.shard(key).GetInt64(key)
+}
+
+// Set cache to runtime.
+// ttl is second, if ttl is 0, it will be forever till restart.
+func (ca *ShardedRuntimeCache) Set(key string, value interface{}, ttl int64) error {
+	return ca.shard(key).Set(key, value, ttl)
+}
+
+// SetWithCost set cache to runtime with an explicit cost, usually in bytes.
+func (ca *ShardedRuntimeCache) SetWithCost(key string, value interface{}, ttl int64, cost int64) error {
+	return ca.shard(key).SetWithCost(key, value, ttl, cost)
+}
+
+// SetWithSoftTTL set cache to runtime with a soft ttl, softTTL and ttl are second.
+// after softTTL, Get returns the stale value and the loader of WithLoader refreshes it in the background.
+func (ca *ShardedRuntimeCache) SetWithSoftTTL(key string, value interface{}, softTTL int64, ttl int64) error {
+	return ca.shard(key).SetWithSoftTTL(key, value, softTTL, ttl)
+}
+
+// Incr increase int64 counter in runtime cache.
+func (ca *ShardedRuntimeCache) Incr(key string) (int64, error) {
+	return ca.shard(key).Incr(key)
+}
+
+// Decr decrease counter in runtime cache.
+func (ca *ShardedRuntimeCache) Decr(key string) (int64, error) {
+	return ca.shard(key).Decr(key)
+}
+
+// IncrBy increase counter in runtime cache by delta, atomically.
+func (ca *ShardedRuntimeCache) IncrBy(key string, delta int64) (int64, error) {
+	return ca.shard(key).IncrBy(key, delta)
+}
+
+// DecrBy decrease counter in runtime cache by delta, atomically.
+func (ca *ShardedRuntimeCache) DecrBy(key string, delta int64) (int64, error) {
+	return ca.shard(key).DecrBy(key, delta)
+}
+
+// IncrByFloat increase float counter in runtime cache by delta, atomically.
+func (ca *ShardedRuntimeCache) IncrByFloat(key string, delta float64) (float64, error) {
+	return ca.shard(key).IncrByFloat(key, delta)
+}
+
+// Exists check item exist in runtime cache.
+func (ca *ShardedRuntimeCache) Exists(key string) (bool, error) {
+	return ca.shard(key).Exists(key)
+}
+
+// Delete item in runtime cache.
+// if not exists, we think it's success
+func (ca *ShardedRuntimeCache) Delete(key string) error {
+	return ca.shard(key).Delete(key)
+}
+
+// MGet returns values of keys, locking each shard once,
+// keys which non-existed or expired are not in the returned map.
+func (ca *ShardedRuntimeCache) MGet(keys ...string) (map[string]interface{}, error) {
+	items := make(map[string]interface{}, len(keys))
+	for shard, shardKeys := range ca.groupKeys(keys) {
+		values, err := shard.MGet(shardKeys...)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			items[key] = value
+		}
+	}
+	return items, nil
+}
+
+// MSet set all items, locking each shard once.
+// ttl is second, if ttl is 0, it will be forever till restart.
+func (ca *ShardedRuntimeCache) MSet(items map[string]interface{}, ttl int64) error {
+	groups := make(map[*RuntimeCache]map[string]interface{})
+	for key, value := range items {
+		shard := ca.shard(key)
+		if groups[shard] == nil {
+			groups[shard] = make(map[string]interface{})
+		}
+		groups[shard][key] = value
+	}
+	for shard, shardItems := range groups {
+		if err := shard.MSet(shardItems, ttl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MDelete delete items by given keys, locking each shard once.
+// if not exists, we think it's success
+func (ca *ShardedRuntimeCache) MDelete(keys ...string) error {
+	for shard, shardKeys := range ca.groupKeys(keys) {
+		if err := shard.MDelete(shardKeys...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetOrLoad returns value by given key, on a miss it calls loader and sets its value with ttl,
+// concurrent misses of the same key wait for one loader call.
+func (ca *ShardedRuntimeCache) GetOrLoad(key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	return ca.shard(key).GetOrLoad(key, ttl, loader)
+}
+
+// Expire Set a timeout on key. After the timeout has expired, the key will automatically be deleted.
+// timeout time duration is second
+// if not exists key, return 0, nil
+func (ca *ShardedRuntimeCache) Expire(key string, timeOutSeconds int) (int, error) {
+	return ca.shard(key).Expire(key, timeOutSeconds)
+}
+
+// ClearAll will delete all item in all shards.
+func (ca *ShardedRuntimeCache) ClearAll() error {
+	for _, shard := range ca.shards {
+		if err := shard.ClearAll(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the gc goroutine of all shards and deletes all items.
+func (ca *ShardedRuntimeCache) Close() error {
+	for _, shard := range ca.shards {
+		shard.Close()
+	}
+	return nil
+}
+
+// Cost returns the total cost of items in all shards.
+func (ca *ShardedRuntimeCache) Cost() int64 {
+	var cost int64
+	for _, shard := range ca.shards {
+		cost += shard.Cost()
+	}
+	return cost
+}
+
+// Stats returns the sum of counters of all shards.
+func (ca *ShardedRuntimeCache) Stats() Stats {
+	var stats Stats
+	for _, shard := range ca.shards {
+		s := shard.Stats()
+		stats.Hits += s.Hits
+		stats.Misses += s.Misses
+		stats.Evictions += s.Evictions
+	}
+	return stats
+}
+
+// ResetStats sets counters of all shards to zero.
+func (ca *ShardedRuntimeCache) ResetStats() {
+	for _, shard := range ca.shards {
+		shard.ResetStats()
+	}
+}
+
+// groupKeys groups keys by the RuntimeCache holding them.
+func (ca *ShardedRuntimeCache) groupKeys(keys []string) map[*RuntimeCache][]string {
+	groups := make(map[*RuntimeCache][]string)
+	for _, key := range keys {
+		shard := ca.shard(key)
+		groups[shard] = append(groups[shard], key)
+	}
+	return groups
+}
+
+// shard returns the RuntimeCache holding key, hashed with inlined fnv-1a to avoid allocation.
+func (ca *ShardedRuntimeCache) shard(key string) *RuntimeCache {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	h := uint32(offset32)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= prime32
+	}
+	return ca.shards[h&ca.mask]
+}
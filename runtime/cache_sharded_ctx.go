@@ -0,0 +1,108 @@
+package runtime
+
+import "context"
+
+// ExistsCtx is Exists, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) ExistsCtx(ctx context.Context, key string) (bool, error) {
+	return ca.shard(key).ExistsCtx(ctx, key)
+}
+
+// GetCtx is Get, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) GetCtx(ctx context.Context, key string) (interface{}, error) {
+	return ca.shard(key).GetCtx(ctx, key)
+}
+
+// GetStringCtx is GetString, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) GetStringCtx(ctx context.Context, key string) (string, error) {
+	return ca.shard(key).GetStringCtx(ctx, key)
+}
+
+// GetIntCtx is GetInt, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) GetIntCtx(ctx context.Context, key string) (int, error) {
+	return ca.shard(key).GetIntCtx(ctx, key)
+}
+
+// GetInt64Ctx is GetInt64, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) GetInt64Ctx(ctx context.Context, key string) (int64, error) {
+	return ca.shard(key).GetInt64Ctx(ctx, key)
+}
+
+// SetCtx is Set, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) SetCtx(ctx context.Context, key string, v interface{}, ttl int64) error {
+	return ca.shard(key).SetCtx(ctx, key, v, ttl)
+}
+
+// IncrCtx is Incr, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) IncrCtx(ctx context.Context, key string) (int64, error) {
+	return ca.shard(key).IncrCtx(ctx, key)
+}
+
+// DecrCtx is Decr, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) DecrCtx(ctx context.Context, key string) (int64, error) {
+	return ca.shard(key).DecrCtx(ctx, key)
+}
+
+// IncrByCtx is IncrBy, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) IncrByCtx(ctx context.Context, key string, delta int64) (int64, error) {
+	return ca.shard(key).IncrByCtx(ctx, key, delta)
+}
+
+// DecrByCtx is DecrBy, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) DecrByCtx(ctx context.Context, key string, delta int64) (int64, error) {
+	return ca.shard(key).DecrByCtx(ctx, key, delta)
+}
+
+// IncrByFloatCtx is IncrByFloat, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) IncrByFloatCtx(ctx context.Context, key string, delta float64) (float64, error) {
+	return ca.shard(key).IncrByFloatCtx(ctx, key, delta)
+}
+
+// DeleteCtx is Delete, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) DeleteCtx(ctx context.Context, key string) error {
+	return ca.shard(key).DeleteCtx(ctx, key)
+}
+
+// ClearAllCtx will delete all item in all shards, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) ClearAllCtx(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ca.ClearAll()
+}
+
+// ExpireCtx is Expire, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) ExpireCtx(ctx context.Context, key string, timeOutSeconds int) (int, error) {
+	return ca.shard(key).ExpireCtx(ctx, key, timeOutSeconds)
+}
+
+// MGetCtx is MGet, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) MGetCtx(ctx context.Context, keys ...string) (map[string]interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ca.MGet(keys...)
+}
+
+// MSetCtx is MSet, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) MSetCtx(ctx context.Context, items map[string]interface{}, ttl int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ca.MSet(items, ttl)
+}
+
+// MDeleteCtx is MDelete, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) MDeleteCtx(ctx context.Context, keys ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ca.MDelete(keys...)
+}
+
+// GetOrLoadCtx is GetOrLoad, it returns ctx.Err() if ctx is done.
+func (ca *ShardedRuntimeCache) GetOrLoadCtx(ctx context.Context, key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return ca.GetOrLoad(key, ttl, loader)
+}
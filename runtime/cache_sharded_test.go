@@ -0,0 +1,116 @@
+package runtime
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShardedRuntimeCache_SetGet(t *testing.T) {
+	rc := NewShardedRuntimeCache(6)
+	if len(rc.shards) != 8 {
+		t.Error("TestShardedRuntimeCache_SetGet expect 8 shards, got", len(rc.shards))
+	}
+	for i := 0; i < 100; i++ {
+		rc.Set(strconv.Itoa(i), i, 0)
+	}
+	for i := 0; i < 100; i++ {
+		if v, _ := rc.GetInt(strconv.Itoa(i)); v != i {
+			t.Error("TestShardedRuntimeCache_SetGet expect", i, "got", v)
+		}
+	}
+	rc.Delete("1")
+	if exists, _ := rc.Exists("1"); exists {
+		t.Error("TestShardedRuntimeCache_SetGet key 1 should be deleted")
+	}
+	rc.ClearAll()
+	if exists, _ := rc.Exists("2"); exists {
+		t.Error("TestShardedRuntimeCache_SetGet key 2 should be cleared")
+	}
+}
+
+func TestShardedRuntimeCache_MaxEntries(t *testing.T) {
+	rc := NewShardedRuntimeCache(4, WithMaxEntries(100))
+	for i := 0; i < 1000; i++ {
+		rc.Set(strconv.Itoa(i), i, 0)
+	}
+	count := 0
+	for _, shard := range rc.shards {
+		count += len(shard.items)
+	}
+	if count > 100 {
+		t.Error("TestShardedRuntimeCache_MaxEntries expect at most 100 items, got", count)
+	}
+}
+
+const benchKeyCount = 1 << 16
+
+var benchKeys = func() []string {
+	keys := make([]string, benchKeyCount)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+	}
+	return keys
+}()
+
+type benchCache interface {
+	Get(key string) (interface{}, error)
+	Set(key string, value interface{}, ttl int64) error
+}
+
+func fillBenchCache(c benchCache) {
+	for i, key := range benchKeys {
+		c.Set(key, i, 0)
+	}
+}
+
+// benchParallel runs parallel operations, writePercent of them being Set
+func benchParallel(b *testing.B, c benchCache, writePercent int) {
+	fillBenchCache(c)
+	var seed uint32
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := int(atomic.AddUint32(&seed, 7919))
+		for pb.Next() {
+			key := benchKeys[i&(benchKeyCount-1)]
+			if i%100 < writePercent {
+				c.Set(key, i, 0)
+			} else {
+				c.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkRuntimeCache_ParallelGet(b *testing.B) {
+	benchParallel(b, NewRuntimeCache(), 0)
+}
+
+func BenchmarkShardedRuntimeCache_ParallelGet(b *testing.B) {
+	benchParallel(b, NewShardedRuntimeCache(DefaultShardCount), 0)
+}
+
+func BenchmarkRuntimeCache_ParallelSet(b *testing.B) {
+	benchParallel(b, NewRuntimeCache(), 100)
+}
+
+func BenchmarkShardedRuntimeCache_ParallelSet(b *testing.B) {
+	benchParallel(b, NewShardedRuntimeCache(DefaultShardCount), 100)
+}
+
+func BenchmarkRuntimeCache_ParallelMixed(b *testing.B) {
+	benchParallel(b, NewRuntimeCache(), 25)
+}
+
+func BenchmarkShardedRuntimeCache_ParallelMixed(b *testing.B) {
+	benchParallel(b, NewShardedRuntimeCache(DefaultShardCount), 25)
+}
+
+func BenchmarkRuntimeCache_ParallelGet_LRU(b *testing.B) {
+	benchParallel(b, NewRuntimeCache(WithMaxEntries(benchKeyCount)), 0)
+}
+
+func BenchmarkShardedRuntimeCache_ParallelGet_LRU(b *testing.B) {
+	benchParallel(b, NewShardedRuntimeCache(DefaultShardCount, WithMaxEntries(benchKeyCount*2)), 0)
+}
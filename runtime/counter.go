@@ -0,0 +1,117 @@
+package runtime
+
+import (
+	"math"
+	"strconv"
+)
+
+const (
+	maxIntValue = int64(^uint(0) >> 1)
+	minIntValue = -maxIntValue - 1
+)
+
+// incrValue adds delta to a counter value and keeps its type.
+// it returns the new value to store and the result as int64.
+func incrValue(value interface{}, delta int64) (interface{}, int64, error) {
+	switch v := value.(type) {
+	case int:
+		r, err := addSigned(int64(v), delta, minIntValue, maxIntValue)
+		return int(r), r, err
+	case int32:
+		r, err := addSigned(int64(v), delta, math.MinInt32, math.MaxInt32)
+		return int32(r), r, err
+	case int64:
+		r, err := addSigned(v, delta, math.MinInt64, math.MaxInt64)
+		return r, r, err
+	case uint:
+		r, err := addUnsigned(uint64(v), delta, uint64(^uint(0)))
+		return uint(r), int64(r), err
+	case uint32:
+		r, err := addUnsigned(uint64(v), delta, math.MaxUint32)
+		return uint32(r), int64(r), err
+	case uint64:
+		r, err := addUnsigned(v, delta, math.MaxUint64)
+		return r, int64(r), err
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, 0, ErrTypeMismatch
+		}
+		r, err := addSigned(i, delta, math.MinInt64, math.MaxInt64)
+		return strconv.FormatInt(r, 10), r, err
+	default:
+		return nil, 0, ErrTypeMismatch
+	}
+}
+
+// addSigned returns v + delta, or ErrOverflow if it is out of [min, max].
+func addSigned(v, delta, min, max int64) (int64, error) {
+	if (delta > 0 && v > max-delta) || (delta < 0 && v < min-delta) {
+		return 0, ErrOverflow
+	}
+	return v + delta, nil
+}
+
+// addUnsigned returns v + delta, or ErrOverflow if it is below 0, above max,
+// or above math.MaxInt64 which is the largest result a counter can return.
+func addUnsigned(v uint64, delta int64, max uint64) (uint64, error) {
+	if max > math.MaxInt64 {
+		max = math.MaxInt64
+	}
+	if delta < 0 {
+		d := uint64(-(delta + 1)) + 1
+		if d > v {
+			return 0, ErrOverflow
+		}
+		return v - d, nil
+	}
+	if v > max || uint64(delta) > max-v {
+		return 0, ErrOverflow
+	}
+	return v + uint64(delta), nil
+}
+
+// incrFloatValue adds delta to a float counter value.
+// it returns the new value to store and the result as float64.
+func incrFloatValue(value interface{}, delta float64) (interface{}, float64, error) {
+	var v float64
+	switch n := value.(type) {
+	case float64:
+		v = n
+	case float32:
+		r := float64(n) + delta
+		if math.IsNaN(r) || math.IsInf(r, 0) || math.Abs(r) > math.MaxFloat32 {
+			return nil, 0, ErrOverflow
+		}
+		return float32(r), r, nil
+	case int:
+		v = float64(n)
+	case int32:
+		v = float64(n)
+	case int64:
+		v = float64(n)
+	case uint:
+		v = float64(n)
+	case uint32:
+		v = float64(n)
+	case uint64:
+		v = float64(n)
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return nil, 0, ErrTypeMismatch
+		}
+		r := f + delta
+		if math.IsNaN(r) || math.IsInf(r, 0) {
+			return nil, 0, ErrOverflow
+		}
+		return strconv.FormatFloat(r, 'f', -1, 64), r, nil
+	default:
+		return nil, 0, ErrTypeMismatch
+	}
+	r := v + delta
+	if math.IsNaN(r) || math.IsInf(r, 0) {
+		return nil, 0, ErrOverflow
+	}
+	return r, r, nil
+}
@@ -0,0 +1,111 @@
+package runtime
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expireHeap is a min-heap of items with a ttl, ordered by deadline,
+// so the gc only visits the items which are really expired.
+type expireHeap []*RuntimeItem
+
+func (h expireHeap) Len() int { return len(h) }
+
+func (h expireHeap) Less(i, j int) bool { return h[i].deadline().Before(h[j].deadline()) }
+
+func (h expireHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expireHeap) Push(x interface{}) {
+	item := x.(*RuntimeItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expireHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	item.index = -1
+	*h = old[:n-1]
+	return item
+}
+
+// deadline returns the time after which the item is expired.
+func (mi *RuntimeItem) deadline() time.Time {
+	return mi.createTime.Add(mi.ttl)
+}
+
+// trackExpire adds, moves or removes item in the expire heap after its ttl changed.
+// the caller must hold the write lock.
+func (ca *RuntimeCache) trackExpire(item *RuntimeItem) {
+	if item.ttl == 0 {
+		ca.untrackExpire(item)
+		return
+	}
+	if item.index >= 0 {
+		heap.Fix(&ca.expires, item.index)
+	} else {
+		heap.Push(&ca.expires, item)
+	}
+	if item.index == 0 {
+		// new earliest deadline, the gc may be sleeping too long
+		select {
+		case ca.wakeup <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// untrackExpire removes item from the expire heap, the caller must hold the write lock.
+func (ca *RuntimeCache) untrackExpire(item *RuntimeItem) {
+	if item.index >= 0 {
+		heap.Remove(&ca.expires, item.index)
+	}
+}
+
+// deleteExpired removes all expired items,
+// and returns the time to wait before the next deadline, at most gcInterval.
+func (ca *RuntimeCache) deleteExpired() time.Duration {
+	ca.Lock()
+	defer ca.Unlock()
+	now := time.Now()
+	for len(ca.expires) > 0 {
+		item := ca.expires[0]
+		if wait := item.deadline().Sub(now); wait > 0 {
+			if wait > ca.gcInterval {
+				return ca.gcInterval
+			}
+			return wait
+		}
+		ca.removeItem(item.key)
+	}
+	return ca.gcInterval
+}
+
+// gc deletes expired items close to their deadline,
+// it sleeps until the earliest deadline and is woken up when an earlier one is set.
+// it returns when the cache is closed.
+func (ca *RuntimeCache) gc() {
+	timer := time.NewTimer(ca.gcInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ca.done:
+			return
+		case <-timer.C:
+		case <-ca.wakeup:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+		timer.Reset(ca.deleteExpired())
+	}
+}
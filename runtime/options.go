@@ -0,0 +1,95 @@
+package runtime
+
+import "time"
+
+// Option configures a RuntimeCache created by NewRuntimeCache.
+type Option func(*options)
+
+type options struct {
+	gcInterval time.Duration
+	maxEntries int
+	maxCost    int64
+	sizer      Sizer
+	policy     PolicyFactory
+	strict     bool
+	loader     func(key string) (interface{}, error)
+}
+
+// WithGCInterval sets the longest time the gc sleeps between two checks, DefaultGCInterval by default.
+// expired items are deleted close to their deadline whatever the interval is,
+// it only bounds the delay when clock jumps or ttl are changed from outside.
+func WithGCInterval(interval time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.gcInterval = interval
+		}
+	}
+}
+
+// WithMaxEntries limits the number of items stored in the cache.
+// when the limit is reached, an item is evicted by the eviction policy, LRU by default.
+// 0 means no limit.
+func WithMaxEntries(maxEntries int) Option {
+	return func(o *options) {
+		if maxEntries > 0 {
+			o.maxEntries = maxEntries
+		}
+	}
+}
+
+// WithMaxCost limits the total cost of items stored in the cache, usually in bytes.
+// when the limit is exceeded, items are evicted by the eviction policy,
+// an item whose cost alone exceeds the limit is rejected with ErrCostTooLarge.
+// 0 means no limit.
+func WithMaxCost(maxCost int64) Option {
+	return func(o *options) {
+		if maxCost > 0 {
+			o.maxCost = maxCost
+		}
+	}
+}
+
+// WithSizer sets the Sizer used by Set to compute item cost, DefaultSizer by default.
+func WithSizer(sizer Sizer) Option {
+	return func(o *options) {
+		if sizer != nil {
+			o.sizer = sizer
+		}
+	}
+}
+
+// WithEvictionPolicy sets the policy used when the cache is bounded by WithMaxEntries or WithMaxCost,
+// like PolicyLRU, PolicyLFU, PolicyARC, PolicyTinyLFU or a custom PolicyFactory.
+func WithEvictionPolicy(policy PolicyFactory) Option {
+	return func(o *options) {
+		if policy != nil {
+			o.policy = policy
+		}
+	}
+}
+
+// WithStrictMode makes getters return ErrNotFound on a miss,
+// and GetInt, GetInt64 return ErrTypeMismatch when the value is not an integer.
+// without it, getters return a zero value and a nil error in both cases.
+func WithStrictMode() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// WithLoader sets the loader which refreshes items set by SetWithSoftTTL,
+// Get and MGet return the stale value of an item older than its soft ttl and call loader in the background,
+// at most one refresh of a key runs at a time. without it, stale values are returned until the ttl.
+func WithLoader(loader func(key string) (interface{}, error)) Option {
+	return func(o *options) {
+		o.loader = loader
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{gcInterval: DefaultGCInterval, policy: PolicyLRU, sizer: DefaultSizer}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
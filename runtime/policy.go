@@ -0,0 +1,32 @@
+package runtime
+
+// EvictionPolicy decides which keys leave a RuntimeCache bounded by WithMaxEntries.
+// implementations need not be safe for concurrent use, RuntimeCache guards every call with its own locker.
+type EvictionPolicy interface {
+	// Add records a newly stored key and returns the keys which must be evicted.
+	// the returned keys may contain key itself if the policy refuses to admit it.
+	// adding a key which is already tracked counts as an access.
+	Add(key string) []string
+	// Access records a cache hit on key.
+	Access(key string)
+	// Remove forgets key, it is called when an item is deleted or expired.
+	Remove(key string)
+	// Evict removes and returns the next key to evict regardless of capacity,
+	// it is used when the cache is bounded by WithMaxCost.
+	// ok is false if the policy holds no key.
+	Evict() (key string, ok bool)
+	// Clear forgets all keys.
+	Clear()
+}
+
+// PolicyFactory creates an EvictionPolicy which holds at most capacity keys,
+// 0 means the number of keys is not limited.
+type PolicyFactory func(capacity int) EvictionPolicy
+
+// built-in eviction policies, use with WithEvictionPolicy
+var (
+	PolicyLRU     PolicyFactory = NewLRUPolicy
+	PolicyLFU     PolicyFactory = NewLFUPolicy
+	PolicyARC     PolicyFactory = NewARCPolicy
+	PolicyTinyLFU PolicyFactory = NewTinyLFUPolicy
+)
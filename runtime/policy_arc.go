@@ -0,0 +1,199 @@
+package runtime
+
+import "container/list"
+
+// arc list ids
+const (
+	arcT1 = iota // resident keys seen once recently
+	arcT2        // resident keys seen at least twice recently
+	arcB1        // ghost keys recently evicted from t1
+	arcB2        // ghost keys recently evicted from t2
+)
+
+type arcEntry struct {
+	key   string
+	where int
+}
+
+// arcPolicy implements Adaptive Replacement Cache,
+// it balances between recency (t1) and frequency (t2) using the ghost lists b1 and b2,
+// so a scan of one-time keys can not flush the frequently used ones.
+type arcPolicy struct {
+	capacity int
+	// p is the target size of t1
+	p       int
+	lists   [4]*list.List
+	entries map[string]*list.Element
+}
+
+// NewARCPolicy returns an EvictionPolicy implementing Adaptive Replacement Cache.
+func NewARCPolicy(capacity int) EvictionPolicy {
+	a := &arcPolicy{capacity: capacity, entries: make(map[string]*list.Element)}
+	for i := range a.lists {
+		a.lists[i] = list.New()
+	}
+	return a
+}
+
+// Add records key in t1, or in t2 if it is a ghost hit,
+// and returns the resident keys which must be evicted to respect capacity.
+func (a *arcPolicy) Add(key string) []string {
+	var evicted []string
+	t1, t2, b1, b2 := a.lists[arcT1], a.lists[arcT2], a.lists[arcB1], a.lists[arcB2]
+	if e, ok := a.entries[key]; ok {
+		switch e.Value.(*arcEntry).where {
+		case arcT1, arcT2:
+			a.Access(key)
+			return nil
+		case arcB1:
+			a.p = minInt(a.size(), a.p+maxInt(b2.Len()/b1.Len(), 1))
+			evicted = a.replace(false)
+			a.move(e, arcT2)
+			return evicted
+		case arcB2:
+			a.p = maxInt(0, a.p-maxInt(b1.Len()/b2.Len(), 1))
+			evicted = a.replace(true)
+			a.move(e, arcT2)
+			return evicted
+		}
+	}
+
+	if a.capacity > 0 {
+		if t1.Len()+b1.Len() >= a.capacity {
+			if t1.Len() < a.capacity {
+				a.drop(b1.Back())
+				evicted = a.replace(false)
+			} else {
+				evicted = append(evicted, a.drop(t1.Back()))
+			}
+		} else if total := t1.Len() + t2.Len() + b1.Len() + b2.Len(); total >= a.capacity {
+			if total >= 2*a.capacity && b2.Len() > 0 {
+				a.drop(b2.Back())
+			}
+			evicted = a.replace(false)
+		}
+	}
+	a.entries[key] = t1.PushFront(&arcEntry{key: key, where: arcT1})
+	a.trimGhosts()
+	return evicted
+}
+
+// Access moves a resident key to the front of t2.
+func (a *arcPolicy) Access(key string) {
+	e, ok := a.entries[key]
+	if !ok {
+		return
+	}
+	if where := e.Value.(*arcEntry).where; where == arcT1 || where == arcT2 {
+		a.move(e, arcT2)
+	}
+}
+
+// Remove forgets key, including its ghost entry.
+func (a *arcPolicy) Remove(key string) {
+	if e, ok := a.entries[key]; ok {
+		a.drop(e)
+	}
+}
+
+// Evict moves a resident key to its ghost list and returns it,
+// t1 is preferred while it is larger than its target size p.
+func (a *arcPolicy) Evict() (string, bool) {
+	t1, t2 := a.lists[arcT1], a.lists[arcT2]
+	var e *list.Element
+	if t1.Len() > 0 && (t1.Len() > a.p || t2.Len() == 0) {
+		e = t1.Back()
+		a.move(e, arcB1)
+	} else if t2.Len() > 0 {
+		e = t2.Back()
+		a.move(e, arcB2)
+	} else {
+		return "", false
+	}
+	a.trimGhosts()
+	return e.Value.(*arcEntry).key, true
+}
+
+// Clear forgets all keys.
+func (a *arcPolicy) Clear() {
+	for _, l := range a.lists {
+		l.Init()
+	}
+	a.entries = make(map[string]*list.Element)
+	a.p = 0
+}
+
+// replace evicts one resident key into the matching ghost list when the cache is full.
+// inB2 reports whether the key being added was a b2 ghost hit.
+// without capacity, the cache is only bounded by cost and evicts by Evict, so nothing is replaced.
+func (a *arcPolicy) replace(inB2 bool) []string {
+	t1, t2 := a.lists[arcT1], a.lists[arcT2]
+	if a.capacity == 0 || t1.Len()+t2.Len() < a.capacity {
+		return nil
+	}
+	var e *list.Element
+	if t1.Len() > 0 && (t1.Len() > a.p || (inB2 && t1.Len() == a.p)) {
+		e = t1.Back()
+		a.move(e, arcB1)
+	} else if t2.Len() > 0 {
+		e = t2.Back()
+		a.move(e, arcB2)
+	} else {
+		return nil
+	}
+	return []string{e.Value.(*arcEntry).key}
+}
+
+// size returns the capacity, or the number of resident keys without capacity.
+func (a *arcPolicy) size() int {
+	if a.capacity > 0 {
+		return a.capacity
+	}
+	return a.lists[arcT1].Len() + a.lists[arcT2].Len()
+}
+
+// trimGhosts bounds the ghost lists by the number of resident keys without capacity,
+// with a capacity, Add keeps them within it.
+func (a *arcPolicy) trimGhosts() {
+	if a.capacity > 0 {
+		return
+	}
+	t1, t2, b1, b2 := a.lists[arcT1], a.lists[arcT2], a.lists[arcB1], a.lists[arcB2]
+	for b1.Len()+b2.Len() > t1.Len()+t2.Len() {
+		if b1.Len() >= b2.Len() {
+			a.drop(b1.Back())
+		} else {
+			a.drop(b2.Back())
+		}
+	}
+}
+
+// move puts e at the front of list where.
+func (a *arcPolicy) move(e *list.Element, where int) {
+	entry := e.Value.(*arcEntry)
+	a.lists[entry.where].Remove(e)
+	entry.where = where
+	a.entries[entry.key] = a.lists[where].PushFront(entry)
+}
+
+// drop removes e from the policy and returns its key.
+func (a *arcPolicy) drop(e *list.Element) string {
+	entry := e.Value.(*arcEntry)
+	a.lists[entry.where].Remove(e)
+	delete(a.entries, entry.key)
+	return entry.key
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
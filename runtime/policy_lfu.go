@@ -0,0 +1,117 @@
+package runtime
+
+import "container/list"
+
+// lfuEntry is a key tracked by lfuPolicy.
+type lfuEntry struct {
+	key    string
+	bucket *list.Element
+	elem   *list.Element
+}
+
+// lfuBucket holds the keys of one frequency, the most recently used first.
+type lfuBucket struct {
+	freq int
+	keys *list.List
+}
+
+// lfuPolicy evicts the least frequently used key,
+// ties are broken by evicting the least recently used one.
+// every operation is O(1), the buckets of used frequencies are kept in a list in ascending order,
+// an access moves a key to the next bucket, and the key to evict is the last one of the first bucket.
+type lfuPolicy struct {
+	capacity int
+	entries  map[string]*lfuEntry
+	buckets  *list.List
+}
+
+// NewLFUPolicy returns an EvictionPolicy which evicts the least frequently used key.
+func NewLFUPolicy(capacity int) EvictionPolicy {
+	return &lfuPolicy{
+		capacity: capacity,
+		entries:  make(map[string]*lfuEntry),
+		buckets:  list.New(),
+	}
+}
+
+// Add records key with a frequency of 1,
+// and returns the keys which must be evicted to respect capacity.
+func (l *lfuPolicy) Add(key string) []string {
+	if _, ok := l.entries[key]; ok {
+		l.Access(key)
+		return nil
+	}
+	var evicted []string
+	for l.capacity > 0 && len(l.entries) >= l.capacity {
+		evicted = append(evicted, l.evict())
+	}
+	front := l.buckets.Front()
+	if front == nil || front.Value.(*lfuBucket).freq != 1 {
+		front = l.buckets.PushFront(&lfuBucket{freq: 1, keys: list.New()})
+	}
+	entry := &lfuEntry{key: key}
+	l.push(entry, front)
+	l.entries[key] = entry
+	return evicted
+}
+
+// Access increases the frequency of key.
+func (l *lfuPolicy) Access(key string) {
+	entry, ok := l.entries[key]
+	if !ok {
+		return
+	}
+	current := entry.bucket
+	freq := current.Value.(*lfuBucket).freq + 1
+	next := current.Next()
+	if next == nil || next.Value.(*lfuBucket).freq != freq {
+		next = l.buckets.InsertAfter(&lfuBucket{freq: freq, keys: list.New()}, current)
+	}
+	l.unlink(entry)
+	l.push(entry, next)
+}
+
+// Remove forgets key.
+func (l *lfuPolicy) Remove(key string) {
+	if entry, ok := l.entries[key]; ok {
+		l.unlink(entry)
+		delete(l.entries, key)
+	}
+}
+
+// Evict removes and returns the least frequently used key.
+func (l *lfuPolicy) Evict() (string, bool) {
+	if len(l.entries) == 0 {
+		return "", false
+	}
+	return l.evict(), true
+}
+
+// Clear forgets all keys.
+func (l *lfuPolicy) Clear() {
+	l.entries = make(map[string]*lfuEntry)
+	l.buckets.Init()
+}
+
+// evict removes and returns the least frequently used key, there must be one.
+func (l *lfuPolicy) evict() string {
+	entry := l.buckets.Front().Value.(*lfuBucket).keys.Back().Value.(*lfuEntry)
+	l.unlink(entry)
+	delete(l.entries, entry.key)
+	return entry.key
+}
+
+// push adds entry to the front of the keys of bucket.
+func (l *lfuPolicy) push(entry *lfuEntry, bucket *list.Element) {
+	entry.bucket = bucket
+	entry.elem = bucket.Value.(*lfuBucket).keys.PushFront(entry)
+}
+
+// unlink removes entry from its bucket, and removes the bucket when it becomes empty.
+func (l *lfuPolicy) unlink(entry *lfuEntry) {
+	b := entry.bucket.Value.(*lfuBucket)
+	b.keys.Remove(entry.elem)
+	if b.keys.Len() == 0 {
+		l.buckets.Remove(entry.bucket)
+	}
+}
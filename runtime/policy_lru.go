@@ -0,0 +1,71 @@
+package runtime
+
+import "container/list"
+
+// lruPolicy evicts the least recently used key.
+type lruPolicy struct {
+	capacity int
+	ll       *list.List
+	elements map[string]*list.Element
+}
+
+// NewLRUPolicy returns an EvictionPolicy which evicts the least recently used key.
+func NewLRUPolicy(capacity int) EvictionPolicy {
+	return &lruPolicy{
+		capacity: capacity,
+		ll:       list.New(),
+		elements: make(map[string]*list.Element),
+	}
+}
+
+// Add records key as the most recently used one,
+// and returns the keys which must be evicted to respect capacity.
+func (l *lruPolicy) Add(key string) []string {
+	if e, ok := l.elements[key]; ok {
+		l.ll.MoveToFront(e)
+		return nil
+	}
+	l.elements[key] = l.ll.PushFront(key)
+	var evicted []string
+	for l.capacity > 0 && l.ll.Len() > l.capacity {
+		e := l.ll.Back()
+		victim := e.Value.(string)
+		l.ll.Remove(e)
+		delete(l.elements, victim)
+		evicted = append(evicted, victim)
+	}
+	return evicted
+}
+
+// Access marks key as the most recently used one.
+func (l *lruPolicy) Access(key string) {
+	if e, ok := l.elements[key]; ok {
+		l.ll.MoveToFront(e)
+	}
+}
+
+// Remove forgets key.
+func (l *lruPolicy) Remove(key string) {
+	if e, ok := l.elements[key]; ok {
+		l.ll.Remove(e)
+		delete(l.elements, key)
+	}
+}
+
+// Evict removes and returns the least recently used key.
+func (l *lruPolicy) Evict() (string, bool) {
+	e := l.ll.Back()
+	if e == nil {
+		return "", false
+	}
+	key := e.Value.(string)
+	l.ll.Remove(e)
+	delete(l.elements, key)
+	return key, true
+}
+
+// Clear forgets all keys.
+func (l *lruPolicy) Clear() {
+	l.ll.Init()
+	l.elements = make(map[string]*list.Element)
+}
@@ -0,0 +1,151 @@
+package runtime
+
+import (
+	"strconv"
+	"testing"
+)
+
+var policies = map[string]PolicyFactory{
+	"lru":     PolicyLRU,
+	"lfu":     PolicyLFU,
+	"arc":     PolicyARC,
+	"tinylfu": PolicyTinyLFU,
+}
+
+func TestEvictionPolicy_Capacity(t *testing.T) {
+	for name, factory := range policies {
+		rc := NewRuntimeCache(WithMaxEntries(100), WithEvictionPolicy(factory))
+		for i := 0; i < 1000; i++ {
+			rc.Set(strconv.Itoa(i), i, 0)
+			rc.Get(strconv.Itoa(i % 10))
+		}
+		if len(rc.items) > 100 {
+			t.Error("TestEvictionPolicy_Capacity", name, "expect at most 100 items, got", len(rc.items))
+		}
+	}
+}
+
+func TestEvictionPolicy_RemoveAndClear(t *testing.T) {
+	for name, factory := range policies {
+		rc := NewRuntimeCache(WithMaxEntries(3), WithEvictionPolicy(factory))
+		rc.Set("1", 1, 0)
+		rc.Set("2", 2, 0)
+		rc.Delete("1")
+		rc.Set("3", 3, 0)
+		rc.Set("4", 4, 0)
+		if len(rc.items) > 3 {
+			t.Error("TestEvictionPolicy_RemoveAndClear", name, "expect at most 3 items, got", len(rc.items))
+		}
+		rc.ClearAll()
+		for i := 0; i < 10; i++ {
+			rc.Set(strconv.Itoa(i), i, 0)
+		}
+		if len(rc.items) > 3 {
+			t.Error("TestEvictionPolicy_RemoveAndClear", name, "after ClearAll expect at most 3 items, got", len(rc.items))
+		}
+	}
+}
+
+func TestLFUPolicy_EvictLeastFrequent(t *testing.T) {
+	rc := NewRuntimeCache(WithMaxEntries(2), WithEvictionPolicy(PolicyLFU))
+	rc.Set("hot", 1, 0)
+	rc.Set("cold", 2, 0)
+	rc.Get("hot")
+	rc.Get("hot")
+	rc.Set("new", 3, 0)
+	if exists, _ := rc.Exists("cold"); exists {
+		t.Error("TestLFUPolicy_EvictLeastFrequent cold should be evicted")
+	}
+	if exists, _ := rc.Exists("hot"); !exists {
+		t.Error("TestLFUPolicy_EvictLeastFrequent hot should exist")
+	}
+}
+
+func TestLFUPolicy_EvictAfterRemove(t *testing.T) {
+	l := NewLFUPolicy(0).(*lfuPolicy)
+	l.Add("cold")
+	l.Add("warm")
+	l.Access("warm")
+	l.Add("hot")
+	for i := 0; i < 100000; i++ {
+		l.Access("hot")
+	}
+	l.Remove("cold")
+	if l.buckets.Len() != 2 {
+		t.Error("TestLFUPolicy_EvictAfterRemove expect 2 buckets, got", l.buckets.Len())
+	}
+	for _, expect := range []string{"warm", "hot"} {
+		if key, ok := l.Evict(); !ok || key != expect {
+			t.Error("TestLFUPolicy_EvictAfterRemove expect", expect, "got", key, ok)
+		}
+	}
+	if _, ok := l.Evict(); ok || l.buckets.Len() != 0 {
+		t.Error("TestLFUPolicy_EvictAfterRemove expect empty policy")
+	}
+}
+
+// hot keys must survive a scan of one-time keys with the scan resistant policies
+func TestEvictionPolicy_ScanResistance(t *testing.T) {
+	for _, name := range []string{"lfu", "arc", "tinylfu"} {
+		rc := NewRuntimeCache(WithMaxEntries(100), WithEvictionPolicy(policies[name]))
+		for round := 0; round < 5; round++ {
+			for i := 0; i < 50; i++ {
+				key := "hot" + strconv.Itoa(i)
+				if v, _ := rc.Get(key); v == nil {
+					rc.Set(key, i, 0)
+				}
+			}
+		}
+		for i := 0; i < 1000; i++ {
+			rc.Set("scan"+strconv.Itoa(i), i, 0)
+		}
+		rc.ResetStats()
+		for i := 0; i < 50; i++ {
+			rc.Get("hot" + strconv.Itoa(i))
+		}
+		if ratio := rc.Stats().HitRatio(); ratio < 0.5 {
+			t.Error("TestEvictionPolicy_ScanResistance", name, "hit ratio too low", ratio)
+		}
+	}
+}
+
+func TestRuntimeCache_Stats(t *testing.T) {
+	rc := NewRuntimeCache(WithMaxEntries(1))
+	rc.Set("1", 1, 0)
+	rc.Get("1")
+	rc.Get("2")
+	rc.Set("2", 2, 0)
+	stats := rc.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Evictions != 1 {
+		t.Error("TestRuntimeCache_Stats unexpected stats", stats)
+	}
+	if stats.HitRatio() != 0.5 {
+		t.Error("TestRuntimeCache_Stats expect hit ratio 0.5, got", stats.HitRatio())
+	}
+}
+
+func TestARCPolicy_MaxCostOnly(t *testing.T) {
+	rc := NewRuntimeCache(WithMaxCost(100), WithSizer(func(interface{}) int64 { return 10 }), WithEvictionPolicy(PolicyARC))
+	arc := rc.policy.(*arcPolicy)
+	for i := 0; i < 1000; i++ {
+		rc.Set(strconv.Itoa(i), i, 0)
+	}
+	if len(rc.items) != 10 {
+		t.Error("TestARCPolicy_MaxCostOnly expect 10 items, got", len(rc.items))
+	}
+	if ghosts := arc.lists[arcB1].Len() + arc.lists[arcB2].Len(); ghosts > len(rc.items) {
+		t.Error("TestARCPolicy_MaxCostOnly expect ghost lists bounded by resident keys, got", ghosts)
+	}
+
+	// a ghost hit does not evict a live key while the cache is under budget
+	for i := 990; i < 995; i++ {
+		rc.Delete(strconv.Itoa(i))
+	}
+	rc.Set("989", 989, 0)
+	if len(rc.items) != 6 {
+		t.Error("TestARCPolicy_MaxCostOnly expect 6 items after a ghost hit under budget, got", len(rc.items))
+	}
+	if e, ok := arc.entries["989"]; !ok || e.Value.(*arcEntry).where != arcT2 {
+		t.Error("TestARCPolicy_MaxCostOnly expect the ghost hit in t2")
+	}
+}
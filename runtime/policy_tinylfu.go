@@ -0,0 +1,318 @@
+package runtime
+
+import (
+	"container/list"
+	"hash/fnv"
+	"math"
+)
+
+const (
+	// tinyLFUWindowPercent is the share of capacity given to the admission window
+	tinyLFUWindowPercent = 1
+	// tinyLFUProtectedPercent is the share of the main space given to the protected segment
+	tinyLFUProtectedPercent = 80
+	// tinyLFUSampleFactor * capacity increments trigger a reset of the sketch
+	tinyLFUSampleFactor = 10
+	// tinyLFUDefaultSketchSize sizes the sketch when the key count is not limited
+	tinyLFUDefaultSketchSize = 4096
+	sketchDepth              = 4
+	sketchMaxCount           = 15
+)
+
+// tinyLFU segment ids
+const (
+	tinyWindow = iota
+	tinyProbation
+	tinyProtected
+)
+
+type tinyLFUEntry struct {
+	key     string
+	hash    uint64
+	segment int
+}
+
+// tinyLFUPolicy implements W-TinyLFU:
+// new keys enter a small LRU window, keys leaving the window compete with the victim of
+// the main segmented LRU, and the one with the higher estimated frequency stays.
+// frequencies are estimated by a count-min sketch in front of which a doorkeeper
+// bloom filter absorbs keys seen only once.
+type tinyLFUPolicy struct {
+	windowCap    int
+	protectedCap int
+	mainCap      int
+
+	segments [3]*list.List
+	entries  map[string]*list.Element
+
+	sketch     *countMinSketch
+	doorkeeper *doorkeeper
+	additions  int
+	sampleSize int
+}
+
+// NewTinyLFUPolicy returns an EvictionPolicy implementing W-TinyLFU.
+// with capacity 0, there is no admission contest and keys are only evicted by Evict in LRU order.
+func NewTinyLFUPolicy(capacity int) EvictionPolicy {
+	windowCap, sketchSize := maxInt(capacity*tinyLFUWindowPercent/100, 1), capacity
+	if capacity <= 0 {
+		windowCap, sketchSize = math.MaxInt32, tinyLFUDefaultSketchSize
+	}
+	mainCap := capacity - windowCap
+	t := &tinyLFUPolicy{
+		windowCap:    windowCap,
+		mainCap:      mainCap,
+		protectedCap: mainCap * tinyLFUProtectedPercent / 100,
+		entries:      make(map[string]*list.Element),
+		sketch:       newCountMinSketch(sketchSize),
+		doorkeeper:   newDoorkeeper(sketchSize),
+		sampleSize:   sketchSize * tinyLFUSampleFactor,
+	}
+	for i := range t.segments {
+		t.segments[i] = list.New()
+	}
+	return t
+}
+
+// Add puts key in the admission window,
+// and returns the loser of the window candidate against main victim contest.
+func (t *tinyLFUPolicy) Add(key string) []string {
+	if _, ok := t.entries[key]; ok {
+		t.Access(key)
+		return nil
+	}
+	h := hashKey(key)
+	t.increment(h)
+	window := t.segments[tinyWindow]
+	t.entries[key] = window.PushFront(&tinyLFUEntry{key: key, hash: h, segment: tinyWindow})
+	if window.Len() <= t.windowCap {
+		return nil
+	}
+
+	candidate := window.Back()
+	if t.mainCap <= 0 {
+		return []string{t.drop(candidate)}
+	}
+	probation, protected := t.segments[tinyProbation], t.segments[tinyProtected]
+	if probation.Len()+protected.Len() < t.mainCap {
+		t.move(candidate, tinyProbation)
+		return nil
+	}
+	victim := probation.Back()
+	if victim == nil {
+		victim = protected.Back()
+	}
+	candidateFreq := t.estimate(candidate.Value.(*tinyLFUEntry).hash)
+	victimFreq := t.estimate(victim.Value.(*tinyLFUEntry).hash)
+	if candidateFreq > victimFreq {
+		evicted := t.drop(victim)
+		t.move(candidate, tinyProbation)
+		return []string{evicted}
+	}
+	return []string{t.drop(candidate)}
+}
+
+// Access counts a hit on key and promotes it inside the segmented LRU.
+func (t *tinyLFUPolicy) Access(key string) {
+	e, ok := t.entries[key]
+	if !ok {
+		return
+	}
+	entry := e.Value.(*tinyLFUEntry)
+	t.increment(entry.hash)
+	switch entry.segment {
+	case tinyWindow, tinyProtected:
+		t.segments[entry.segment].MoveToFront(e)
+	case tinyProbation:
+		t.move(e, tinyProtected)
+		protected := t.segments[tinyProtected]
+		if protected.Len() > t.protectedCap {
+			t.move(protected.Back(), tinyProbation)
+		}
+	}
+}
+
+// Remove forgets key, its frequency stays in the sketch until the next reset.
+func (t *tinyLFUPolicy) Remove(key string) {
+	if e, ok := t.entries[key]; ok {
+		t.drop(e)
+	}
+}
+
+// Evict removes and returns the victim of the main segment, or the window one if main is empty.
+func (t *tinyLFUPolicy) Evict() (string, bool) {
+	for _, segment := range []int{tinyProbation, tinyProtected, tinyWindow} {
+		if e := t.segments[segment].Back(); e != nil {
+			return t.drop(e), true
+		}
+	}
+	return "", false
+}
+
+// Clear forgets all keys and frequencies.
+func (t *tinyLFUPolicy) Clear() {
+	for _, l := range t.segments {
+		l.Init()
+	}
+	t.entries = make(map[string]*list.Element)
+	t.sketch.clear()
+	t.doorkeeper.clear()
+	t.additions = 0
+}
+
+// increment counts one occurrence of hash, the first one is only recorded by the doorkeeper.
+// after sampleSize increments all counters are halved so old popularity fades.
+func (t *tinyLFUPolicy) increment(h uint64) {
+	t.additions++
+	if t.additions >= t.sampleSize {
+		t.sketch.reset()
+		t.doorkeeper.clear()
+		t.additions = 0
+	}
+	if t.doorkeeper.add(h) {
+		t.sketch.increment(h)
+	}
+}
+
+func (t *tinyLFUPolicy) estimate(h uint64) int {
+	freq := t.sketch.estimate(h)
+	if t.doorkeeper.contains(h) {
+		freq++
+	}
+	return freq
+}
+
+// move puts e at the front of segment.
+func (t *tinyLFUPolicy) move(e *list.Element, segment int) {
+	entry := e.Value.(*tinyLFUEntry)
+	t.segments[entry.segment].Remove(e)
+	entry.segment = segment
+	t.entries[entry.key] = t.segments[segment].PushFront(entry)
+}
+
+// drop removes e from the policy and returns its key.
+func (t *tinyLFUPolicy) drop(e *list.Element) string {
+	entry := e.Value.(*tinyLFUEntry)
+	t.segments[entry.segment].Remove(e)
+	delete(t.entries, entry.key)
+	return entry.key
+}
+
+// countMinSketch estimates key frequencies with sketchDepth rows of small saturating counters.
+type countMinSketch struct {
+	rows [sketchDepth][]uint8
+	mask uint64
+}
+
+func newCountMinSketch(capacity int) *countMinSketch {
+	width := nextPowerOfTwo(maxInt(capacity, 16))
+	s := &countMinSketch{mask: uint64(width - 1)}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) increment(h uint64) {
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < sketchMaxCount {
+			s.rows[i][idx]++
+		}
+	}
+}
+
+func (s *countMinSketch) estimate(h uint64) int {
+	least := uint8(sketchMaxCount)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < least {
+			least = v
+		}
+	}
+	return int(least)
+}
+
+// reset halves all counters.
+func (s *countMinSketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+}
+
+func (s *countMinSketch) clear() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] = 0
+		}
+	}
+}
+
+func (s *countMinSketch) index(h uint64, row int) uint64 {
+	return indexHash(h, row) & s.mask
+}
+
+// doorkeeper is a bloom filter remembering keys seen since the last reset.
+type doorkeeper struct {
+	bits []uint64
+	mask uint64
+}
+
+func newDoorkeeper(capacity int) *doorkeeper {
+	size := nextPowerOfTwo(capacity * 8)
+	if size < 64 {
+		size = 64
+	}
+	return &doorkeeper{bits: make([]uint64, size/64), mask: uint64(size - 1)}
+}
+
+// add records h and returns true if it was already there.
+func (d *doorkeeper) add(h uint64) bool {
+	seen := true
+	for i := 0; i < sketchDepth; i++ {
+		idx := indexHash(h, i) & d.mask
+		word, bit := idx/64, uint64(1)<<(idx%64)
+		if d.bits[word]&bit == 0 {
+			seen = false
+			d.bits[word] |= bit
+		}
+	}
+	return seen
+}
+
+func (d *doorkeeper) contains(h uint64) bool {
+	for i := 0; i < sketchDepth; i++ {
+		idx := indexHash(h, i) & d.mask
+		if d.bits[idx/64]&(uint64(1)<<(idx%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *doorkeeper) clear() {
+	for i := range d.bits {
+		d.bits[i] = 0
+	}
+}
+
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// indexHash derives the i-th hash of h by double hashing.
+func indexHash(h uint64, i int) uint64 {
+	h1, h2 := h, (h>>32)|(h<<32)
+	return h1 + uint64(i)*(h2|1)
+}
+
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
@@ -0,0 +1,117 @@
+package runtime
+
+import "reflect"
+
+// Sizer returns the cost of value, in bytes, used when the cache is bounded by WithMaxCost.
+type Sizer func(value interface{}) int64
+
+// DefaultSizer estimates the memory used by value.
+// string and []byte cost their length, other values are walked by reflection,
+// counting each pointed value once.
+func DefaultSizer(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	}
+	return sizeOf(reflect.ValueOf(value), make(map[uintptr]bool))
+}
+
+func sizeOf(v reflect.Value, seen map[uintptr]bool) int64 {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.String:
+		return int64(v.Type().Size()) + int64(v.Len())
+	case reflect.Ptr:
+		size := int64(v.Type().Size())
+		if v.IsNil() || seen[v.Pointer()] {
+			return size
+		}
+		seen[v.Pointer()] = true
+		return size + sizeOf(v.Elem(), seen)
+	case reflect.Interface:
+		size := int64(v.Type().Size())
+		if v.IsNil() {
+			return size
+		}
+		return size + sizeOf(v.Elem(), seen)
+	case reflect.Slice:
+		size := int64(v.Type().Size())
+		if v.IsNil() || seen[v.Pointer()] {
+			return size
+		}
+		seen[v.Pointer()] = true
+		return size + elementsSize(v, seen)
+	case reflect.Array:
+		return elementsSize(v, seen)
+	case reflect.Map:
+		size := int64(v.Type().Size())
+		if v.IsNil() || seen[v.Pointer()] {
+			return size
+		}
+		seen[v.Pointer()] = true
+		iter := v.MapRange()
+		for iter.Next() {
+			size += sizeOf(iter.Key(), seen) + sizeOf(iter.Value(), seen)
+		}
+		return size
+	case reflect.Struct:
+		var size int64
+		for i := 0; i < v.NumField(); i++ {
+			size += sizeOf(v.Field(i), seen)
+		}
+		// count padding between fields
+		if padding := int64(v.Type().Size()) - fieldsSize(v.Type()); padding > 0 {
+			size += padding
+		}
+		return size
+	default:
+		return int64(v.Type().Size())
+	}
+}
+
+// elementsSize returns the size of all elements of a slice or an array,
+// without walking them if they hold no reference.
+func elementsSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	elem := v.Type().Elem()
+	if isFlat(elem) {
+		return int64(v.Len()) * int64(elem.Size())
+	}
+	var size int64
+	for i := 0; i < v.Len(); i++ {
+		size += sizeOf(v.Index(i), seen)
+	}
+	return size
+}
+
+func fieldsSize(t reflect.Type) int64 {
+	var size int64
+	for i := 0; i < t.NumField(); i++ {
+		size += int64(t.Field(i).Type.Size())
+	}
+	return size
+}
+
+// isFlat reports whether values of t hold no reference to other memory.
+func isFlat(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return isFlat(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !isFlat(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
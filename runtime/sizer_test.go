@@ -0,0 +1,22 @@
+package runtime
+
+import "testing"
+
+func TestDefaultSizer(t *testing.T) {
+	type user struct {
+		ID   int64
+		Name string
+		Tags []string
+	}
+	if size := DefaultSizer("hello"); size != 5 {
+		t.Error("TestDefaultSizer string expect 5, got", size)
+	}
+	if size := DefaultSizer([]byte("hello")); size != 5 {
+		t.Error("TestDefaultSizer []byte expect 5, got", size)
+	}
+	small := DefaultSizer(&user{ID: 1, Name: "a"})
+	large := DefaultSizer(&user{ID: 1, Name: "a", Tags: []string{"0123456789", "0123456789"}})
+	if small <= 0 || large-small < 20 {
+		t.Error("TestDefaultSizer struct size is not growing with content", small, large)
+	}
+}
@@ -0,0 +1,56 @@
+package runtime
+
+import "sync/atomic"
+
+// Stats is a snapshot of RuntimeCache counters,
+// use it to compare eviction policies on real traffic.
+type Stats struct {
+	// Hits is the number of Get calls which found an item
+	Hits uint64
+	// Misses is the number of Get calls which found nothing or an expired item
+	Misses uint64
+	// Evictions is the number of items removed by the eviction policy
+	Evictions uint64
+}
+
+// HitRatio returns Hits / (Hits + Misses), 0 if there is no request yet.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// cacheStats holds the live counters, updated atomically.
+type cacheStats struct {
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+func (s *cacheStats) hit() {
+	atomic.AddUint64(&s.hits, 1)
+}
+
+func (s *cacheStats) miss() {
+	atomic.AddUint64(&s.misses, 1)
+}
+
+func (s *cacheStats) evict(n int) {
+	atomic.AddUint64(&s.evictions, uint64(n))
+}
+
+func (s *cacheStats) snapshot() Stats {
+	return Stats{
+		Hits:      atomic.LoadUint64(&s.hits),
+		Misses:    atomic.LoadUint64(&s.misses),
+		Evictions: atomic.LoadUint64(&s.evictions),
+	}
+}
+
+func (s *cacheStats) reset() {
+	atomic.StoreUint64(&s.hits, 0)
+	atomic.StoreUint64(&s.misses, 0)
+	atomic.StoreUint64(&s.evictions, 0)
+}
@@ -0,0 +1,440 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/devfeel/cache/redis"
+)
+
+const (
+	// DefaultL1TTL is the ttl in seconds of values copied to the L1 cache of a TieredCache
+	DefaultL1TTL = 60
+	// DefaultInvalidationChannel is the channel used by TieredCache to evict L1 copies of peers
+	DefaultInvalidationChannel = "cache:tiered:invalidation"
+
+	// resubscribeInterval is the delay before subscribing again when the invalidation subscription fails
+	resubscribeInterval = time.Second
+)
+
+// TieredOption configures a TieredCache created by NewTieredCache
+type TieredOption func(*TieredCache)
+
+// WithL1TTL sets the ttl in seconds of values copied to L1, DefaultL1TTL by default.
+// it bounds how long a peer may serve a stale value when an invalidation message is lost.
+func WithL1TTL(ttl int64) TieredOption {
+	return func(c *TieredCache) {
+		if ttl > 0 {
+			c.l1TTL = ttl
+		}
+	}
+}
+
+// WithInvalidationChannel sets the channel of invalidation messages, DefaultInvalidationChannel by default.
+// all processes sharing the same L2 data must use the same channel.
+func WithInvalidationChannel(channel string) TieredOption {
+	return func(c *TieredCache) {
+		if channel != "" {
+			c.channel = channel
+		}
+	}
+}
+
+// invalidation is the message published by TieredCache when it changes keys in L2
+type invalidation struct {
+	ID   string   `json:"id"`
+	Keys []string `json:"keys,omitempty"`
+	All  bool     `json:"all,omitempty"`
+}
+
+// TieredCache is a Cache reading a local L1 cache, usually a RuntimeCache, before a RedisCache L2.
+// a value missed in L1 is read from L2 and copied to L1 with the L1 ttl.
+// writes, counters, deletes and Expire go to L2, evict the local copy and publish the keys on the
+// invalidation channel, so other TieredCache on the same channel evict their copies too.
+// pub/sub delivers at most once, a peer which misses a message serves its copy until the L1 ttl,
+// and L1 is cleared whenever the subscription is established again.
+type TieredCache struct {
+	l1      Cache
+	l2      RedisCache
+	l1TTL   int64
+	channel string
+	id      string
+
+	// fillLock orders copies to L1 with invalidations, gen counts invalidations,
+	// a value read from L2 is not copied if an invalidation happened during the read
+	fillLock sync.Mutex
+	gen      uint64
+
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+}
+
+// NewTieredCache returns a new *TieredCache with l1 in front of l2,
+// it subscribes to the invalidation channel of l2 until Close.
+func NewTieredCache(l1 Cache, l2 RedisCache, opts ...TieredOption) *TieredCache {
+	c := &TieredCache{l1: l1, l2: l2, l1TTL: DefaultL1TTL, channel: DefaultInvalidationChannel, id: newInstanceID()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	receive := make(chan redis.Message)
+	go c.subscribe(ctx, receive)
+	go c.receive(ctx, receive)
+	return c
+}
+
+// L1 returns the local cache
+func (c *TieredCache) L1() Cache {
+	return c.l1
+}
+
+// L2 returns the shared redis cache
+func (c *TieredCache) L2() RedisCache {
+	return c.l2
+}
+
+// Exists return true if key exists in L1 or L2
+func (c *TieredCache) Exists(key string) (bool, error) {
+	if ok, err := c.l1.Exists(key); err == nil && ok {
+		return true, nil
+	}
+	return c.l2.Exists(key)
+}
+
+// Get returns value by given key from L1, or from L2 and copies it to L1
+func (c *TieredCache) Get(key string) (interface{}, error) {
+	if v, err := c.l1.Get(key); err == nil && v != nil {
+		return v, nil
+	}
+	gen := c.generation()
+	v, err := c.l2.Get(key)
+	if err == nil && v != nil {
+		c.fill(gen, map[string]interface{}{key: v})
+	}
+	return v, err
+}
+
+// GetString returns value string format by given key
+// if non-existed or expired, return "" and the error of Get
+func (c *TieredCache) GetString(key string) (string, error) {
+	v, err := c.Get(key)
+	if err != nil || v == nil {
+		return "", err
+	}
+	if b, ok := v.([]byte); ok {
+		return string(b), nil
+	}
+	return fmt.Sprint(v), nil
+}
+
+// GetInt returns value int format by given key
+// return ErrTypeMismatch if value is not an integer
+func (c *TieredCache) GetInt(key string) (int, error) {
+	v, err := c.GetInt64(key)
+	return int(v), err
+}
+
+// GetInt64 returns value int64 format by given key
+// return ErrTypeMismatch if value is not an integer
+func (c *TieredCache) GetInt64(key string) (int64, error) {
+	v, err := c.GetString(key)
+	if err != nil || v == "" {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, ErrTypeMismatch
+	}
+	return i, nil
+}
+
+// GetObj get value by given key from L1 or L2 and decode it into result by the codec of L2
+// if non-existed or expired, return ErrNotFound
+func (c *TieredCache) GetObj(key string, result interface{}) error {
+	v, err := c.Get(key)
+	if err != nil {
+		return err
+	}
+	switch reply := v.(type) {
+	case nil:
+		return ErrNotFound
+	case []byte:
+		return c.l2.Decode(string(reply), result)
+	case string:
+		return c.l2.Decode(reply, result)
+	}
+	return fmt.Errorf("cache: unexpected reply type %T", v)
+}
+
+// Set set value in L2 and invalidates key
+func (c *TieredCache) Set(key string, v interface{}, ttl int64) error {
+	if err := c.l2.Set(key, v, ttl); err != nil {
+		return err
+	}
+	c.invalidate(key)
+	return nil
+}
+
+// Incr increases the counter in L2 and invalidates key
+func (c *TieredCache) Incr(key string) (int64, error) {
+	return c.IncrBy(key, 1)
+}
+
+// Decr decreases the counter in L2 and invalidates key
+func (c *TieredCache) Decr(key string) (int64, error) {
+	return c.DecrBy(key, 1)
+}
+
+// IncrBy increases the counter in L2 with delta and invalidates key
+func (c *TieredCache) IncrBy(key string, delta int64) (int64, error) {
+	v, err := c.l2.IncrBy(key, delta)
+	if err == nil {
+		c.invalidate(key)
+	}
+	return v, err
+}
+
+// DecrBy decreases the counter in L2 with delta and invalidates key
+func (c *TieredCache) DecrBy(key string, delta int64) (int64, error) {
+	v, err := c.l2.DecrBy(key, delta)
+	if err == nil {
+		c.invalidate(key)
+	}
+	return v, err
+}
+
+// IncrByFloat increases the float counter in L2 with delta and invalidates key
+func (c *TieredCache) IncrByFloat(key string, delta float64) (float64, error) {
+	v, err := c.l2.IncrByFloat(key, delta)
+	if err == nil {
+		c.invalidate(key)
+	}
+	return v, err
+}
+
+// Delete delete key in L2 and invalidates it
+func (c *TieredCache) Delete(key string) error {
+	if err := c.l2.Delete(key); err != nil {
+		return err
+	}
+	c.invalidate(key)
+	return nil
+}
+
+// ClearAll clear L2 and the L1 of all peers
+func (c *TieredCache) ClearAll() error {
+	if err := c.l2.ClearAll(); err != nil {
+		return err
+	}
+	c.evictAll()
+	c.publish(invalidation{ID: c.id, All: true})
+	return nil
+}
+
+// Expire set a timeout on key in L2 and invalidates it,
+// so no copy outlives the new timeout by more than the L1 ttl
+func (c *TieredCache) Expire(key string, timeOutSeconds int) (int, error) {
+	v, err := c.l2.Expire(key, timeOutSeconds)
+	if err == nil {
+		c.invalidate(key)
+	}
+	return v, err
+}
+
+// MGet returns values of keys from L1, keys missed in L1 are read from L2 in one round-trip and copied to L1
+func (c *TieredCache) MGet(keys ...string) (map[string]interface{}, error) {
+	items, err := c.l1.MGet(keys...)
+	if err != nil {
+		items = nil
+	}
+	missed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if _, ok := items[key]; !ok {
+			missed = append(missed, key)
+		}
+	}
+	if len(missed) == 0 {
+		return items, nil
+	}
+	gen := c.generation()
+	loaded, err := c.l2.MGet(missed...)
+	if err != nil {
+		return nil, err
+	}
+	c.fill(gen, loaded)
+	if items == nil {
+		return loaded, nil
+	}
+	for key, v := range loaded {
+		items[key] = v
+	}
+	return items, nil
+}
+
+// GetOrLoad returns value by given key from L1 or L2, on a miss it calls GetOrLoad of L2,
+// so concurrent misses wait for one loader call, in all processes if SetLoadLock is enabled on L2.
+// the loaded value is returned as by GetOrLoad of L2, like Get of L2, and copied to L1 by the next Get.
+func (c *TieredCache) GetOrLoad(key string, ttl int64, loader func() (interface{}, error)) (interface{}, error) {
+	if v, err := c.Get(key); v != nil || (err != nil && err != ErrNotFound) {
+		return v, err
+	}
+	return c.l2.GetOrLoad(key, ttl, loader)
+}
+
+// MSet set all items in L2 and invalidates their keys
+func (c *TieredCache) MSet(items map[string]interface{}, ttl int64) error {
+	if err := c.l2.MSet(items, ttl); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	c.invalidate(keys...)
+	return nil
+}
+
+// MDelete delete keys in L2 and invalidates them
+func (c *TieredCache) MDelete(keys ...string) error {
+	if err := c.l2.MDelete(keys...); err != nil {
+		return err
+	}
+	c.invalidate(keys...)
+	return nil
+}
+
+// Close stop the subscription and close L1 and L2
+func (c *TieredCache) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.cancel()
+		err = c.l1.Close()
+		if e := c.l2.Close(); err == nil {
+			err = e
+		}
+	})
+	return err
+}
+
+func (c *TieredCache) generation() uint64 {
+	c.fillLock.Lock()
+	defer c.fillLock.Unlock()
+	return c.gen
+}
+
+// fill copies items read from L2 to L1, unless an invalidation happened since gen
+func (c *TieredCache) fill(gen uint64, items map[string]interface{}) {
+	c.fillLock.Lock()
+	defer c.fillLock.Unlock()
+	if c.gen != gen {
+		return
+	}
+	for key, v := range items {
+		c.l1.Set(key, v, c.l1TTL)
+	}
+}
+
+// evict deletes the local copies of keys
+func (c *TieredCache) evict(keys ...string) {
+	c.fillLock.Lock()
+	defer c.fillLock.Unlock()
+	c.gen++
+	if len(keys) == 1 {
+		c.l1.Delete(keys[0])
+	} else if len(keys) > 0 {
+		c.l1.MDelete(keys...)
+	}
+}
+
+func (c *TieredCache) evictAll() {
+	c.fillLock.Lock()
+	defer c.fillLock.Unlock()
+	c.gen++
+	c.l1.ClearAll()
+}
+
+// invalidate evicts the local copies of keys and publishes them to peers
+func (c *TieredCache) invalidate(keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	c.evict(keys...)
+	c.publish(invalidation{ID: c.id, Keys: keys})
+}
+
+// publish sends msg on the invalidation channel, errors are ignored,
+// the write is done in L2 and peers drop their copies at the latest when the L1 ttl expires
+func (c *TieredCache) publish(msg invalidation) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	c.l2.Publish(c.channel, data)
+}
+
+// ctxSubscriber is a RedisCache whose subscriptions are stopped by a ctx, like RedisCacheCtx and EncryptedRedisCache
+type ctxSubscriber interface {
+	SubscribeCtx(ctx context.Context, receive chan redis.Message, channels ...interface{}) error
+}
+
+// subscribe keeps a subscription to the invalidation channel until ctx is done,
+// L1 is cleared when a subscription is established again, because messages may be lost meanwhile
+func (c *TieredCache) subscribe(ctx context.Context, receive chan redis.Message) {
+	subscriber, hasCtx := c.l2.(ctxSubscriber)
+	for lost := false; ; lost = true {
+		if lost {
+			c.evictAll()
+		}
+		if hasCtx {
+			subscriber.SubscribeCtx(ctx, receive, c.channel)
+		} else {
+			// without SubscribeCtx, the subscription is released only when its connection fails
+			c.l2.Subscribe(receive, c.channel)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(resubscribeInterval):
+		}
+	}
+}
+
+// receive evicts the keys of invalidation messages published by peers
+func (c *TieredCache) receive(ctx context.Context, receive chan redis.Message) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case m := <-receive:
+			c.handle(m.Data)
+		}
+	}
+}
+
+func (c *TieredCache) handle(data []byte) {
+	var msg invalidation
+	if err := json.Unmarshal(data, &msg); err != nil || msg.ID == c.id {
+		return
+	}
+	if msg.All {
+		c.evictAll()
+	} else {
+		c.evict(msg.Keys...)
+	}
+}
+
+// newInstanceID returns a random id, so a TieredCache ignores its own invalidation messages
+func newInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,247 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devfeel/cache/redis"
+)
+
+// fakeBus is the storage and the pub/sub shared by fakeRedisCache peers
+type fakeBus struct {
+	sync.Mutex
+	data Cache
+	subs []chan redis.Message
+}
+
+func (b *fakeBus) subscribers() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.subs)
+}
+
+// fakeRedisCache is a RedisCache on a runtime cache, only the commands used by TieredCache are implemented
+type fakeRedisCache struct {
+	RedisCache
+	bus  *fakeBus
+	done chan struct{}
+}
+
+func newFakeRedisCache(bus *fakeBus) *fakeRedisCache {
+	return &fakeRedisCache{bus: bus, done: make(chan struct{})}
+}
+
+func (f *fakeRedisCache) Get(key string) (interface{}, error) {
+	v, err := f.bus.data.GetString(key)
+	if v == "" {
+		return nil, err
+	}
+	return []byte(v), err
+}
+
+// Set encodes values like RedisCache, numbers and strings are stored as they are
+func (f *fakeRedisCache) Set(key string, v interface{}, ttl int64) error {
+	switch v.(type) {
+	case string, int, int64:
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		v = string(data)
+	}
+	return f.bus.data.Set(key, v, ttl)
+}
+
+func (f *fakeRedisCache) Decode(data string, result interface{}) error {
+	return json.Unmarshal([]byte(data), result)
+}
+
+func (f *fakeRedisCache) IncrBy(key string, delta int64) (int64, error) {
+	return f.bus.data.IncrBy(key, delta)
+}
+
+func (f *fakeRedisCache) Delete(key string) error {
+	return f.bus.data.Delete(key)
+}
+
+func (f *fakeRedisCache) ClearAll() error {
+	return f.bus.data.ClearAll()
+}
+
+func (f *fakeRedisCache) MGet(keys ...string) (map[string]interface{}, error) {
+	items := make(map[string]interface{})
+	for _, key := range keys {
+		if v, _ := f.Get(key); v != nil {
+			items[key] = v
+		}
+	}
+	return items, nil
+}
+
+func (f *fakeRedisCache) Publish(channel string, message interface{}) (int64, error) {
+	f.bus.Lock()
+	defer f.bus.Unlock()
+	for _, sub := range f.bus.subs {
+		sub <- redis.Message{Channel: channel, Data: message.([]byte)}
+	}
+	return int64(len(f.bus.subs)), nil
+}
+
+func (f *fakeRedisCache) Subscribe(receive chan redis.Message, channels ...interface{}) error {
+	sub := make(chan redis.Message, 16)
+	f.bus.Lock()
+	f.bus.subs = append(f.bus.subs, sub)
+	f.bus.Unlock()
+	for {
+		select {
+		case m := <-sub:
+			select {
+			case receive <- m:
+			case <-f.done:
+				return nil
+			}
+		case <-f.done:
+			return nil
+		}
+	}
+}
+
+func (f *fakeRedisCache) Close() error {
+	close(f.done)
+	return nil
+}
+
+// waitFor polls cond for a second, invalidation messages are handled asynchronously
+func waitFor(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+func TestTieredCache_Invalidation(t *testing.T) {
+	bus := &fakeBus{data: NewRuntimeCache()}
+	a := NewTieredCache(NewRuntimeCache(), newFakeRedisCache(bus), WithL1TTL(10))
+	b := NewTieredCache(NewRuntimeCache(), newFakeRedisCache(bus), WithL1TTL(10))
+	defer a.Close()
+	defer b.Close()
+	if !waitFor(func() bool { return bus.subscribers() == 2 }) {
+		t.Fatal("TestTieredCache_Invalidation subscribe timeout")
+	}
+
+	a.Set("key", "v1", 0)
+	if v, err := b.GetString("key"); err != nil || v != "v1" {
+		t.Error("TestTieredCache_Invalidation expect v1, got", v, err)
+	}
+	if v, _ := b.L1().Get("key"); v == nil {
+		t.Error("TestTieredCache_Invalidation value should be copied to L1")
+	}
+
+	a.Set("key", "v2", 0)
+	if !waitFor(func() bool { v, _ := b.L1().Get("key"); return v == nil }) {
+		t.Error("TestTieredCache_Invalidation L1 of peer should be evicted")
+	}
+	if v, err := b.GetString("key"); err != nil || v != "v2" {
+		t.Error("TestTieredCache_Invalidation expect v2, got", v, err)
+	}
+
+	// own messages are ignored, the copy filled after the write stays
+	a.IncrBy("count", 5)
+	if v, err := a.GetInt("count"); err != nil || v != 5 {
+		t.Error("TestTieredCache_Invalidation GetInt expect 5, got", v, err)
+	}
+	gen := a.generation()
+	b.Delete("other")
+	if !waitFor(func() bool { return a.generation() > gen }) {
+		t.Error("TestTieredCache_Invalidation message of peer should be handled")
+	}
+	if v, _ := a.L1().Get("count"); v == nil {
+		t.Error("TestTieredCache_Invalidation own message should be ignored")
+	}
+
+	items, err := b.MGet("key", "count", "none")
+	if err != nil || len(items) != 2 || string(items["count"].([]byte)) != "5" {
+		t.Error("TestTieredCache_Invalidation MGet expect key and count, got", items, err)
+	}
+	a.ClearAll()
+	if !waitFor(func() bool { v, _ := b.L1().Get("count"); return v == nil }) {
+		t.Error("TestTieredCache_Invalidation ClearAll should clear L1 of peer")
+	}
+}
+
+func TestTieredCache_FillAfterInvalidation(t *testing.T) {
+	bus := &fakeBus{data: NewRuntimeCache()}
+	c := NewTieredCache(NewRuntimeCache(), newFakeRedisCache(bus))
+	defer c.Close()
+
+	// a value read from L2 before an invalidation is not copied to L1
+	gen := c.generation()
+	c.handle([]byte(`{"id":"peer","keys":["key"]}`))
+	c.fill(gen, map[string]interface{}{"key": []byte("stale")})
+	if v, _ := c.L1().Get("key"); v != nil {
+		t.Error("TestTieredCache_FillAfterInvalidation stale value should not be copied, got", v)
+	}
+	c.fill(c.generation(), map[string]interface{}{"key": []byte("fresh")})
+	if v, _ := c.L1().Get("key"); v == nil {
+		t.Error("TestTieredCache_FillAfterInvalidation fresh value should be copied")
+	}
+}
+
+func TestTieredCache_Typed(t *testing.T) {
+	bus := &fakeBus{data: NewRuntimeCache()}
+	c := NewTieredCache(NewRuntimeCache(), newFakeRedisCache(bus))
+	defer c.Close()
+	tc := NewTypedCache[typedUser](c)
+	if _, err := tc.Get("user"); err != ErrNotFound {
+		t.Error("TestTieredCache_Typed expect ErrNotFound, got", err)
+	}
+	tc.Set("user", typedUser{Name: "devfeel", Age: 10}, 0)
+	// read from L2, then from the L1 copy
+	for i := 0; i < 2; i++ {
+		if user, err := tc.Get("user"); err != nil || user.Name != "devfeel" || user.Age != 10 {
+			t.Error("TestTieredCache_Typed expect devfeel 10, got", user, err)
+		}
+	}
+	if v, _ := c.L1().Get("user"); v == nil {
+		t.Error("TestTieredCache_Typed value should be copied to L1")
+	}
+}
+
+// ctxFakeRedisCache is a fakeRedisCache with SubscribeCtx
+type ctxFakeRedisCache struct {
+	*fakeRedisCache
+	subscribed chan struct{}
+	stopped    chan struct{}
+}
+
+func (f *ctxFakeRedisCache) SubscribeCtx(ctx context.Context, receive chan redis.Message, channels ...interface{}) error {
+	close(f.subscribed)
+	<-ctx.Done()
+	close(f.stopped)
+	return ctx.Err()
+}
+
+func TestTieredCache_EncryptedL2(t *testing.T) {
+	keyring, _ := NewKeyring(1, map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32)})
+	l2 := &ctxFakeRedisCache{fakeRedisCache: newFakeRedisCache(&fakeBus{data: NewRuntimeCache()}),
+		subscribed: make(chan struct{}), stopped: make(chan struct{})}
+	c := NewTieredCache(NewRuntimeCache(), NewEncryptedRedisCache(l2, keyring))
+	select {
+	case <-l2.subscribed:
+	case <-time.After(time.Second):
+		t.Fatal("TestTieredCache_EncryptedL2 expect SubscribeCtx of the wrapped cache")
+	}
+	c.Close()
+	select {
+	case <-l2.stopped:
+	case <-time.After(time.Second):
+		t.Error("TestTieredCache_EncryptedL2 subscription should stop on Close")
+	}
+}
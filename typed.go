@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/devfeel/cache/codec"
+)
+
+// TypedCache stores and returns values of type T on top of any Cache.
+// with a cache encoding values, like RedisCache, TieredCache or EncryptedCache, values are encoded
+// by the codec of the cache, or the one set by SetCodec, with other caches, values are stored as they are.
+// Get returns ErrNotFound on a miss, whether the cache is in strict mode or not.
+// T may be a pointer type, like *pb.Msg with codec.ProtobufCodec, Get decodes into a new value then.
+type TypedCache[T any] struct {
+	cache Cache
+	codec codec.Codec
+}
+
+// objCache is a Cache encoding values, which decodes them by GetObj
+type objCache interface {
+	Cache
+	GetObj(key string, result interface{}) error
+}
+
+// NewTypedCache returns a new *TypedCache using c to store values.
+func NewTypedCache[T any](c Cache) *TypedCache[T] {
+	return &TypedCache[T]{cache: c}
+}
+
+// SetCodec set codec used to encode values, instead of the codec of the cache
+// it has no effect if cache does not encode values
+func (tc *TypedCache[T]) SetCodec(c codec.Codec) *TypedCache[T] {
+	if c != nil {
+		tc.codec = c
+	}
+	return tc
+}
+
+// Cache returns the underlying cache.
+func (tc *TypedCache[T]) Cache() Cache {
+	return tc.cache
+}
+
+// Get returns value by given key
+// if non-existed or expired, return ErrNotFound
+// if stored value is not a T, return ErrTypeMismatch, or the codec error for a cache encoding values
+func (tc *TypedCache[T]) Get(key string) (T, error) {
+	var value T
+	if oc, ok := tc.cache.(objCache); ok && tc.codec == nil {
+		err := oc.GetObj(key, decodeTarget(&value))
+		return value, err
+	}
+	v, err := tc.cache.Get(key)
+	if err != nil {
+		return value, err
+	}
+	if v == nil {
+		return value, ErrNotFound
+	}
+	if !tc.encoded() {
+		typed, ok := v.(T)
+		if !ok {
+			return value, ErrTypeMismatch
+		}
+		return typed, nil
+	}
+	var data []byte
+	switch reply := v.(type) {
+	case []byte:
+		data = reply
+	case string:
+		data = []byte(reply)
+	default:
+		return value, fmt.Errorf("cache: unexpected reply type %T", v)
+	}
+	err = tc.codec.Unmarshal(data, decodeTarget(&value))
+	return value, err
+}
+
+// decodeTarget returns the pointer a value is decoded into, value itself,
+// or if T is a pointer type, like *pb.Msg, a new value of its element type which *value is set to,
+// so codecs requiring a proto.Message or another interface implemented by T get it
+func decodeTarget[T any](value *T) interface{} {
+	rt := reflect.TypeOf(value).Elem()
+	if rt.Kind() != reflect.Ptr {
+		return value
+	}
+	elem := reflect.New(rt.Elem())
+	reflect.ValueOf(value).Elem().Set(elem)
+	return elem.Interface()
+}
+
+// Set cache value by given key
+// ttl is second, if ttl is 0, it will be forever
+func (tc *TypedCache[T]) Set(key string, value T, ttl int64) error {
+	if !tc.encoded() {
+		return tc.cache.Set(key, value, ttl)
+	}
+	if tc.codec == nil {
+		// encoded by the cache
+		return tc.cache.Set(key, value, ttl)
+	}
+	data, err := tc.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return tc.cache.Set(key, data, ttl)
+}
+
+// Exists return true if value cached by given key
+func (tc *TypedCache[T]) Exists(key string) (bool, error) {
+	return tc.cache.Exists(key)
+}
+
+// Delete delete cache item by given key
+func (tc *TypedCache[T]) Delete(key string) error {
+	return tc.cache.Delete(key)
+}
+
+// encoded reports whether values are encoded by the cache or the codec
+func (tc *TypedCache[T]) encoded() bool {
+	_, ok := tc.cache.(objCache)
+	return ok
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/devfeel/cache/codec"
+	"github.com/devfeel/cache/runtime"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type typedUser struct {
+	Name string
+	Age  int
+}
+
+func TestTypedCache_Runtime(t *testing.T) {
+	c := NewRuntimeCache()
+	tc := NewTypedCache[typedUser](c)
+	if _, err := tc.Get("user"); err != ErrNotFound {
+		t.Error("TestTypedCache_Runtime expect ErrNotFound, got", err)
+	}
+	tc.Set("user", typedUser{Name: "devfeel", Age: 10}, 0)
+	user, err := tc.Get("user")
+	if err != nil || user.Name != "devfeel" || user.Age != 10 {
+		t.Error("TestTypedCache_Runtime expect devfeel 10, got", user, err)
+	}
+	c.Set("text", "abc", 0)
+	if _, err := NewTypedCache[typedUser](c).Get("text"); err != ErrTypeMismatch {
+		t.Error("TestTypedCache_Runtime expect ErrTypeMismatch, got", err)
+	}
+}
+
+func TestTypedCache_StrictRuntime(t *testing.T) {
+	tc := NewTypedCache[int](NewRuntimeCache(runtime.WithStrictMode()))
+	if _, err := tc.Get("none"); err != ErrNotFound {
+		t.Error("TestTypedCache_StrictRuntime expect ErrNotFound, got", err)
+	}
+}
+
+func TestTypedCache_Protobuf(t *testing.T) {
+	keyring, _ := NewKeyring(1, map[uint32][]byte{1: bytes.Repeat([]byte{1}, 32)})
+	ec := NewEncryptedCache(NewRuntimeCache(), keyring)
+	ec.SetCodec(codec.ProtobufCodec{})
+	tc := NewTypedCache[*wrapperspb.StringValue](ec)
+	if err := tc.Set("msg", wrapperspb.String("devfeel"), 0); err != nil {
+		t.Fatal("TestTypedCache_Protobuf Set error", err)
+	}
+	msg, err := tc.Get("msg")
+	if err != nil || msg.GetValue() != "devfeel" {
+		t.Error("TestTypedCache_Protobuf expect devfeel, got", msg, err)
+	}
+	// the codec of TypedCache
+	tc = NewTypedCache[*wrapperspb.StringValue](NewEncryptedCache(NewRuntimeCache(), keyring)).SetCodec(codec.ProtobufCodec{})
+	tc.Set("msg", wrapperspb.String("devfeel"), 0)
+	msg, err = tc.Get("msg")
+	if err != nil || msg.GetValue() != "devfeel" {
+		t.Error("TestTypedCache_Protobuf SetCodec expect devfeel, got", msg, err)
+	}
+}